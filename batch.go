@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// batcher collects records and hands them to flush in batches, either once
+// size records are buffered or when interval elapses, whichever comes first.
+// Sinks that talk to bulk APIs embed it to get consistent batching behaviour.
+type batcher struct {
+	mu      sync.Mutex
+	records []record
+	size    int
+	flush   func([]record) error
+	done    chan struct{}
+	wg      sync.WaitGroup
+
+	// Health counters, read by the TUI without waiting for a flush; dropped
+	// counts the records of failed flushes, which are not retried
+	pending atomic.Int64
+	flushed atomic.Uint64
+	failed  atomic.Uint64
+	dropped atomic.Uint64
+	lastErr atomic.Value
+}
+
+// batchers are all the batchers of the process, for the TUI's sink health.
+var batchers struct {
+	mu   sync.Mutex
+	list []*batcher
+}
+
+func newBatcher(size int, interval time.Duration, flush func([]record) error) *batcher {
+	if size < 1 {
+		size = 1
+	}
+	b := &batcher{size: size, flush: flush, done: make(chan struct{})}
+	batchers.mu.Lock()
+	batchers.list = append(batchers.list, b)
+	batchers.mu.Unlock()
+	if interval > 0 {
+		b.wg.Add(1)
+		go b.flushEvery(interval)
+	}
+	return b
+}
+
+func (b *batcher) Send(r record) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.records = append(b.records, r)
+	b.pending.Add(1)
+	if len(b.records) < b.size {
+		return nil
+	}
+	return b.flushLocked()
+}
+
+// Close stops the periodic flush and sends whatever is still buffered.
+func (b *batcher) Close() error {
+	close(b.done)
+	b.wg.Wait()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.flushLocked()
+}
+
+// Flush sends whatever is buffered right away.
+func (b *batcher) Flush() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.flushLocked()
+}
+
+func (b *batcher) flushEvery(interval time.Duration) {
+	defer b.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.done:
+			return
+		case <-ticker.C:
+			b.mu.Lock()
+			// There is no caller to return the error to, so report it and
+			// keep going; the failed batch is dropped.
+			if err := b.flushLocked(); err != nil {
+				fmt.Fprintln(os.Stderr, "batch flush failed:", err)
+			}
+			b.mu.Unlock()
+		}
+	}
+}
+
+func (b *batcher) flushLocked() error {
+	if len(b.records) == 0 {
+		return nil
+	}
+	batch := b.records
+	b.records = nil
+	b.pending.Add(-int64(len(batch)))
+	if err := b.flush(batch); err != nil {
+		b.failed.Add(1)
+		b.dropped.Add(uint64(len(batch)))
+		b.lastErr.Store(err.Error())
+		return err
+	}
+	b.flushed.Add(uint64(len(batch)))
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+// crawler is a search engine or SEO bot. Each crawls from a handful of
+// addresses of its own network, so its traffic piles up on few IPs.
+type crawler struct {
+	userAgent string
+	ips       []string
+}
+
+// crawlers are drawn by their usual share of crawler traffic.
+var crawlers = func() *weighted[crawler] {
+	w := &weighted[crawler]{}
+	w.add(crawler{"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+		[]string{"66.249.66.1", "66.249.66.34", "66.249.68.5", "66.249.79.12"}}, 45)
+	w.add(crawler{"Mozilla/5.0 (compatible; bingbot/2.0; +http://www.bing.com/bingbot.htm)",
+		[]string{"157.55.39.20", "40.77.167.58", "207.46.13.91"}}, 25)
+	w.add(crawler{"Mozilla/5.0 (compatible; AhrefsBot/7.0; +http://ahrefs.com/robot/)",
+		[]string{"54.36.148.17", "54.36.149.88"}}, 20)
+	w.add(crawler{"Mozilla/5.0 (compatible; YandexBot/3.0; +http://yandex.com/bots)",
+		[]string{"5.255.253.14", "213.180.203.60"}}, 10)
+	return w
+}()
+
+// crawlerFiles are the files crawlers fetch besides pages, with the
+// percentage of crawler requests asking for each.
+var crawlerFiles = []struct {
+	path    string
+	percent float64
+}{
+	{"/robots.txt", 5},
+	{"/sitemap.xml", 3},
+}
+
+// crawl returns the client address, user agent, path and status of a
+// crawler request. Crawlers only GET pages, never assets or APIs, and
+// find robots.txt and the sitemap; a page keeps the status drawn for it.
+func (g *generator) crawl(statusCode int) (ip, userAgent, path string, status int) {
+	c := crawlers.draw(g.rng)
+	ip = c.ips[g.rng.Intn(len(c.ips))]
+	roll := g.rng.Float64() * 100
+	for _, f := range crawlerFiles {
+		if roll < f.percent {
+			return ip, c.userAgent, f.path, 200
+		}
+		roll -= f.percent
+	}
+	return ip, c.userAgent, g.crawlPages[g.rng.Intn(len(g.crawlPages))], statusCode
+}
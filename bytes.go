@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// sizeRange is an inclusive range of response sizes in bytes.
+type sizeRange struct {
+	min, max int
+}
+
+func (r sizeRange) draw(rnd *rand.Rand) int {
+	return r.min + rnd.Intn(r.max-r.min+1)
+}
+
+// defaultBodySizes returns the response size of every status code nginx
+// answers with a built-in page or no body at all. Error pages and redirects
+// get the exact size of nginx's default page for the code.
+func defaultBodySizes() map[int]sizeRange {
+	sizes := map[int]sizeRange{
+		204: {0, 0},
+		304: {0, 0},
+		499: {0, 0},
+	}
+	for code := 300; code < 600; code++ {
+		text := http.StatusText(code)
+		if text == "" || code == 304 {
+			continue
+		}
+		page := fmt.Sprintf("<html>\r\n<head><title>%d %s</title></head>\r\n<body>\r\n<center><h1>%d %s</h1></center>\r\n<hr><center>nginx</center>\r\n</body>\r\n</html>\r\n", code, text, code, text)
+		sizes[code] = sizeRange{len(page), len(page)}
+	}
+	return sizes
+}
+
+// parseBodySizes overrides the default sizes with BYTES_SENT_PROFILE entries
+// of the form code:size or code:min-max, e.g. "404:5000-5200,502:150".
+func parseBodySizes(spec string) (map[int]sizeRange, error) {
+	sizes := defaultBodySizes()
+	for _, part := range parseEnvList(spec) {
+		code, size, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid BYTES_SENT_PROFILE entry %q (want code:size or code:min-max)", part)
+		}
+		c, err := strconv.Atoi(code)
+		if err != nil {
+			return nil, fmt.Errorf("invalid status code in BYTES_SENT_PROFILE entry %q", part)
+		}
+		lo, hi, isRange := strings.Cut(size, "-")
+		if !isRange {
+			hi = lo
+		}
+		min, err1 := strconv.Atoi(lo)
+		max, err2 := strconv.Atoi(hi)
+		if err1 != nil || err2 != nil || min < 0 || max < min {
+			return nil, fmt.Errorf("invalid size in BYTES_SENT_PROFILE entry %q", part)
+		}
+		sizes[c] = sizeRange{min, max}
+	}
+	return sizes, nil
+}
+
+// bytesSent returns a response size for the status code: its profile entry
+// if there is one, otherwise a typical size of a successful response, by
+// the class of path with RESPONSE_CORRELATION.
+func (g *generator) bytesSent(statusCode int, path string) int {
+	if r, ok := g.bodySizes[statusCode]; ok {
+		return r.draw(g.rng)
+	}
+	if statusCode >= 400 {
+		return g.rng.Intn(120-30) + 30
+	}
+	if g.cfg.ResponseCorrelation {
+		return classBodySizes[classifyPath(path)].draw(g.rng)
+	}
+	return g.rng.Intn(3100-800) + 800
+}
+
+// logNormalSize is a log-normal distribution of response sizes with the
+// given median in bytes.
+type logNormalSize struct {
+	median, sigma float64
+}
+
+func (s logNormalSize) draw(rnd *rand.Rand) int {
+	return max(int(s.median*math.Exp(s.sigma*rnd.NormFloat64())), 1)
+}
+
+// classBodySizes are the sizes of successful responses by path class:
+// static assets are large and vary most, API JSON is mid-sized.
+var classBodySizes = map[pathClass]logNormalSize{
+	pagePath:   {12000, 0.6},
+	staticPath: {25000, 1.2},
+	apiPath:    {1500, 0.8},
+}
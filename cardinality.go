@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cappedFields are the fields CARDINALITY_LIMITS can cap.
+var cappedFields = map[string]bool{
+	"http.user_agent":   true,
+	"http.host":         true,
+	"http.uri":          true,
+	"nginx.remote_addr": true,
+}
+
+// valuePool caps the number of distinct values of a field. New values are
+// admitted until the pool is full; after that, every value is replaced by
+// one already in the pool. With a window the pool empties every window of
+// generated time, so the cap applies per window.
+type valuePool struct {
+	limit  int
+	window time.Duration
+
+	start  time.Time
+	values []string
+	seen   map[string]bool
+}
+
+// parseCardinalityLimits reads field:limit[/window] entries, such as
+// "http.user_agent:1000,nginx.remote_addr:10000/24h".
+func parseCardinalityLimits(spec string) (map[string]*valuePool, error) {
+	pools := map[string]*valuePool{}
+	for _, part := range parseEnvList(spec) {
+		part = strings.TrimSpace(part)
+		field, limit, ok := strings.Cut(part, ":")
+		if !ok || !cappedFields[field] {
+			return nil, fmt.Errorf("invalid CARDINALITY_LIMITS entry %q (fields: http.user_agent, http.host, http.uri, nginx.remote_addr)", part)
+		}
+		limit, window, hasWindow := strings.Cut(limit, "/")
+		p := &valuePool{seen: map[string]bool{}}
+		var err error
+		if p.limit, err = strconv.Atoi(limit); err != nil || p.limit < 1 {
+			return nil, fmt.Errorf("invalid limit in CARDINALITY_LIMITS entry %q", part)
+		}
+		if hasWindow {
+			if p.window, err = time.ParseDuration(window); err != nil || p.window <= 0 {
+				return nil, fmt.Errorf("invalid window in CARDINALITY_LIMITS entry %q", part)
+			}
+		}
+		pools[field] = p
+	}
+	return pools, nil
+}
+
+// value returns v if the pool admits it at t, and a pooled value otherwise.
+func (p *valuePool) value(rnd *rand.Rand, v string, t time.Time) string {
+	if p.window > 0 && (p.start.IsZero() || !t.Before(p.start.Add(p.window))) {
+		p.start, p.values, p.seen = t, nil, map[string]bool{}
+	}
+	if p.seen[v] {
+		return v
+	}
+	if len(p.values) < p.limit {
+		p.values = append(p.values, v)
+		p.seen[v] = true
+		return v
+	}
+	return p.values[rnd.Intn(len(p.values))]
+}
+
+// capped applies the cardinality limit of field, if there is one.
+func (g *generator) capped(field, v string, t time.Time) string {
+	if p := g.cardinality[field]; p != nil {
+		return p.value(g.rng, v, t)
+	}
+	return v
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/patsevanton/nginx-log-generator/realism"
+)
+
+// realismEntry returns the fields of e the realism invariants look at.
+func realismEntry(e *logEntry) *realism.Entry {
+	return &realism.Entry{
+		HTTP: realism.HTTP{
+			RequestID:      e.HTTP.RequestID,
+			StatusCode:     e.HTTP.StatusCode,
+			URL:            e.HTTP.URL,
+			Host:           e.HTTP.Host,
+			URI:            e.HTTP.URI,
+			RequestTime:    float64(e.HTTP.RequestTime),
+			Protocol:       e.HTTP.Protocol,
+			ServerProtocol: e.HTTP.ServerProtocol,
+			BytesSent:      e.HTTP.BytesSent,
+			ContentLength:  e.HTTP.ContentLength,
+			Scheme:         e.HTTP.Scheme,
+		},
+		Nginx: realism.Nginx{
+			XForwardFor:          e.Nginx.XForwardFor,
+			RemoteAddr:           e.Nginx.RemoteAddr,
+			UpstreamAddr:         e.Nginx.UpstreamAddr,
+			UpstreamStatus:       e.Nginx.UpstreamStatus,
+			UpstreamResponseTime: e.Nginx.UpstreamResponseTime,
+			SSLProtocol:          e.Nginx.SSLProtocol,
+			SSLServerName:        e.Nginx.SSLServerName,
+			IngressName:          e.Nginx.IngressName,
+			XOriginalURI:         e.Nginx.XOriginalURI,
+			UpstreamURI:          e.Nginx.UpstreamURI,
+		},
+	}
+}
+
+// realismSizes returns the body sizes of cfg in the form of the realism
+// invariants.
+func realismSizes(cfg config) (map[int]realism.SizeRange, error) {
+	sizes, err := parseBodySizes(cfg.BytesSentProfile)
+	if err != nil {
+		return nil, err
+	}
+	ranges := make(map[int]realism.SizeRange, len(sizes))
+	for code, r := range sizes {
+		ranges[code] = realism.SizeRange{Min: r.min, Max: r.max}
+	}
+	return ranges, nil
+}
+
+// checkVariations are the optional features -vary turns on at random, so
+// that invariants are checked across combinations of them.
+var checkVariations = []struct {
+	name  string
+	apply func(cfg *config)
+}{
+	{"UPSTREAM_FIELDS", func(cfg *config) { cfg.UpstreamFields, cfg.UpstreamRetryPercent = true, 20 }},
+	{"SSL_FIELDS", func(cfg *config) { cfg.SSLFields = true }},
+	{"HEADER_FIELDS", func(cfg *config) { cfg.HeaderFields = true }},
+	{"RESPONSE_CORRELATION", func(cfg *config) { cfg.ResponseCorrelation = true }},
+	{"HTTP_PROTOCOL_MIX", func(cfg *config) { cfg.HTTPProtocolMix = "1.0:5,1.1:45,2.0:40,3.0:10" }},
+	{"XFF_CHAIN_PERCENT", func(cfg *config) { cfg.XFFChainPercent = 50 }},
+	{"LATENCY_MEDIAN", func(cfg *config) { cfg.LatencyMedian, cfg.LatencyP99 = 0.05, 2 }},
+	{"PATH_VARIANT_PERCENT", func(cfg *config) { cfg.PathVariantPercent, cfg.PercentEncodingPercent = 20, 20 }},
+	{"HOST_MISMATCH_PERCENT", func(cfg *config) { cfg.HostMismatchPercent = 10 }},
+	{"STATUS_METHOD_RULES", func(cfg *config) { cfg.MethodPathRules, cfg.StatusMethodRules = true, true }},
+	{"REFERRER_NAVIGATION", func(cfg *config) { cfg.ReferrerNavigation = true }},
+	{"BOT_PERCENT", func(cfg *config) { cfg.BotPercent = 10 }},
+	{"ATTACK_PERCENT", func(cfg *config) { cfg.AttackPercent = 10 }},
+	{"INGRESS_REWRITES", func(cfg *config) { cfg.IngressRewrites = "api:/api(/|$)(.*)=/$2,app:/(.*)=/app/$1" }},
+}
+
+// runCheck generates entries from several random streams and reports the
+// entries breaking an invariant or failing to parse back from an output
+// format, and mixes whose observed shares stray from their weights. With
+// -fuzz, each entry is also checked with hostile strings in its free-text
+// fields. It fails when anything is reported.
+func runCheck(cfg config, args []string) error {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	n := fs.Int("n", 10000, "entries per stream")
+	streams := fs.Int("streams", 10, "random streams to check, each from its own seed")
+	vary := fs.Bool("vary", false, "turn optional features on at random for each stream")
+	fuzz := fs.Bool("fuzz", false, "also round-trip a copy of each entry with random hostile text fields")
+	fs.Parse(args)
+
+	failed, formats := false, 0
+	rnd := rand.New(rand.NewSource(rngSeed))
+	for i := range *streams {
+		streamCfg := cfg
+		streamCfg.RNGStream = strings.TrimPrefix(fmt.Sprintf("%s/check-%d", cfg.RNGStream, i), "/")
+		var features []string
+		if *vary {
+			for _, v := range checkVariations {
+				if rnd.Intn(2) == 0 {
+					v.apply(&streamCfg)
+					features = append(features, v.name)
+				}
+			}
+		}
+		label := "stream " + streamCfg.RNGStream
+		if len(features) > 0 {
+			label += " with " + strings.Join(features, ", ")
+		}
+
+		entries, _, err := sample(streamCfg, *n)
+		if err != nil {
+			return fmt.Errorf("%s: %w", label, err)
+		}
+		sizes, err := realismSizes(streamCfg)
+		if err != nil {
+			return err
+		}
+		trips, err := formatRoundTrips(streamCfg)
+		if err != nil {
+			return fmt.Errorf("%s: %w", label, err)
+		}
+		formats = len(trips)
+		report := func(what string, entries []logEntry, check func(e *logEntry) string) {
+			var broken int
+			var example string
+			for j := range entries {
+				if why := check(&entries[j]); why != "" {
+					if broken == 0 {
+						example = fmt.Sprintf("%s: %s", entries[j].HTTP.RequestID, why)
+					}
+					broken++
+				}
+			}
+			if broken > 0 {
+				failed = true
+				fmt.Fprintf(os.Stdout, "FAIL %s: %s broken by %d of %d entries, e.g. %s\n", label, what, broken, len(entries), example)
+			}
+		}
+		for _, inv := range realism.Invariants {
+			report(inv.Name, entries, func(e *logEntry) string { return inv.Check(realismEntry(e), sizes) })
+		}
+		for _, t := range trips {
+			report(t.name+" round trip", entries, func(e *logEntry) string { return t.check(e) })
+		}
+		if *fuzz {
+			fuzzed := make([]logEntry, len(entries))
+			for j, e := range entries {
+				fuzzed[j] = fuzzEntry(rnd, e)
+			}
+			for _, t := range trips {
+				report(t.name+" round trip of fuzzed entries", fuzzed, func(e *logEntry) string { return t.check(e) })
+			}
+		}
+		for _, msg := range checkMixes(streamCfg, entries) {
+			failed = true
+			fmt.Fprintf(os.Stdout, "FAIL %s: %s\n", label, msg)
+		}
+	}
+	if failed {
+		return fmt.Errorf("check failed")
+	}
+	fmt.Fprintf(os.Stdout, "ok: %d streams of %d entries keep %d invariants and %d format round trips\n", *streams, *n, len(realism.Invariants), formats)
+	return nil
+}
+
+// checkMixes compares the shares of HTTP versions and, when the weights
+// are all that sets statuses, of status codes with their configured
+// weights. A share may stray by 5 standard errors, so a correct generator
+// practically never fails.
+func checkMixes(cfg config, entries []logEntry) []string {
+	var msgs []string
+	compare := func(setting string, want *weighted[string], value func(e *logEntry) string) {
+		got := map[string]int{}
+		for i := range entries {
+			got[value(&entries[i])]++
+		}
+		n := float64(len(entries))
+		for i, v := range want.values {
+			if v == "" {
+				continue
+			}
+			p := want.weight(i) / want.total()
+			share := float64(got[v]) / n
+			if tolerance := 5*math.Sqrt(p*(1-p)/n) + 0.5/n; math.Abs(share-p) > tolerance {
+				msgs = append(msgs, fmt.Sprintf("%s: %s makes %.2f%% of entries, want %.2f%%", setting, v, share*100, p*100))
+			}
+		}
+	}
+
+	if mix, err := parseProtocolMix(cfg.HTTPProtocolMix); err == nil && mix != nil {
+		compare("HTTP_PROTOCOL_MIX", mix, func(e *logEntry) string { return e.HTTP.Protocol })
+	}
+	// Other settings that change statuses would skew the shares
+	if weights, err := parseCodeWeights(cfg.StatusWeights, "STATUS_WEIGHTS"); err == nil && weights != nil &&
+		cfg.StatusCodes == "" && !cfg.StatusMethodRules && cfg.CanaryPercent == 0 && cfg.Spikes == "" {
+		want := &weighted[string]{}
+		for i, code := range weights.values {
+			want.add(strconv.Itoa(code), weights.weight(i))
+		}
+		compare("STATUS_WEIGHTS", want, func(e *logEntry) string { return strconv.Itoa(e.HTTP.StatusCode) })
+	}
+	return msgs
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"testing"
+	"testing/quick"
+
+	"github.com/patsevanton/nginx-log-generator/realism"
+)
+
+// testConfig returns the configuration of a generator with a few clients,
+// hosts, paths and statuses, changed by settings; an empty value unsets a
+// variable.
+func testConfig(t testing.TB, settings map[string]string) config {
+	t.Helper()
+	environ := map[string]string{
+		"IP_ADDRESSES": "203.0.113.7,198.51.100.23,2001:db8::1",
+		"HTTP_METHODS": "GET,POST,PUT",
+		"PATHS":        "/,/api/users,/api/orders/42,/static/app.js,/login",
+		"STATUS_CODES": "200,301,404,500",
+		"HOSTS":        "example.com,shop.example.com",
+	}
+	maps.Copy(environ, settings)
+	maps.DeleteFunc(environ, func(_, v string) bool { return v == "" })
+	cfg, err := parseConfig(environ)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+// Every stream, with any combination of the optional features check -vary
+// turns on, keeps the realism invariants.
+func TestGeneratedEntriesKeepInvariants(t *testing.T) {
+	base := testConfig(t, nil)
+	sizes, err := realismSizes(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	property := func(stream uint16, features uint32) bool {
+		cfg := base
+		cfg.RNGStream = fmt.Sprintf("test-%d", stream)
+		var names []string
+		for i, v := range checkVariations {
+			if features&(1<<i) != 0 {
+				v.apply(&cfg)
+				names = append(names, v.name)
+			}
+		}
+		entries, _, err := sample(cfg, 300)
+		if err != nil {
+			t.Errorf("stream %s with %v: %v", cfg.RNGStream, names, err)
+			return false
+		}
+		for i := range entries {
+			if v := realism.Check(realismEntry(&entries[i]), sizes); v != nil {
+				t.Errorf("stream %s with %v: entry %s breaks %s", cfg.RNGStream, names, entries[i].HTTP.RequestID, v[0])
+				return false
+			}
+		}
+		return true
+	}
+	if err := quick.Check(property, &quick.Config{MaxCount: 40}); err != nil {
+		t.Error(err)
+	}
+}
+
+// Observed shares of HTTP versions and statuses stay within the tolerance
+// of their weights.
+func TestMixesFollowWeights(t *testing.T) {
+	cfg := testConfig(t, map[string]string{
+		"STATUS_CODES":      "",
+		"STATUS_WEIGHTS":    "200:70,301:5,404:15,500:9.5,503:0.5",
+		"HTTP_PROTOCOL_MIX": "1.0:5,1.1:45,2.0:40,3.0:10",
+		"RNG_STREAM":        "mixes",
+	})
+	entries, _, err := sample(cfg, 20000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range checkMixes(cfg, entries) {
+		t.Error(msg)
+	}
+}
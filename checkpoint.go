@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// checkpoint records how far a backfill got, together with everything
+// needed to continue it exactly as an uninterrupted run would have.
+type checkpoint struct {
+	// From identifies the backfill; To is resolved once, so a range that
+	// ends "now" keeps its original end when resumed
+	From string    `json:"from"`
+	To   time.Time `json:"to"`
+
+	Seed int64  `json:"seed"`
+	RNG  []byte `json:"rng"`
+	// State of the ARRIVAL=poisson gaps
+	Arrivals []byte    `json:"arrivals,omitempty"`
+	Next     time.Time `json:"next"`
+	Entries  uint64    `json:"entries"`
+
+	// Generator state that depends on earlier entries
+	Start    time.Time         `json:"start"`
+	Marked   map[string]bool   `json:"marked,omitempty"`
+	LastPage map[string]string `json:"last_page,omitempty"`
+	Pools    map[string]pooled `json:"pools,omitempty"`
+	Sessions []*session        `json:"sessions,omitempty"`
+}
+
+// pooled is the saved state of a CARDINALITY_LIMITS value pool.
+type pooled struct {
+	Start  time.Time `json:"start"`
+	Values []string  `json:"values"`
+}
+
+// loadCheckpoint reads the checkpoint at path, returning nil if there is none.
+func loadCheckpoint(path string) (*checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	ck := &checkpoint{}
+	if err := json.Unmarshal(data, ck); err != nil {
+		return nil, fmt.Errorf("reading checkpoint %s: %w", path, err)
+	}
+	return ck, nil
+}
+
+// saveCheckpoint flushes the sinks, so that everything generated before next
+// is delivered, then atomically replaces the checkpoint file.
+func (r *runner) saveCheckpoint(to, next time.Time) error {
+	for _, s := range []sink{r.accessSink, r.errorSink} {
+		if err := flushSink(s); err != nil {
+			return err
+		}
+	}
+	state, err := r.gen.src.state()
+	if err != nil {
+		return err
+	}
+	var arrivals []byte
+	if r.arrivalSrc != nil {
+		if arrivals, err = r.arrivalSrc.state(); err != nil {
+			return err
+		}
+	}
+	pools := map[string]pooled{}
+	for field, p := range r.gen.cardinality {
+		pools[field] = pooled{p.start, p.values}
+	}
+	var sessions []*session
+	if r.gen.sessions != nil {
+		sessions = r.gen.sessions.active
+	}
+	data, err := json.Marshal(checkpoint{
+		From:     r.cfg.BackfillFrom,
+		To:       to,
+		Seed:     rngSeed,
+		RNG:      state,
+		Arrivals: arrivals,
+		Next:     next,
+		Entries:  r.entries.Load(),
+		Start:    r.gen.start,
+		Marked:   r.gen.events.marked,
+		LastPage: r.gen.lastPage,
+		Pools:    pools,
+		Sessions: sessions,
+	})
+	if err != nil {
+		return err
+	}
+	tmp := r.cfg.CheckpointFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.cfg.CheckpointFile)
+}
+
+// resume restores the state saved in ck and returns the range left to
+// generate.
+func (r *runner) resume(ck *checkpoint) (time.Time, time.Time, error) {
+	if ck.From != r.cfg.BackfillFrom {
+		return time.Time{}, time.Time{}, fmt.Errorf("checkpoint %s belongs to a backfill from %s, remove it to start over", r.cfg.CheckpointFile, ck.From)
+	}
+	if err := r.gen.src.restore(ck.RNG); err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("restoring checkpoint: %w", err)
+	}
+	if r.arrivalSrc != nil && ck.Arrivals != nil {
+		if err := r.arrivalSrc.restore(ck.Arrivals); err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("restoring checkpoint: %w", err)
+		}
+	}
+	r.entries.Store(ck.Entries)
+	r.gen.start = ck.Start
+	if ck.Marked != nil {
+		r.gen.events.marked = ck.Marked
+	}
+	if ck.LastPage != nil {
+		r.gen.lastPage = ck.LastPage
+	}
+	if r.gen.sessions != nil {
+		r.gen.sessions.active = ck.Sessions
+	}
+	for field, saved := range ck.Pools {
+		if p := r.gen.cardinality[field]; p != nil {
+			p.start, p.values = saved.Start, saved.Values
+			for _, v := range saved.Values {
+				p.seen[v] = true
+			}
+		}
+	}
+	return ck.Next.In(r.clk.loc), ck.To.In(r.clk.loc), nil
+}
+
+// seedFor returns the seed a run has to use: the one of the checkpoint it
+// resumes, if any, and SEED otherwise.
+func seedFor(cfg config) (int64, error) {
+	if cfg.CheckpointFile == "" || cfg.BackfillFrom == "" {
+		return cfg.Seed, nil
+	}
+	ck, err := loadCheckpoint(cfg.CheckpointFile)
+	if err != nil || ck == nil {
+		return cfg.Seed, err
+	}
+	return ck.Seed, nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var chromiumVersion = regexp.MustCompile(`(Chrome|Edg|OPR)/(\d+)`)
+
+// clientHints derives the sec-ch-ua, sec-ch-ua-platform and
+// sec-ch-ua-mobile request headers a browser with the given User-Agent would
+// send. Only Chromium-based browsers send client hints; for everything else,
+// and for Chromium on iOS, all three values are empty.
+func clientHints(userAgent string) (ua, platform, mobile string) {
+	matches := chromiumVersion.FindAllStringSubmatch(userAgent, -1)
+	if len(matches) == 0 || strings.Contains(userAgent, "iPhone") || strings.Contains(userAgent, "iPad") {
+		return "", "", ""
+	}
+
+	brand, version := "Google Chrome", ""
+	for _, m := range matches {
+		switch m[1] {
+		case "Chrome":
+			version = m[2]
+		case "Edg":
+			brand = "Microsoft Edge"
+		case "OPR":
+			brand = "Opera"
+		}
+	}
+	if version == "" {
+		version = matches[0][2]
+	}
+	ua = fmt.Sprintf(`"Chromium";v="%s", "%s";v="%s", "Not-A.Brand";v="99"`, version, brand, version)
+
+	switch {
+	case strings.Contains(userAgent, "Android"):
+		platform = `"Android"`
+	case strings.Contains(userAgent, "Windows"):
+		platform = `"Windows"`
+	case strings.Contains(userAgent, "Macintosh"):
+		platform = `"macOS"`
+	case strings.Contains(userAgent, "CrOS"):
+		platform = `"Chrome OS"`
+	case strings.Contains(userAgent, "Linux"):
+		platform = `"Linux"`
+	default:
+		platform = `"Unknown"`
+	}
+
+	mobile = "?0"
+	if strings.Contains(userAgent, "Mobile") {
+		mobile = "?1"
+	}
+	return ua, platform, mobile
+}
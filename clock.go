@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// clock supplies entry timestamps. By default it follows the wall clock; it
+// can be shifted to just before a calendar boundary so that the boundary is
+// crossed within the first minutes of a run, and run faster than the wall
+// clock with TIME_SCALE.
+type clock struct {
+	offset time.Duration
+	loc    *time.Location
+	// start is when the clock was created; simulated time runs scale times
+	// as fast from there
+	start time.Time
+	scale float64
+}
+
+func newClock(cfg config) (*clock, error) {
+	loc := time.Local
+	if cfg.Timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(cfg.Timezone); err != nil {
+			return nil, fmt.Errorf("loading TIMEZONE: %w", err)
+		}
+	}
+	if cfg.TimeScale <= 0 {
+		return nil, fmt.Errorf("TIME_SCALE must be positive, got %g", cfg.TimeScale)
+	}
+	c := &clock{loc: loc, start: time.Now(), scale: cfg.TimeScale}
+
+	if cfg.TimeBoundary != "" {
+		now := c.start.In(loc)
+		boundary, err := nextBoundary(cfg.TimeBoundary, now)
+		if err != nil {
+			return nil, err
+		}
+		c.offset = boundary.Add(-cfg.BoundaryLead).Sub(now)
+	}
+	return c, nil
+}
+
+func (c *clock) now() time.Time {
+	now := time.Now()
+	if c.scale != 1 {
+		now = c.start.Add(time.Duration(float64(now.Sub(c.start)) * c.scale))
+	}
+	return now.Add(c.offset).In(c.loc)
+}
+
+// nextBoundary returns the next instant after now at which the given kind
+// of calendar boundary occurs in now's location.
+func nextBoundary(kind string, now time.Time) (time.Time, error) {
+	loc := now.Location()
+	switch kind {
+	case "dst":
+		return nextOffsetChange(now)
+	case "month-end":
+		return time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, loc), nil
+	case "year-end":
+		return time.Date(now.Year()+1, time.January, 1, 0, 0, 0, 0, loc), nil
+	case "leap-day":
+		for year := now.Year(); ; year++ {
+			// time.Date normalizes Feb 29 of common years to Mar 1
+			if d := time.Date(year, time.February, 29, 0, 0, 0, 0, loc); d.Month() == time.February && d.After(now) {
+				return d, nil
+			}
+		}
+	default:
+		return time.Time{}, fmt.Errorf("unknown TIME_BOUNDARY %q (want dst, month-end, year-end or leap-day)", kind)
+	}
+}
+
+// nextOffsetChange finds the next UTC offset change (DST transition) of
+// now's location within two years, to the second.
+func nextOffsetChange(now time.Time) (time.Time, error) {
+	_, offset := now.Zone()
+	lo := now
+	for hi := now.Add(time.Hour); hi.Before(now.AddDate(2, 0, 0)); lo, hi = hi, hi.Add(time.Hour) {
+		if _, o := hi.Zone(); o == offset {
+			continue
+		}
+		for hi.Sub(lo) > time.Second {
+			mid := lo.Add(hi.Sub(lo) / 2)
+			if _, o := mid.Zone(); o == offset {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+		return hi.Truncate(time.Second), nil
+	}
+	return time.Time{}, fmt.Errorf("time zone %s has no DST transition in the next two years", now.Location())
+}
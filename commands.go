@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// command is a utility selected by the first command-line argument. Commands
+// read the same environment as the generator, so their output matches what
+// a run with that configuration would produce.
+type command struct {
+	summary string
+	run     func(cfg config, args []string) error
+}
+
+var commands = map[string]command{
+	"check":            {"verify realism invariants and weighted mixes of generated entries", runCheck},
+	"docs":             {"print a reference of all environment variables", runDocs},
+	"export-config":    {"print the effective configuration as KEY=value lines", runExportConfig},
+	"export-dashboard": {"print a Grafana dashboard for the generated fields", runExportDashboard},
+	"probe-verify":     {"measure ingestion latency of probe entries in a log backend", runProbeVerify},
+	"learn":            {"derive a traffic profile for CONFIG_FILE from an access log", runLearn},
+	"print-parser":     {"print a Fluent Bit parser or Logstash filter for the output format", runPrintParser},
+	"vector-tests":     {"write Vector unit tests for the configured output format", runVectorTests},
+}
+
+// runCommand runs the named command with the remaining arguments.
+func runCommand(cfg config, name string, args []string) error {
+	cmd, ok := commands[name]
+	if !ok {
+		names := make([]string, 0, len(commands))
+		for n := range commands {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown command %q (want one of: %s)", name, strings.Join(names, ", "))
+	}
+	return cmd.run(cfg, args)
+}
+
+// sample generates n entries spaced as live mode would space them, together
+// with their rendered lines.
+func sample(cfg config, n int) ([]logEntry, [][]byte, error) {
+	gen, err := newGenerator(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	format, err := newFormatter(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	clk, err := newClock(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r := &runner{cfg: cfg, gen: gen}
+	entries := make([]logEntry, n)
+	lines := make([][]byte, n)
+	t := clk.now()
+	for i := range entries {
+		entries[i] = gen.next(t)
+		if lines[i], err = format(&entries[i]); err != nil {
+			return nil, nil, err
+		}
+		t = t.Add(r.interval(t))
+	}
+	return entries, lines, nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/caarlos0/env/v6"
+)
+
+// namedSink is one of the sinks compared in COMPARE_SINKS mode.
+type namedSink struct {
+	name string
+	sink sink
+}
+
+// compareSink sends every record to several sinks, so that competing
+// backends receive identical streams. Access entries are rendered once per
+// sink with the sink's name in the "sink" field; other lines are passed on
+// unchanged.
+type compareSink struct {
+	sinks  []namedSink
+	format formatter
+}
+
+// newCompareSink creates the sinks listed in COMPARE_SINKS. Each reads the
+// environment overlaid with its COMPARE_<NAME>_* variables, so
+// COMPARE_LOKI_SINK=http and COMPARE_LOKI_HTTP_URL=... configure "loki".
+func newCompareSink(cfg config, format formatter) (*compareSink, error) {
+	base := cfg.environ
+	if base == nil {
+		base = environMap()
+	}
+	s := &compareSink{format: format}
+	for _, name := range parseEnvList(cfg.CompareSinks) {
+		name = strings.TrimSpace(name)
+		var sc struct {
+			Sink     string `env:"SINK" envDefault:"stdout"`
+			Sinks    sinkConfig
+			Pipeline string `env:"PIPELINE" envDefault:""`
+		}
+		environ := overlay(base, "COMPARE_"+envName(name)+"_")
+		if err := env.Parse(&sc, env.Options{Environment: environ}); err != nil {
+			return nil, fmt.Errorf("sink %s: %w", name, err)
+		}
+		named, err := newSink(sc.Sink, sc.Sinks)
+		if err == nil && sc.Pipeline != "" {
+			named, err = newPipelineSink(named, sc.Pipeline, environ, format)
+		}
+		if err != nil {
+			s.Close()
+			return nil, fmt.Errorf("sink %s: %w", name, err)
+		}
+		s.sinks = append(s.sinks, namedSink{name, named})
+	}
+	if len(s.sinks) < 2 {
+		return nil, errors.New("COMPARE_SINKS must name at least two sinks")
+	}
+	return s, nil
+}
+
+func (s *compareSink) Send(r record) error {
+	for _, ns := range s.sinks {
+		tagged := r
+		if r.Entry != nil {
+			e := *r.Entry
+			e.Sink = ns.name
+			line, err := s.format(&e)
+			if err != nil {
+				return err
+			}
+			tagged.Entry, tagged.Line = &e, line
+		}
+		if err := ns.sink.Send(tagged); err != nil {
+			return fmt.Errorf("sink %s: %w", ns.name, err)
+		}
+	}
+	return nil
+}
+
+func (s *compareSink) Flush() error {
+	var errs []error
+	for _, ns := range s.sinks {
+		if err := flushSink(ns.sink); err != nil {
+			errs = append(errs, fmt.Errorf("sink %s: %w", ns.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *compareSink) Close() error {
+	var errs []error
+	for _, ns := range s.sinks {
+		if err := ns.sink.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("sink %s: %w", ns.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// secretVariables are left out of exported configurations, which are meant
+// to be shared, including their INSTANCE_* and COMPARE_* forms.
+var secretVariables = []string{"OAUTH2_CLIENT_SECRET", "ES_PASSWORD", "ES_API_KEY", "HTTP_HEADERS", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "INFLUX_TOKEN", "HONEYCOMB_API_KEY", "OPENOBSERVE_PASSWORD", "PAGERDUTY_ROUTING_KEY", "RUN_WEBHOOK_URL"}
+
+func isSecret(name string) bool {
+	for _, secret := range secretVariables {
+		if name == secret || strings.HasSuffix(name, "_"+secret) {
+			return true
+		}
+	}
+	return false
+}
+
+// processEnviron returns the process environment on top of CONFIG_FILE, if
+// one is set.
+func processEnviron() (map[string]string, error) {
+	environ := environMap()
+	path := environ["CONFIG_FILE"]
+	if path == "" {
+		return environ, nil
+	}
+	file, err := readConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range environ {
+		file[k] = v
+	}
+	return file, nil
+}
+
+// readConfigFile reads KEY=value lines as written by EXPORT_CONFIG, which is
+// also the format of docker --env-file. Blank lines and # comments are
+// skipped; values are taken literally, without unquoting.
+func readConfigFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading CONFIG_FILE: %w", err)
+	}
+	defer f.Close()
+
+	vars := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		k, v, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: want KEY=value", path, n)
+		}
+		vars[k] = v
+	}
+	return vars, scanner.Err()
+}
+
+// writeConfig writes the effective configuration as KEY=value lines: every
+// setting with its resolved value, presets expanded and defaults filled in,
+// plus the INSTANCE_* and COMPARE_* variables. A random seed is replaced by
+// the one actually drawn, so the file reproduces the run.
+func writeConfig(w io.Writer, cfg config) error {
+	vars := map[string]string{}
+	if err := configVariables(reflect.ValueOf(cfg), vars); err != nil {
+		return err
+	}
+	environ := cfg.environ
+	if environ == nil {
+		environ = environMap()
+	}
+	for k, v := range environ {
+		if strings.HasPrefix(k, "INSTANCE_") || strings.HasPrefix(k, "COMPARE_") {
+			vars[k] = v
+		}
+	}
+	if cfg.Seed == 0 && cfg.RNGBackend != "crypto" {
+		vars["SEED"] = strconv.FormatInt(rngSeed, 10)
+	}
+	for _, k := range []string{"CONFIG_FILE", "EXPORT_CONFIG", "PROFILE"} {
+		delete(vars, k)
+	}
+
+	names := make([]string, 0, len(vars))
+	for k := range vars {
+		if isSecret(k) {
+			continue
+		}
+		if strings.ContainsAny(vars[k], "\r\n") {
+			return fmt.Errorf("%s contains a line break and cannot be exported", k)
+		}
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		if _, err := fmt.Fprintf(w, "%s=%s\n", k, vars[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// configVariables collects the fields of a configuration struct with an env
+// tag, descending into nested structs such as sinkConfig.
+func configVariables(v reflect.Value, vars map[string]string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field, value := t.Field(i), v.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := field.Tag.Get("env")
+		if name == "" {
+			if value.Kind() == reflect.Struct {
+				if err := configVariables(value, vars); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		switch x := value.Interface().(type) {
+		case time.Duration:
+			vars[name] = x.String()
+		case string:
+			vars[name] = x
+		case bool:
+			vars[name] = strconv.FormatBool(x)
+		case int:
+			vars[name] = strconv.Itoa(x)
+		case int64:
+			vars[name] = strconv.FormatInt(x, 10)
+		case float32:
+			vars[name] = strconv.FormatFloat(float64(x), 'g', -1, 32)
+		case float64:
+			vars[name] = strconv.FormatFloat(x, 'g', -1, 64)
+		case eventRate:
+			vars[name] = strconv.FormatFloat(float64(x), 'g', -1, 64)
+		default:
+			return fmt.Errorf("cannot export %s of type %T", name, x)
+		}
+	}
+	return nil
+}
+
+// exportConfig writes the effective configuration to EXPORT_CONFIG.
+func exportConfig(cfg config) error {
+	f, err := os.Create(cfg.ExportConfig)
+	if err != nil {
+		return err
+	}
+	if err := writeConfig(f, cfg); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func runExportConfig(cfg config, args []string) error {
+	fs := flag.NewFlagSet("export-config", flag.ExitOnError)
+	out := fs.String("out", "-", "file to write, - for stdout")
+	fs.Parse(args)
+	if *out == "-" {
+		return writeConfig(os.Stdout, cfg)
+	}
+	cfg.ExportConfig = *out
+	return exportConfig(cfg)
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// control holds adjustments made while the generator runs, through the
+// interactive console. The zero value changes nothing.
+type control struct {
+	mu sync.Mutex
+
+	rate float64 // replaces RATE when positive
+
+	spikeFactor float64
+	spikeUntil  time.Time
+
+	injectCode    int
+	injectPercent float64
+	injectUntil   time.Time
+
+	// changed wakes the live loop so rate changes apply immediately
+	changed chan struct{}
+}
+
+func (c *control) notify() {
+	select {
+	case c.changed <- struct{}{}:
+	default:
+	}
+}
+
+// rateFactor returns the multiplier of the base rate active right now.
+func (c *control) rateFactor() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Now().Before(c.spikeUntil) {
+		return c.spikeFactor
+	}
+	return 1
+}
+
+// baseRate returns the rate set from the console, or the one that meets
+// TARGET_VOLUME, or the RAMP_* rate at t, or RATE.
+func (r *runner) baseRate(t time.Time) float64 {
+	r.ctl.mu.Lock()
+	rate := r.ctl.rate
+	r.ctl.mu.Unlock()
+	switch {
+	case rate > 0:
+		return rate
+	case r.volume != nil:
+		return r.volume.rate(float64(r.cfg.Rate))
+	case r.ramp != nil:
+		return r.ramp.rate(t)
+	default:
+		return float64(r.cfg.Rate)
+	}
+}
+
+// injectedStatus returns the status code to force on the next entry, or 0.
+// It draws from rng, the stream of the generator rendering the entry, only
+// while an injection is running.
+func (c *control) injectedStatus(rng *rand.Rand) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Now().Before(c.injectUntil) && rng.Float64()*100 < c.injectPercent {
+		return c.injectCode
+	}
+	return 0
+}
+
+// console reads commands from in and applies them to every runner, writing
+// replies to out. It returns when in is exhausted.
+func console(in io.Reader, out io.Writer, runners []*runner) {
+	scanner := bufio.NewScanner(in)
+	fmt.Fprintln(out, `console ready, type "help" for commands`)
+	for scanner.Scan() {
+		args := strings.Fields(scanner.Text())
+		if len(args) == 0 {
+			continue
+		}
+		reply, err := consoleCommand(args, runners)
+		if err != nil {
+			fmt.Fprintln(out, "error:", err)
+			continue
+		}
+		fmt.Fprintln(out, reply)
+	}
+}
+
+const consoleHelp = `commands:
+  rate N                   set the base rate to N entries per second
+  spike Nx DURATION        multiply the rate by N for DURATION, e.g. spike 10x 30s
+  inject CODE P% DURATION  answer P% of requests with CODE, e.g. inject 502 5% 2m
+  reset                    undo rate, spike and inject
+  status                   show the current adjustments`
+
+func consoleCommand(args []string, runners []*runner) (string, error) {
+	apply := func(f func(c *control)) {
+		for _, r := range runners {
+			r.ctl.mu.Lock()
+			f(&r.ctl)
+			r.ctl.mu.Unlock()
+			r.ctl.notify()
+		}
+	}
+
+	switch args[0] {
+	case "help":
+		return consoleHelp, nil
+	case "rate":
+		if len(args) != 2 {
+			return "", fmt.Errorf("usage: rate N")
+		}
+		rate, err := strconv.ParseFloat(args[1], 64)
+		if err != nil || rate <= 0 {
+			return "", fmt.Errorf("invalid rate %q", args[1])
+		}
+		apply(func(c *control) { c.rate = rate })
+		return fmt.Sprintf("rate set to %g/s", rate), nil
+	case "spike":
+		if len(args) != 3 {
+			return "", fmt.Errorf("usage: spike Nx DURATION")
+		}
+		factor, err := strconv.ParseFloat(strings.TrimSuffix(args[1], "x"), 64)
+		if err != nil || factor <= 0 {
+			return "", fmt.Errorf("invalid factor %q", args[1])
+		}
+		d, err := time.ParseDuration(args[2])
+		if err != nil {
+			return "", err
+		}
+		until := time.Now().Add(d)
+		apply(func(c *control) { c.spikeFactor, c.spikeUntil = factor, until })
+		return fmt.Sprintf("rate x%g until %s", factor, until.Format(time.TimeOnly)), nil
+	case "inject":
+		if len(args) != 4 {
+			return "", fmt.Errorf("usage: inject CODE P%% DURATION")
+		}
+		code, err := strconv.Atoi(args[1])
+		if err != nil || code < 100 || code > 599 {
+			return "", fmt.Errorf("invalid status code %q", args[1])
+		}
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(args[2], "%"), 64)
+		if err != nil || percent < 0 || percent > 100 {
+			return "", fmt.Errorf("invalid percentage %q", args[2])
+		}
+		d, err := time.ParseDuration(args[3])
+		if err != nil {
+			return "", err
+		}
+		until := time.Now().Add(d)
+		apply(func(c *control) { c.injectCode, c.injectPercent, c.injectUntil = code, percent, until })
+		return fmt.Sprintf("%g%% of requests answered with %d until %s", percent, code, until.Format(time.TimeOnly)), nil
+	case "reset":
+		apply(func(c *control) {
+			c.rate, c.spikeUntil, c.injectUntil = 0, time.Time{}, time.Time{}
+		})
+		return "adjustments cleared", nil
+	case "status":
+		var b strings.Builder
+		for i, r := range runners {
+			if i > 0 {
+				b.WriteByte('\n')
+			}
+			if r.name != "" {
+				b.WriteString(r.name + ": ")
+			}
+			fmt.Fprintf(&b, "rate %g/s", r.baseRate(r.clk.now())*r.ctl.rateFactor())
+			r.ctl.mu.Lock()
+			if time.Now().Before(r.ctl.injectUntil) {
+				fmt.Fprintf(&b, ", injecting %d into %g%% until %s", r.ctl.injectCode, r.ctl.injectPercent, r.ctl.injectUntil.Format(time.TimeOnly))
+			}
+			r.ctl.mu.Unlock()
+		}
+		return b.String(), nil
+	default:
+		return "", fmt.Errorf("unknown command %q, try help", args[0])
+	}
+}
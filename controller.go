@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// controllerPID is the PID ingress-nginx-controller usually runs under inside
+// its container; klog prints it in every line header.
+const controllerPID = 7
+
+// controllerReloadEvent returns the klog lines the ingress-nginx controller
+// writes to stdout when it detects a configuration change and reloads nginx.
+// The returned lines are meant to be interleaved with access log lines.
+func controllerReloadEvent(rnd *rand.Rand, now time.Time, failurePercent float64) []string {
+	lines := []string{
+		klogLine('I', now, "controller.go:190", `"Configuration changes detected, backend reload required"`),
+	}
+
+	reloadAt := now.Add(time.Duration(rnd.Intn(400)+50) * time.Millisecond)
+	if rnd.Float64()*100 < failurePercent {
+		lines = append(lines, klogLine('E', reloadAt, "controller.go:205",
+			`"Unexpected failure reloading the backend" err="exit status 1\n`+
+				reloadAt.Format("2006/01/02 15:04:05")+
+				` [emerg] 31#31: invalid number of arguments in \"proxy_set_header\" directive in /tmp/nginx/nginx-cfg1234:812\nnginx: configuration file /tmp/nginx/nginx-cfg1234 test failed\n"`))
+		lines = append(lines, klogLine('W', reloadAt, "queue.go:130", `"requeuing" key="ingress-nginx/ingress-nginx-controller" err="exit status 1"`))
+		return lines
+	}
+
+	lines = append(lines,
+		klogLine('I', reloadAt, "controller.go:210", `"Backend successfully reloaded"`),
+		klogLine('I', reloadAt, "event.go:364",
+			`Event(v1.ObjectReference{Kind:"Pod", Namespace:"ingress-nginx", Name:"ingress-nginx-controller", APIVersion:"v1"}): type: 'Normal' reason: 'RELOAD' NGINX reload triggered due to a change in configuration`),
+	)
+	return lines
+}
+
+// klogLine formats a single line in the klog header format:
+// Lmmdd hh:mm:ss.uuuuuu threadid file:line] msg
+func klogLine(severity byte, t time.Time, source, msg string) string {
+	return fmt.Sprintf("%c%s %7d %s] %s", severity, t.Format("0102 15:04:05.000000"), controllerPID, source, msg)
+}
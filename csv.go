@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// csvColumns are the columns of OUTPUT_FORMAT=csv, in order.
+var csvColumns = []struct {
+	name  string
+	value func(e *logEntry) string
+}{
+	{"ts", func(e *logEntry) string { return e.Timestamp.Format(time.RFC3339Nano) }},
+	{"remote_addr", func(e *logEntry) string { return e.Nginx.RemoteAddr }},
+	{"remote_user", func(e *logEntry) string { return e.Nginx.RemoteUser }},
+	{"request_id", func(e *logEntry) string { return e.HTTP.RequestID }},
+	{"method", func(e *logEntry) string { return e.HTTP.Method }},
+	{"host", func(e *logEntry) string { return e.HTTP.Host }},
+	{"uri", func(e *logEntry) string { return e.HTTP.URI }},
+	{"protocol", func(e *logEntry) string { return e.HTTP.Protocol }},
+	{"status", func(e *logEntry) string { return strconv.Itoa(e.HTTP.StatusCode) }},
+	{"bytes_sent", func(e *logEntry) string { return e.HTTP.BytesSent }},
+	{"request_time", func(e *logEntry) string { return strconv.FormatFloat(float64(e.HTTP.RequestTime), 'f', 3, 32) }},
+	{"http_referrer", func(e *logEntry) string { return e.Nginx.HTTPReferrer }},
+	{"user_agent", func(e *logEntry) string { return e.HTTP.UserAgent }},
+}
+
+// formatCSV renders an entry as an RFC 4180 record of csvColumns. Control
+// characters and backslashes become \xHH, as nginx escapes them, so that a
+// record never spans several lines.
+func formatCSV(e *logEntry) ([]byte, error) {
+	record := make([]string, len(csvColumns))
+	for i, c := range csvColumns {
+		record[i] = escapeControl(c.value(e))
+	}
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	if err := w.Write(record); err != nil {
+		return nil, err
+	}
+	w.Flush()
+	return bytes.TrimSuffix(b.Bytes(), []byte("\n")), w.Error()
+}
+
+// escapeControl escapes control characters and backslashes as \xHH, leaving
+// quotes and non-ASCII text to the format.
+func escapeControl(s string) string {
+	if !strings.ContainsFunc(s, func(r rune) bool { return r < 0x20 || r == 0x7f || r == '\\' }) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < 0x20 || c == 0x7f || c == '\\' {
+			fmt.Fprintf(&b, "\\x%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// dashboardFields maps the generator's dotted field names to how a
+// datasource refers to them after ingestion of the configured format.
+type dashboardFields struct {
+	loki      bool
+	prefix    string
+	timeField string
+}
+
+// ref returns the name of a numeric field.
+func (f dashboardFields) ref(name string) string {
+	name = f.prefix + name
+	if f.loki {
+		// Loki's json stage joins nested keys with underscores
+		return strings.NewReplacer(".", "_", "-", "_").Replace(name)
+	}
+	return name
+}
+
+// keyword returns the name of a string field usable for grouping.
+func (f dashboardFields) keyword(name string) string {
+	if f.loki {
+		return f.ref(name)
+	}
+	return f.ref(name) + ".keyword"
+}
+
+// runExportDashboard prints a Grafana dashboard whose panels query the
+// fields of the configured output format through Loki or Elasticsearch.
+func runExportDashboard(cfg config, args []string) error {
+	fs := flag.NewFlagSet("export-dashboard", flag.ExitOnError)
+	datasource := fs.String("datasource", "loki", "datasource type: loki or elasticsearch")
+	selector := fs.String("selector", `{job="nginx"}`, "Loki stream selector of the generated logs")
+	fs.Parse(args)
+
+	if err := needBuiltinFormat(cfg, "export-dashboard"); err != nil {
+		return err
+	}
+	f := dashboardFields{timeField: "ts"}
+	switch cfg.OutputFormat {
+	case "json":
+	case "winevent-json":
+		f.prefix, f.timeField = "winlog.event_data.", "@timestamp"
+	default:
+		return fmt.Errorf("export-dashboard needs a JSON output format, not %s", cfg.OutputFormat)
+	}
+
+	var pluginID string
+	var q dashboardQueries
+	switch *datasource {
+	case "loki":
+		f.loki, pluginID = true, "loki"
+		q = lokiQueries{f, *selector}
+	case "elasticsearch":
+		pluginID = "elasticsearch"
+		q = elasticQueries{f}
+	default:
+		return fmt.Errorf("unknown datasource %q (want loki or elasticsearch)", *datasource)
+	}
+
+	panels := []map[string]interface{}{
+		dashboardPanel("Requests by status", "timeseries", q.countBy("http.status_code", false)),
+		dashboardPanel("Request time p95 by host", "timeseries", q.p95By("http.request_time", "http.host")),
+		dashboardPanel("5xx responses", "timeseries", q.count("http.status_code", 500)),
+		dashboardPanel("Top URIs", "table", q.top("http.uri", 10)),
+	}
+	if cfg.Regions != "" {
+		panels = append(panels, dashboardPanel("Requests by region", "timeseries", q.countBy("kubernetes.region", true)))
+	}
+	for i, p := range panels {
+		p["id"] = i + 1
+		p["gridPos"] = map[string]int{"h": 8, "w": 12, "x": (i % 2) * 12, "y": (i / 2) * 8}
+		p["datasource"] = map[string]string{"type": pluginID, "uid": "${DS_LOGS}"}
+	}
+
+	dashboard := map[string]interface{}{
+		"__inputs": []map[string]string{{
+			"name": "DS_LOGS", "label": "Logs", "type": "datasource", "pluginId": pluginID,
+		}},
+		"title":         "nginx-log-generator",
+		"tags":          []string{"nginx"},
+		"schemaVersion": 39,
+		"time":          map[string]string{"from": "now-1h", "to": "now"},
+		"refresh":       "10s",
+		"panels":        panels,
+	}
+	out, err := json.MarshalIndent(dashboard, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(append(out, '\n'))
+	return err
+}
+
+func dashboardPanel(title, kind string, target map[string]interface{}) map[string]interface{} {
+	target["refId"] = "A"
+	return map[string]interface{}{
+		"title":   title,
+		"type":    kind,
+		"targets": []map[string]interface{}{target},
+	}
+}
+
+// dashboardQueries builds the panel targets for one datasource type.
+type dashboardQueries interface {
+	countBy(field string, isString bool) map[string]interface{}
+	p95By(value, group string) map[string]interface{}
+	count(field string, min int) map[string]interface{}
+	top(field string, n int) map[string]interface{}
+}
+
+type lokiQueries struct {
+	f        dashboardFields
+	selector string
+}
+
+func (q lokiQueries) expr(expr string) map[string]interface{} {
+	return map[string]interface{}{"expr": expr, "queryType": "range"}
+}
+
+func (q lokiQueries) countBy(field string, _ bool) map[string]interface{} {
+	return q.expr(fmt.Sprintf(`sum by (%s) (count_over_time(%s | json | __error__="" [$__auto]))`, q.f.ref(field), q.selector))
+}
+
+func (q lokiQueries) p95By(value, group string) map[string]interface{} {
+	return q.expr(fmt.Sprintf(`quantile_over_time(0.95, %s | json | unwrap %s | __error__="" [$__auto]) by (%s)`, q.selector, q.f.ref(value), q.f.ref(group)))
+}
+
+func (q lokiQueries) count(field string, min int) map[string]interface{} {
+	return q.expr(fmt.Sprintf(`sum(count_over_time(%s | json | %s >= %d [$__auto]))`, q.selector, q.f.ref(field), min))
+}
+
+func (q lokiQueries) top(field string, n int) map[string]interface{} {
+	t := q.expr(fmt.Sprintf(`topk(%d, sum by (%s) (count_over_time(%s | json | __error__="" [$__range])))`, n, q.f.ref(field), q.selector))
+	t["queryType"] = "instant"
+	return t
+}
+
+type elasticQueries struct {
+	f dashboardFields
+}
+
+func (q elasticQueries) target(query string, metric map[string]interface{}, aggs ...map[string]interface{}) map[string]interface{} {
+	metric["id"] = "1"
+	for i, agg := range aggs {
+		agg["id"] = fmt.Sprint(i + 2)
+	}
+	return map[string]interface{}{
+		"query":      query,
+		"metrics":    []map[string]interface{}{metric},
+		"bucketAggs": aggs,
+		"timeField":  q.f.timeField,
+	}
+}
+
+func (q elasticQueries) terms(field string, size int) map[string]interface{} {
+	return map[string]interface{}{"type": "terms", "field": field,
+		"settings": map[string]string{"size": fmt.Sprint(size), "order": "desc", "orderBy": "_count"}}
+}
+
+func (q elasticQueries) histogram() map[string]interface{} {
+	return map[string]interface{}{"type": "date_histogram", "field": q.f.timeField,
+		"settings": map[string]string{"interval": "auto"}}
+}
+
+func (q elasticQueries) countBy(field string, isString bool) map[string]interface{} {
+	name := q.f.ref(field)
+	if isString {
+		name = q.f.keyword(field)
+	}
+	return q.target("*", map[string]interface{}{"type": "count"}, q.terms(name, 10), q.histogram())
+}
+
+func (q elasticQueries) p95By(value, group string) map[string]interface{} {
+	metric := map[string]interface{}{"type": "percentiles", "field": q.f.ref(value),
+		"settings": map[string]interface{}{"percents": []string{"95"}}}
+	return q.target("*", metric, q.terms(q.f.keyword(group), 10), q.histogram())
+}
+
+func (q elasticQueries) count(field string, min int) map[string]interface{} {
+	return q.target(fmt.Sprintf("%s:>=%d", q.f.ref(field), min), map[string]interface{}{"type": "count"}, q.histogram())
+}
+
+func (q elasticQueries) top(field string, n int) map[string]interface{} {
+	return q.target("*", map[string]interface{}{"type": "count"}, q.terms(q.f.keyword(field), n))
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+)
+
+// dbSink batch-inserts access entries into an SQLite or Postgres table,
+// creating the table on startup if it does not exist yet. Non-access lines
+// are not stored.
+type dbSink struct {
+	*batcher
+	db     *sql.DB
+	insert string
+	// textTime stores timestamps as RFC 3339 strings for SQLite, which has
+	// no native timestamp type.
+	textTime bool
+}
+
+func newDBSink(cfg sinkConfig) (*dbSink, error) {
+	var driver, timestampType, placeholders string
+	switch cfg.DBDriver {
+	case "sqlite":
+		driver, timestampType, placeholders = "sqlite", "TEXT", "?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?"
+	case "postgres":
+		driver, timestampType, placeholders = "pgx", "TIMESTAMPTZ", "$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14"
+	default:
+		return nil, fmt.Errorf("unknown DB_DRIVER %q (want sqlite or postgres)", cfg.DBDriver)
+	}
+
+	db, err := sql.Open(driver, cfg.DBDSN)
+	if err != nil {
+		return nil, fmt.Errorf("opening database: %w", err)
+	}
+	create := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	ts %s NOT NULL,
+	request_id TEXT,
+	method TEXT,
+	status_code INTEGER,
+	url TEXT,
+	host TEXT,
+	uri TEXT,
+	request_time REAL,
+	user_agent TEXT,
+	protocol TEXT,
+	bytes_sent INTEGER,
+	remote_addr TEXT,
+	x_forward_for TEXT,
+	http_referrer TEXT
+)`, cfg.DBTable, timestampType)
+	if _, err := db.Exec(create); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("creating table %s: %w", cfg.DBTable, err)
+	}
+
+	s := &dbSink{
+		db:       db,
+		textTime: cfg.DBDriver == "sqlite",
+		insert: fmt.Sprintf(`INSERT INTO %s (ts, request_id, method, status_code, url, host, uri, request_time,
+	user_agent, protocol, bytes_sent, remote_addr, x_forward_for, http_referrer) VALUES (%s)`, cfg.DBTable, placeholders),
+	}
+	s.batcher = newBatcher(cfg.BatchSize, cfg.BatchInterval, s.write)
+	return s, nil
+}
+
+func (s *dbSink) write(records []record) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(s.insert)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	for _, r := range records {
+		e := r.Entry
+		if e == nil {
+			continue
+		}
+		bytesSent, _ := strconv.Atoi(e.HTTP.BytesSent)
+		var ts interface{} = e.Timestamp
+		if s.textTime {
+			ts = e.Timestamp.UTC().Format(time.RFC3339Nano)
+		}
+		if _, err := stmt.Exec(ts, e.HTTP.RequestID, e.HTTP.Method, e.HTTP.StatusCode, e.HTTP.URL, e.HTTP.Host,
+			e.HTTP.URI, e.HTTP.RequestTime, e.HTTP.UserAgent, e.HTTP.Protocol, bytesSent,
+			e.Nginx.RemoteAddr, e.Nginx.XForwardFor, e.Nginx.HTTPReferrer); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *dbSink) Close() error {
+	err := s.batcher.Close()
+	if cerr := s.db.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
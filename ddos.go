@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"net"
+	"time"
+)
+
+// ddos is a flood against one endpoint: from DDOS_START the rate climbs to
+// DDOS_FACTOR times over DDOS_RAMP, holds, and falls back over DDOS_RAMP
+// before DDOS_DURATION ends. The surplus requests come from a pool of
+// attacking addresses, and the more intense the flood, the more of them
+// nginx rejects with 503 (limit_req) or sees abandoned with 499.
+type ddos struct {
+	path             string
+	start, end, ramp time.Duration
+	factor           float64
+	// pool is empty for a spoofed flood, each request from a new address
+	pool []string
+}
+
+// ddosAgents are the user agents flood tools and botnets send.
+var ddosAgents = []string{
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+	"Mozilla/5.0 (Windows NT 6.1; WOW64; rv:45.0) Gecko/20100101 Firefox/45.0",
+	"Go-http-client/1.1",
+	"python-requests/2.31.0",
+	"-",
+}
+
+func newDDoS(cfg config, rng *rand.Rand) (*ddos, error) {
+	if cfg.DDoSPath == "" {
+		return nil, nil
+	}
+	switch {
+	case cfg.DDoSDuration <= 0:
+		return nil, fmt.Errorf("DDOS_DURATION must be positive, got %s", cfg.DDoSDuration)
+	case cfg.DDoSRamp < 0 || 2*cfg.DDoSRamp > cfg.DDoSDuration:
+		return nil, fmt.Errorf("DDOS_RAMP must be between 0 and half of DDOS_DURATION, got %s", cfg.DDoSRamp)
+	case cfg.DDoSFactor <= 1:
+		return nil, fmt.Errorf("DDOS_FACTOR must be greater than 1, got %g", cfg.DDoSFactor)
+	case cfg.DDoSIPs < 0:
+		return nil, fmt.Errorf("DDOS_IPS must not be negative, got %d", cfg.DDoSIPs)
+	}
+	d := &ddos{
+		path:   cfg.DDoSPath,
+		start:  cfg.DDoSStart,
+		end:    cfg.DDoSStart + cfg.DDoSDuration,
+		ramp:   cfg.DDoSRamp,
+		factor: cfg.DDoSFactor,
+	}
+	for range cfg.DDoSIPs {
+		d.pool = append(d.pool, spoofedIP(rng))
+	}
+	return d, nil
+}
+
+// rateFactor returns the multiplier of the rate at the given point of the
+// run, 1 outside the flood.
+func (d *ddos) rateFactor(elapsed time.Duration) float64 {
+	if d == nil || elapsed < d.start || elapsed >= d.end {
+		return 1
+	}
+	level := 1.0
+	if d.ramp > 0 {
+		level = min(1, float64(elapsed-d.start)/float64(d.ramp), float64(d.end-elapsed)/float64(d.ramp))
+	}
+	return 1 + (d.factor-1)*level
+}
+
+// applyDDoS turns the surplus share of requests during the flood into
+// attacking requests against DDOS_PATH.
+func (g *generator) applyDDoS(e *logEntry, elapsed time.Duration) {
+	d := g.ddos
+	if elapsed >= d.end {
+		g.markOnce(d.end, "ddos_end", map[string]interface{}{"path": d.path})
+		return
+	}
+	factor := d.rateFactor(elapsed)
+	if factor == 1 {
+		return
+	}
+	g.markOnce(d.start, "ddos_start", map[string]interface{}{"path": d.path, "factor": d.factor, "ips": len(d.pool)})
+	if g.rng.Float64() >= 1-1/factor {
+		return
+	}
+
+	ip := spoofedIP(g.rng)
+	if len(d.pool) > 0 {
+		ip = d.pool[g.rng.Intn(len(d.pool))]
+	}
+	e.Nginx.RemoteAddr, e.Nginx.XForwardFor, e.Nginx.HTTPReferrer = ip, ip, ""
+	e.HTTP.Method, e.HTTP.URI = "GET", d.path
+	e.HTTP.URL = e.HTTP.Host + d.path
+	if ua := ddosAgents[g.rng.Intn(len(ddosAgents))]; ua != "-" {
+		e.HTTP.UserAgent = ua
+	} else {
+		e.HTTP.UserAgent = ""
+	}
+
+	// At full intensity limit_req rejects most of the flood and the
+	// backend is too slow for the rest
+	intensity := (factor - 1) / (d.factor - 1)
+	switch roll := g.rng.Float64(); {
+	case roll < 0.2+0.6*intensity:
+		g.forceStatus(e, 503)
+		e.HTTP.RequestTime = float32(g.rng.Intn(3)) / 1000
+	case roll < 0.3+0.65*intensity:
+		g.forceStatus(e, 499)
+		e.HTTP.RequestTime = float32(1 + g.rng.Float64()*9)
+	default:
+		g.forceStatus(e, 200)
+	}
+}
+
+// spoofedIP returns a random address outside the private, loopback,
+// multicast and reserved ranges, as the sources of a spoofed flood look.
+func spoofedIP(rng *rand.Rand) string {
+	for {
+		ip := make(net.IP, 4)
+		binary.BigEndian.PutUint32(ip, rng.Uint32())
+		if ip[0] != 0 && ip[0] < 224 && ip[0] != 127 && !ip.IsPrivate() && !(ip[0] == 169 && ip[1] == 254) && !(ip[0] == 100 && ip[1]&0xc0 == 64) {
+			return ip.String()
+		}
+	}
+}
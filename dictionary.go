@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// dictionaryFields are the categorical fields DICTIONARIES can supply.
+var dictionaryFields = []string{"host", "path", "user_agent", "referrer", "content_type", "remote_user", "upstream"}
+
+// readDictionary reads the weighted values of one field from a file with a
+// value per line, optionally followed by a tab and its weight:
+//
+//	# most requested first
+//	/	40
+//	/products	25
+//	/cart
+//
+// Values without a weight weigh 1; blank lines and lines starting with "#"
+// are skipped.
+func readDictionary(path string) (*weighted[string], error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	d := &weighted[string]{}
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		value, weight := line, 1.0
+		if v, w, ok := strings.Cut(line, "\t"); ok {
+			if weight, err = strconv.ParseFloat(strings.TrimSpace(w), 64); err != nil || weight < 0 {
+				return nil, fmt.Errorf("%s:%d: invalid weight %q", path, i+1, w)
+			}
+			value = v
+		}
+		d.add(value, weight)
+	}
+	if d.total() == 0 {
+		return nil, fmt.Errorf("%s lists no values with a positive weight", path)
+	}
+	return d, nil
+}
+
+// parseDictionaries reads the DICTIONARIES files, given as field=file pairs
+// such as "host=hosts.txt,user_agent=agents.tsv".
+func parseDictionaries(spec string) (map[string]*weighted[string], error) {
+	dicts := map[string]*weighted[string]{}
+	for _, part := range parseEnvList(spec) {
+		field, file, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok || file == "" {
+			return nil, fmt.Errorf("invalid DICTIONARIES entry %q (want field=file)", part)
+		}
+		if !slices.Contains(dictionaryFields, field) {
+			return nil, fmt.Errorf("unknown DICTIONARIES field %q (want one of %s)", field, strings.Join(dictionaryFields, ", "))
+		}
+		d, err := readDictionary(file)
+		if err != nil {
+			return nil, fmt.Errorf("DICTIONARIES %s: %w", field, err)
+		}
+		dicts[field] = d
+	}
+	return dicts, nil
+}
+
+// pick draws a value of field from its dictionary, or uniformly from values
+// when DICTIONARIES does not supply the field.
+func (g *generator) pick(field string, values []string) string {
+	if d := g.dictionaries[field]; d != nil {
+		return d.draw(g.rng)
+	}
+	return values[g.rng.Intn(len(values))]
+}
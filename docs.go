@@ -0,0 +1,206 @@
+package main
+
+import (
+	_ "embed"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// The configuration structs document their variables in doc comments; the
+// docs command reads them from the sources compiled into the binary.
+var (
+	//go:embed main.go
+	mainSource string
+	//go:embed sink.go
+	sinkSource string
+	//go:embed tls.go
+	tlsSource string
+)
+
+// configDoc describes one environment variable.
+type configDoc struct {
+	Name        string
+	Type        string
+	Default     string
+	Description string
+	// See names the first variable of a group sharing one description
+	See    string
+	Secret bool
+}
+
+// configDocs lists the variables of the configuration structs in
+// declaration order, the sink settings where config embeds them.
+func configDocs() ([]configDoc, error) {
+	comments := map[string]string{}
+	fset := token.NewFileSet()
+	for name, src := range map[string]string{"main.go": mainSource, "sink.go": sinkSource, "tls.go": tlsSource} {
+		f, err := parser.ParseFile(fset, name, src, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		fieldComments(fset, f, comments)
+	}
+	var docs []configDoc
+	collectDocs(reflect.TypeOf(config{}), comments, &docs)
+	return docs, nil
+}
+
+// fieldComments records the comment of each field of the struct types in f
+// under "type.Field". A field without a comment of its own directly below
+// another shares its comment, as in "Pacing of the run" followed by its
+// related settings.
+func fieldComments(fset *token.FileSet, f *ast.File, comments map[string]string) {
+	ast.Inspect(f, func(n ast.Node) bool {
+		spec, ok := n.(*ast.TypeSpec)
+		if !ok {
+			return true
+		}
+		st, ok := spec.Type.(*ast.StructType)
+		if !ok {
+			return false
+		}
+		shared, lastLine := "", 0
+		for _, field := range st.Fields.List {
+			text := strings.TrimSpace(field.Doc.Text() + " " + field.Comment.Text())
+			if text == "" && fset.Position(field.Pos()).Line == lastLine+1 {
+				text = shared
+			}
+			shared, lastLine = text, fset.Position(field.End()).Line
+			for _, name := range field.Names {
+				comments[spec.Name.Name+"."+name.Name] = strings.Join(strings.Fields(text), " ")
+			}
+		}
+		return false
+	})
+}
+
+func collectDocs(t reflect.Type, comments map[string]string, docs *[]configDoc) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := field.Tag.Get("env")
+		if name == "" {
+			if field.Type.Kind() == reflect.Struct && field.IsExported() {
+				collectDocs(field.Type, comments, docs)
+			}
+			continue
+		}
+		doc := configDoc{
+			Name:        name,
+			Type:        configType(field.Type),
+			Default:     field.Tag.Get("envDefault"),
+			Description: comments[t.Name()+"."+field.Name],
+			Secret:      isSecret(name),
+		}
+		if n := len(*docs); n > 0 && doc.Description != "" && (*docs)[n-1].Description == doc.Description {
+			doc.See = (*docs)[n-1].Name
+			if (*docs)[n-1].See != "" {
+				doc.See = (*docs)[n-1].See
+			}
+		}
+		*docs = append(*docs, doc)
+	}
+}
+
+// configType names the kind of value a variable takes.
+func configType(t reflect.Type) string {
+	switch t {
+	case reflect.TypeOf(time.Duration(0)):
+		return "duration"
+	case reflect.TypeOf(eventRate(0)):
+		return "rate"
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "bool"
+	case reflect.Int, reflect.Int64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	default:
+		return "string"
+	}
+}
+
+// runDocs prints the reference of all environment variables as a Markdown
+// table or a man page section.
+func runDocs(_ config, args []string) error {
+	fs := flag.NewFlagSet("docs", flag.ExitOnError)
+	format := fs.String("format", "markdown", "output format: markdown or man")
+	fs.Parse(args)
+
+	docs, err := configDocs()
+	if err != nil {
+		return err
+	}
+	switch *format {
+	case "markdown":
+		return writeMarkdownDocs(os.Stdout, docs)
+	case "man":
+		return writeManDocs(os.Stdout, docs)
+	default:
+		return fmt.Errorf("unknown docs format %q (want markdown or man)", *format)
+	}
+}
+
+func writeMarkdownDocs(w io.Writer, docs []configDoc) error {
+	cell := strings.NewReplacer("|", `\|`, "\n", " ")
+	fmt.Fprintln(w, "| Variable | Type | Default | Description |")
+	fmt.Fprintln(w, "|----------|------|---------|-------------|")
+	for _, d := range docs {
+		def := "-"
+		if d.Default != "" {
+			def = "`" + cell.Replace(d.Default) + "`"
+		}
+		desc := cell.Replace(d.Description)
+		if d.See != "" {
+			desc = "See `" + d.See + "`."
+		}
+		if d.Secret {
+			desc += " (secret, left out of EXPORT_CONFIG)"
+		}
+		if _, err := fmt.Fprintf(w, "| `%s` | %s | %s | %s |\n", d.Name, d.Type, def, desc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeManDocs(w io.Writer, docs []configDoc) error {
+	// roff treats a leading dot or quote as a request and backslash as an escape
+	text := func(s string) string {
+		s = strings.ReplaceAll(s, `\`, `\e`)
+		if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+			s = `\&` + s
+		}
+		return s
+	}
+	fmt.Fprintln(w, `.TH NGINX-LOG-GENERATOR 7 "" "nginx-log-generator" "Configuration"`)
+	fmt.Fprintln(w, ".SH NAME")
+	fmt.Fprintln(w, `nginx-log-generator \- environment variables`)
+	fmt.Fprintln(w, ".SH ENVIRONMENT")
+	for _, d := range docs {
+		fmt.Fprintf(w, ".TP\n.BR %s \" (%s)\"\n", d.Name, d.Type)
+		switch {
+		case d.See != "":
+			fmt.Fprintf(w, "See\n.BR %s .\n", d.See)
+		case d.Description != "":
+			fmt.Fprintln(w, text(d.Description))
+		}
+		if d.Default != "" {
+			fmt.Fprintf(w, ".br\nDefault: %s\n", text(d.Default))
+		}
+		if d.Secret {
+			fmt.Fprintln(w, ".br\nSecret: left out of EXPORT_CONFIG.")
+		}
+	}
+	_, err := fmt.Fprintln(w, ".SH SEE ALSO\nREADME.md")
+	return err
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// elasticSink indexes batches through the _bulk API of Elasticsearch or
+// OpenSearch. Each document goes to the index its timestamp selects from
+// ES_INDEX. Whole requests that fail with 429 or 5xx, and documents rejected
+// with 429 because the cluster is overloaded, are retried with exponential
+// backoff; any other rejection is an error. With ES_AWS_REGION, requests
+// are signed with SigV4 for Amazon OpenSearch Service or Serverless.
+//
+// With ES_DATA_STREAM, documents are appended to a data stream named after
+// the Elastic naming scheme, such as "logs-nginx.access-default", with
+// op_type create and an @timestamp field, as data streams require.
+type elasticSink struct {
+	*batcher
+	client     *http.Client
+	base       string
+	url        string
+	index      string
+	dataStream string
+	opType     string
+	username   string
+	password   string
+	apiKey     string
+	retries    int
+}
+
+func newElasticSink(cfg sinkConfig) (*elasticSink, error) {
+	client, err := newHTTPClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.ESAWSRegion != "" {
+		if client.Transport, err = newSigV4Transport(client.Transport, cfg); err != nil {
+			return nil, err
+		}
+	}
+	s := &elasticSink{
+		client:     client,
+		base:       strings.TrimSuffix(cfg.ESURL, "/"),
+		index:      cfg.ESIndex,
+		dataStream: cfg.ESDataStream,
+		opType:     cfg.ESOpType,
+		username:   cfg.ESUsername,
+		password:   cfg.ESPassword,
+		apiKey:     cfg.ESAPIKey,
+		retries:    cfg.ESRetries,
+	}
+	s.url = s.base + "/_bulk"
+	switch s.opType {
+	case "index", "create":
+	default:
+		return nil, fmt.Errorf("unknown ES_OP_TYPE %q (want index or create)", s.opType)
+	}
+	if s.dataStream != "" {
+		if err := checkDataStreamName(s.dataStream); err != nil {
+			return nil, err
+		}
+		// Data streams only accept create
+		s.opType = "create"
+		if cfg.ESIndexTemplate {
+			if err := s.installTemplate(cfg.ESILMPolicy); err != nil {
+				return nil, err
+			}
+		}
+	}
+	s.batcher = newBatcher(cfg.BatchSize, cfg.BatchInterval, s.bulk)
+	return s, nil
+}
+
+// indexName expands the strftime-style %Y, %m, %d and %H of pattern with
+// the UTC time t, so "nginx-%Y.%m.%d" gives daily indices.
+func indexName(pattern string, t time.Time) string {
+	t = t.UTC()
+	return strings.NewReplacer(
+		"%Y", t.Format("2006"),
+		"%m", t.Format("01"),
+		"%d", t.Format("02"),
+		"%H", t.Format("15"),
+	).Replace(pattern)
+}
+
+// checkDataStreamName checks that name follows the "<type>-<dataset>-<namespace>"
+// scheme Elastic integrations and the built-in logs-*-* template expect.
+func checkDataStreamName(name string) error {
+	parts := strings.Split(name, "-")
+	if len(parts) != 3 || slices.Contains(parts, "") || name != strings.ToLower(name) ||
+		strings.ContainsAny(name, `\/*?"<>| ,#:`) {
+		return fmt.Errorf("invalid ES_DATA_STREAM %q (want <type>-<dataset>-<namespace> in lowercase, e.g. logs-nginx.access-default)", name)
+	}
+	return nil
+}
+
+// installTemplate creates an index template for the data stream unless one
+// of that name exists. Its priority is above that of the built-in logs-*-*
+// template, so it applies to this stream only.
+func (s *elasticSink) installTemplate(ilmPolicy string) error {
+	settings := map[string]any{}
+	if ilmPolicy != "" {
+		settings["index.lifecycle.name"] = ilmPolicy
+	}
+	body, _ := json.Marshal(map[string]any{
+		"index_patterns": []string{s.dataStream},
+		"data_stream":    map[string]any{},
+		"priority":       200,
+		"template": map[string]any{
+			"settings": settings,
+			"mappings": map[string]any{
+				"properties": map[string]any{
+					"@timestamp": map[string]string{"type": "date"},
+					"message":    map[string]string{"type": "text"},
+				},
+			},
+		},
+	})
+	url := s.base + "/_index_template/" + s.dataStream + "?create=true"
+	req, err := http.NewRequest(http.MethodPut, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	s.authorize(req)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("installing index template %s: %w", s.dataStream, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode == http.StatusBadRequest && bytes.Contains(msg, []byte("already exists")) {
+		return nil
+	}
+	return fmt.Errorf("installing index template %s: PUT %s: %s: %s", s.dataStream, url, resp.Status, bytes.TrimSpace(msg))
+}
+
+// authorize sets the credentials of ES_API_KEY or ES_USERNAME on req.
+func (s *elasticSink) authorize(req *http.Request) {
+	switch {
+	case s.apiKey != "":
+		req.Header.Set("Authorization", "ApiKey "+s.apiKey)
+	case s.username != "":
+		req.SetBasicAuth(s.username, s.password)
+	}
+}
+
+// jsonDocument returns line if it is a JSON object, as with the JSON output
+// formats, and wraps it in a "message" field otherwise.
+func jsonDocument(line []byte) []byte {
+	if json.Valid(line) && bytes.HasPrefix(bytes.TrimSpace(line), []byte("{")) {
+		return line
+	}
+	doc, _ := json.Marshal(map[string]string{"message": string(line)})
+	return doc
+}
+
+// withTimestamp adds an @timestamp field with t to a JSON document that has
+// none.
+func withTimestamp(doc []byte, t time.Time) []byte {
+	return withField(doc, "@timestamp", t.UTC().Format(time.RFC3339Nano))
+}
+
+// withField adds the field name with value to the front of a JSON object
+// that does not have it yet.
+func withField(doc []byte, name string, value any) []byte {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(doc, &fields) != nil {
+		return doc
+	}
+	if _, ok := fields[name]; ok {
+		return doc
+	}
+	key, _ := json.Marshal(name)
+	val, err := json.Marshal(value)
+	if err != nil {
+		return doc
+	}
+	out := append(append(append([]byte{'{'}, key...), ':'), val...)
+	rest := bytes.TrimSpace(bytes.TrimSpace(doc)[1:])
+	if rest[0] != '}' {
+		out = append(out, ',')
+	}
+	return append(out, rest...)
+}
+
+func (s *elasticSink) bulk(records []record) error {
+	backoff := 500 * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		retry, err := s.post(records)
+		if err == nil && len(retry) == 0 {
+			return nil
+		}
+		if attempt == s.retries {
+			if err == nil {
+				err = fmt.Errorf("elasticsearch rejected %d documents with 429 after %d retries", len(retry), s.retries)
+			}
+			return err
+		}
+		if _, ok := err.(retryableError); err != nil && !ok {
+			return err
+		}
+		if err == nil {
+			records = retry
+		}
+		time.Sleep(backoff)
+		backoff = min(2*backoff, 30*time.Second)
+	}
+}
+
+// retryableError is a failure of a whole bulk request worth retrying.
+type retryableError struct{ error }
+
+// bulkResponse is the part of a _bulk response needed to find rejected
+// documents.
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int             `json:"status"`
+		Error  json.RawMessage `json:"error"`
+	} `json:"items"`
+}
+
+// post sends one _bulk request and returns the records rejected with 429.
+func (s *elasticSink) post(records []record) ([]record, error) {
+	var b bytes.Buffer
+	for _, r := range records {
+		index := s.dataStream
+		if index == "" {
+			index = indexName(s.index, r.Time)
+		}
+		action, _ := json.Marshal(map[string]map[string]string{s.opType: {"_index": index}})
+		b.Write(action)
+		b.WriteByte('\n')
+		doc := jsonDocument(r.Line)
+		if s.dataStream != "" {
+			doc = withTimestamp(doc, r.Time)
+		}
+		b.Write(doc)
+		b.WriteByte('\n')
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.url, &b)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	s.authorize(req)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, retryableError{err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		err := fmt.Errorf("POST %s: %s: %s", s.url, resp.Status, bytes.TrimSpace(msg))
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+			return nil, retryableError{err}
+		}
+		return nil, err
+	}
+
+	var result bulkResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("reading _bulk response: %w", err)
+	}
+	if !result.Errors {
+		return nil, nil
+	}
+	var retry []record
+	for i, item := range result.Items {
+		for _, res := range item {
+			switch {
+			case res.Status/100 == 2:
+			case res.Status == http.StatusTooManyRequests && i < len(records):
+				retry = append(retry, records[i])
+			default:
+				return nil, fmt.Errorf("elasticsearch rejected a document with status %d: %s", res.Status, res.Error)
+			}
+		}
+	}
+	return retry, nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// envelope wraps a batch of rendered lines into a request body. Envelopes are
+// chosen independently of OUTPUT_FORMAT: lines that are not JSON documents
+// are embedded as JSON strings wherever the envelope requires JSON values.
+type envelope struct {
+	contentType string
+	wrap        func(lines [][]byte) ([]byte, error)
+}
+
+func newEnvelope(name string) (envelope, error) {
+	switch name {
+	case "ndjson":
+		return envelope{"application/x-ndjson", wrapNDJSON}, nil
+	case "json-array":
+		return envelope{"application/json", wrapJSONArray}, nil
+	case "records":
+		return envelope{"application/json", wrapRecords}, nil
+	case "es-bulk":
+		return envelope{"application/x-ndjson", wrapESBulk}, nil
+	case "hec":
+		return envelope{"application/json", wrapHEC}, nil
+	default:
+		return envelope{}, fmt.Errorf("unknown envelope %q (want ndjson, json-array, records, es-bulk or hec)", name)
+	}
+}
+
+func wrapNDJSON(lines [][]byte) ([]byte, error) {
+	var b bytes.Buffer
+	for _, line := range lines {
+		b.Write(line)
+		b.WriteByte('\n')
+	}
+	return b.Bytes(), nil
+}
+
+func wrapJSONArray(lines [][]byte) ([]byte, error) {
+	values := make([]json.RawMessage, len(lines))
+	for i, line := range lines {
+		values[i] = jsonValue(line)
+	}
+	return json.Marshal(values)
+}
+
+func wrapRecords(lines [][]byte) ([]byte, error) {
+	values := make([]json.RawMessage, len(lines))
+	for i, line := range lines {
+		values[i] = jsonValue(line)
+	}
+	return json.Marshal(struct {
+		Records []json.RawMessage `json:"records"`
+	}{values})
+}
+
+func wrapESBulk(lines [][]byte) ([]byte, error) {
+	var b bytes.Buffer
+	for _, line := range lines {
+		b.WriteString(`{"index":{}}` + "\n")
+		if json.Valid(line) {
+			b.Write(line)
+		} else {
+			// Bulk documents must be objects; keep the raw line as the message
+			doc, _ := json.Marshal(map[string]string{"message": string(line)})
+			b.Write(doc)
+		}
+		b.WriteByte('\n')
+	}
+	return b.Bytes(), nil
+}
+
+// wrapHEC writes one Splunk HTTP Event Collector event per line, which HEC
+// accepts concatenated in a single request.
+func wrapHEC(lines [][]byte) ([]byte, error) {
+	var b bytes.Buffer
+	for _, line := range lines {
+		event, err := json.Marshal(struct {
+			Event json.RawMessage `json:"event"`
+		}{jsonValue(line)})
+		if err != nil {
+			return nil, err
+		}
+		b.Write(event)
+		b.WriteByte('\n')
+	}
+	return b.Bytes(), nil
+}
+
+// jsonValue returns line unchanged if it is already valid JSON, and as a
+// quoted JSON string otherwise.
+func jsonValue(line []byte) json.RawMessage {
+	if json.Valid(line) {
+		return line
+	}
+	quoted, _ := json.Marshal(string(line))
+	return quoted
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// errorLogLine returns an nginx error_log line about the request described by
+// e, picked from the warn/error situations most commonly seen in production:
+// failing upstreams, timeouts and TLS handshake errors.
+func errorLogLine(rnd *rand.Rand, now time.Time, e *logEntry) string {
+	prefix := fmt.Sprintf("%s [%%s] 31#31: *%d ", now.Format("2006/01/02 15:04:05"), rnd.Intn(1000000)+1)
+	upstream := fmt.Sprintf("10.244.%d.%d:8080", rnd.Intn(8), rnd.Intn(254)+1)
+	request := fmt.Sprintf(`request: "%s %s %s"`, e.HTTP.Method, e.HTTP.URI, e.HTTP.Protocol)
+	context := fmt.Sprintf(`client: %s, server: %s, %s, upstream: "http://%s%s", host: "%s"`,
+		e.Nginx.RemoteAddr, e.HTTP.Host, request, upstream, e.HTTP.URI, e.HTTP.Host)
+
+	switch rnd.Intn(5) {
+	case 0:
+		return fmt.Sprintf(prefix, "error") + "connect() failed (111: Connection refused) while connecting to upstream, " + context
+	case 1:
+		return fmt.Sprintf(prefix, "error") + "upstream timed out (110: Connection timed out) while reading response header from upstream, " + context
+	case 2:
+		return fmt.Sprintf(prefix, "crit") + fmt.Sprintf("SSL_do_handshake() failed (SSL: error:0A00010B:SSL routines::wrong version number) while SSL handshaking, client: %s, server: 0.0.0.0:443", e.Nginx.RemoteAddr)
+	case 3:
+		return fmt.Sprintf(prefix, "warn") + fmt.Sprintf("upstream server temporarily disabled while connecting to upstream, %s", context)
+	default:
+		return fmt.Sprintf(prefix, "warn") + fmt.Sprintf("an upstream response is buffered to a temporary file /var/cache/nginx/proxy_temp/%d/%02d/%010d while reading upstream, %s",
+			rnd.Intn(10), rnd.Intn(100), rnd.Intn(1000000000), context)
+	}
+}
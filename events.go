@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// honeycombSink sends batches of events to the Honeycomb batch API. Each
+// line becomes the data of an event, as is for the JSON output formats and
+// in a "message" field otherwise, timed by its record.
+type honeycombSink struct {
+	*batcher
+	client *http.Client
+	url    string
+	apiKey string
+}
+
+func newHoneycombSink(cfg sinkConfig) (*honeycombSink, error) {
+	if cfg.HoneycombAPIKey == "" {
+		return nil, fmt.Errorf("HONEYCOMB_API_KEY must be set for the honeycomb sink")
+	}
+	client, err := newHTTPClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	s := &honeycombSink{
+		client: client,
+		url:    strings.TrimSuffix(cfg.HoneycombURL, "/") + "/1/batch/" + url.PathEscape(cfg.HoneycombDataset),
+		apiKey: cfg.HoneycombAPIKey,
+	}
+	s.batcher = newBatcher(cfg.BatchSize, cfg.BatchInterval, s.post)
+	return s, nil
+}
+
+func (s *honeycombSink) post(records []record) error {
+	type event struct {
+		Time time.Time       `json:"time"`
+		Data json.RawMessage `json:"data"`
+	}
+	events := make([]event, len(records))
+	for i, r := range records {
+		events[i] = event{r.Time, jsonDocument(r.Line)}
+	}
+	body, err := json.Marshal(events)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Honeycomb-Team", s.apiKey)
+
+	// The batch API answers 200 with a status per event
+	var results []struct {
+		Status int    `json:"status"`
+		Error  string `json:"error"`
+	}
+	if err := doJSONRequest(s.client, req, &results); err != nil {
+		return err
+	}
+	for _, res := range results {
+		if res.Status/100 != 2 {
+			return fmt.Errorf("honeycomb rejected an event with status %d: %s", res.Status, res.Error)
+		}
+	}
+	return nil
+}
+
+// openObserveSink sends batches of records to the JSON ingestion API of an
+// OpenObserve stream. Records are converted as for Honeycomb and carry their
+// time in _timestamp, OpenObserve's time field.
+type openObserveSink struct {
+	*batcher
+	client   *http.Client
+	url      string
+	username string
+	password string
+}
+
+func newOpenObserveSink(cfg sinkConfig) (*openObserveSink, error) {
+	client, err := newHTTPClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	s := &openObserveSink{
+		client:   client,
+		url:      fmt.Sprintf("%s/api/%s/%s/_json", strings.TrimSuffix(cfg.OpenObserveURL, "/"), url.PathEscape(cfg.OpenObserveOrg), url.PathEscape(cfg.OpenObserveStream)),
+		username: cfg.OpenObserveUsername,
+		password: cfg.OpenObservePassword,
+	}
+	s.batcher = newBatcher(cfg.BatchSize, cfg.BatchInterval, s.post)
+	return s, nil
+}
+
+func (s *openObserveSink) post(records []record) error {
+	docs := make([]json.RawMessage, len(records))
+	for i, r := range records {
+		docs[i] = withField(jsonDocument(r.Line), "_timestamp", r.Time.UnixMicro())
+	}
+	body, err := json.Marshal(docs)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.username != "" {
+		req.SetBasicAuth(s.username, s.password)
+	}
+
+	var result struct {
+		Status []struct {
+			Name   string `json:"name"`
+			Failed int    `json:"failed"`
+			Error  string `json:"error"`
+		} `json:"status"`
+	}
+	if err := doJSONRequest(s.client, req, &result); err != nil {
+		return err
+	}
+	for _, st := range result.Status {
+		if st.Failed > 0 {
+			return fmt.Errorf("openobserve rejected %d records of stream %s: %s", st.Failed, st.Name, st.Error)
+		}
+	}
+	return nil
+}
+
+// doJSONRequest sends req like doRequest and decodes the JSON response
+// into v.
+func doJSONRequest(client *http.Client, req *http.Request, v any) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s: %s: %s", req.Method, req.URL, resp.Status, bytes.TrimSpace(msg))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("reading response of %s: %w", req.URL, err)
+	}
+	return nil
+}
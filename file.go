@@ -0,0 +1,137 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+)
+
+// fileSink appends lines to a file and rotates it the way logrotate does:
+// once it reaches the size limit, path becomes path.1, path.1 becomes
+// path.2 and so on, and the oldest file is removed. With compression, files
+// from path.2 on are gzipped; path.1 stays plain for shippers still reading
+// it, as with logrotate's delaycompress.
+type fileSink struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+	compress bool
+	file     *os.File
+	size     int64
+}
+
+func newFileSink(cfg sinkConfig) (*fileSink, error) {
+	if cfg.FilePath == "" {
+		return nil, fmt.Errorf("SINK=file requires FILE_PATH")
+	}
+	maxSize, err := parseSize(cfg.FileMaxSize)
+	if err != nil {
+		return nil, fmt.Errorf("FILE_MAX_SIZE: %w", err)
+	}
+	if cfg.FileMaxFiles < 1 {
+		return nil, fmt.Errorf("FILE_MAX_FILES must be at least 1")
+	}
+	s := &fileSink{path: cfg.FilePath, maxSize: int64(maxSize), maxFiles: cfg.FileMaxFiles, compress: cfg.FileCompress}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *fileSink) Send(r record) error {
+	line := append(r.Line, '\n')
+	if s.maxSize > 0 && s.size > 0 && s.size+int64(len(line)) > s.maxSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	return err
+}
+
+func (s *fileSink) open() error {
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.file, s.size = f, info.Size()
+	return nil
+}
+
+func (s *fileSink) rotate() error {
+	if err := s.Close(); err != nil {
+		return err
+	}
+	if err := os.Remove(s.rotated(s.maxFiles)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for i := s.maxFiles - 1; i >= 1; i-- {
+		from := s.rotated(i)
+		if s.compress && i == 1 && s.maxFiles > 1 {
+			// path.1 is the only plain rotated file; it is compressed on its
+			// way to path.2
+			if err := gzipFile(from, s.rotated(2)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+		if err := os.Rename(from, s.rotated(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(s.path, s.rotated(1)); err != nil {
+		return err
+	}
+	return s.open()
+}
+
+// rotated returns the name of the i-th rotated file.
+func (s *fileSink) rotated(i int) string {
+	name := fmt.Sprintf("%s.%d", s.path, i)
+	if s.compress && i > 1 {
+		name += ".gz"
+	}
+	return name
+}
+
+// gzipFile compresses from into to and removes from.
+func gzipFile(from, to string) error {
+	in, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(to)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	if _, err := io.Copy(zw, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Remove(from)
+}
+
+func (s *fileSink) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// formatter renders a log entry as a single output line.
+type formatter func(e *logEntry) ([]byte, error)
+
+// newFormatter returns the formatter for LOG_FORMAT or OUTPUT_TEMPLATE if
+// one is set, and the one selected by OUTPUT_FORMAT otherwise.
+func newFormatter(cfg config) (formatter, error) {
+	text, err := outputTemplate(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.LogFormat != "" && text != "" {
+		return nil, fmt.Errorf("LOG_FORMAT and OUTPUT_TEMPLATE cannot both be set")
+	}
+	if cfg.LogFormat != "" {
+		f, err := newTemplateFormatter(cfg.LogFormat)
+		if err != nil {
+			return nil, fmt.Errorf("LOG_FORMAT: %w", err)
+		}
+		return f, nil
+	}
+	if text != "" {
+		f, err := newGoTemplateFormatter(text)
+		if err != nil {
+			return nil, fmt.Errorf("OUTPUT_TEMPLATE: %w", err)
+		}
+		return f, nil
+	}
+	switch cfg.OutputFormat {
+	case "json":
+		return formatJSON, nil
+	case "combined":
+		return formatCombined, nil
+	case "winevent-xml":
+		return newWinEventFormatter(false), nil
+	case "winevent-json":
+		return newWinEventFormatter(true), nil
+	case "influx":
+		return formatInflux, nil
+	case "logfmt":
+		return formatLogfmt, nil
+	case "csv":
+		return formatCSV, nil
+	default:
+		return nil, fmt.Errorf("unknown output format %q", cfg.OutputFormat)
+	}
+}
+
+// needBuiltinFormat returns an error if lines are rendered with LOG_FORMAT
+// or an output template, which the configurations command writes for
+// OUTPUT_FORMAT cannot read.
+func needBuiltinFormat(cfg config, command string) error {
+	switch {
+	case cfg.LogFormat != "":
+		return fmt.Errorf("%s supports the OUTPUT_FORMAT formats only, unset LOG_FORMAT", command)
+	case cfg.OutputTemplate != "" || cfg.OutputTemplateFile != "":
+		return fmt.Errorf("%s supports the OUTPUT_FORMAT formats only, unset OUTPUT_TEMPLATE and OUTPUT_TEMPLATE_FILE", command)
+	}
+	return nil
+}
+
+func formatJSON(e *logEntry) ([]byte, error) {
+	return json.Marshal(e)
+}
+
+// formatCombined renders nginx's predefined "combined" log format:
+//
+//	$remote_addr - $remote_user [$time_local] "$request" $status
+//	$body_bytes_sent "$http_referer" "$http_user_agent"
+func formatCombined(e *logEntry) ([]byte, error) {
+	line := fmt.Sprintf(`%s - %s [%s] "%s %s %s" %d %s "%s" "%s"`,
+		e.Nginx.RemoteAddr, orDash(escapeNginx(e.Nginx.RemoteUser)), e.Timestamp.Format(timeLocalLayout),
+		e.HTTP.Method, escapeNginx(e.HTTP.URI), e.HTTP.Protocol, e.HTTP.StatusCode, e.HTTP.BytesSent,
+		orDash(escapeNginx(e.Nginx.HTTPReferrer)), orDash(escapeNginx(e.HTTP.UserAgent)))
+	return []byte(line), nil
+}
+
+// escapeNginx escapes a variable the way nginx's default log escaping does:
+// quotes, backslashes, control and non-ASCII bytes become \xHH.
+func escapeNginx(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '"' || c == '\\' || c < 0x20 || c > 0x7e {
+			fmt.Fprintf(&b, "\\x%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// orDash returns "-", nginx's placeholder for empty variables, for "".
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// field is a single flattened entry field.
+type field struct {
+	Name  string
+	Value string
+}
+
+// flattenEntry lists the fields of e in declaration order, naming them by
+// their dotted JSON path (e.g. "http.status_code"). Fields tagged omitempty
+// are skipped when empty, mirroring the JSON output.
+func flattenEntry(e *logEntry) []field {
+	var fields []field
+	flattenValue(reflect.ValueOf(*e), "", &fields)
+	return fields
+}
+
+func flattenValue(v reflect.Value, prefix string, fields *[]field) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag.Get("json")
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "-" || name == "" {
+			continue
+		}
+		fv := v.Field(i)
+		if opts == "omitempty" && fv.IsZero() {
+			continue
+		}
+		if fv.Kind() == reflect.Pointer {
+			if fv.IsNil() {
+				continue
+			}
+			fv = fv.Elem()
+		}
+
+		switch val := fv.Interface().(type) {
+		case time.Time:
+			*fields = append(*fields, field{prefix + name, val.Format(time.RFC3339Nano)})
+		default:
+			if fv.Kind() == reflect.Struct {
+				flattenValue(fv, prefix+name+".", fields)
+				continue
+			}
+			*fields = append(*fields, field{prefix + name, fmt.Sprint(val)})
+		}
+	}
+}
@@ -0,0 +1,612 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v6"
+)
+
+// generator builds access log entries from the configured value lists.
+type generator struct {
+	cfg config
+	// Each generator draws from its own stream, so that instances are
+	// reproducible independently of each other; the faker shares it, as the
+	// package-level one is neither seeded by SEED nor safe for concurrent use
+	src   randSource
+	rng   *rand.Rand
+	faker *gofakeit.Faker
+	// pathRanks draws paths by popularity with ZIPF_S, nil for uniform draws
+	pathRanks *weighted[string]
+	// dictionaries are the DICTIONARIES files by field
+	dictionaries map[string]*weighted[string]
+
+	ips         []string
+	methods     []string
+	paths       []string
+	statusCodes []int
+	hosts       []string
+	remoteUsers []string
+
+	// lastPage remembers the page each client IP viewed last, for
+	// REFERRER_NAVIGATION
+	lastPage map[string]string
+
+	traceSampling [6]float64
+	clientErrors  *weighted[int]
+	// statusWeights draws from STATUS_WEIGHTS; a 0 stands for the remainder
+	// left to STATUS_CODES
+	statusWeights *weighted[int]
+	bodySizes     map[int]sizeRange
+	latency       *latencyModel
+	hourlyRate    []float64
+	diurnal       *diurnalCurve
+	spikes        []*spike
+	userAgentMix  *weighted[string]
+	sslMix        *weighted[string]
+	protocolMix   *weighted[string]
+	cardinality   map[string]*valuePool
+
+	pods     []*pod
+	proxies  *proxyChain
+	sessions *sessionEngine
+	// crawlPages are the pages of PATHS crawlers request, with BOT_PERCENT
+	crawlPages  []string
+	failover    *failover
+	maintenance *maintenance
+	ddos        *ddos
+	rewrites    []ingressRewrite
+
+	// start is the time of the first generated entry; scenarios are
+	// scheduled relative to it
+	start time.Time
+
+	// events records scenario events; worker generators share the runner's
+	events *recorder
+}
+
+func newGenerator(cfg config) (*generator, error) {
+	// Parse environment variables for specific values
+	g := &generator{
+		cfg:         cfg,
+		ips:         parseEnvList(cfg.IPAddresses),
+		methods:     parseEnvList(cfg.HTTPMethods),
+		paths:       parseEnvList(cfg.Paths),
+		statusCodes: parseEnvIntList(cfg.StatusCodes),
+		hosts:       parseEnvList(cfg.Hosts),
+		remoteUsers: parseEnvList(cfg.RemoteUsers),
+		lastPage:    map[string]string{},
+		events:      &recorder{marked: map[string]bool{}},
+	}
+
+	var err error
+	if g.src, err = streamSource(cfg); err != nil {
+		return nil, err
+	}
+	g.rng = rand.New(g.src)
+	g.faker = &gofakeit.Faker{Rand: g.rng}
+
+	if g.dictionaries, err = parseDictionaries(cfg.Dictionaries); err != nil {
+		return nil, err
+	}
+	if d := g.dictionaries["path"]; d != nil {
+		if cfg.PathCatalogFile != "" || cfg.PathCatalogSize > 0 || cfg.PathCardinality > 0 || cfg.ZipfS > 0 {
+			return nil, errors.New("a path dictionary cannot be used with PATH_CATALOG_FILE, PATH_CATALOG_SIZE, PATH_CARDINALITY or ZIPF_S")
+		}
+		g.paths = d.values
+	}
+	if d := g.dictionaries["host"]; d != nil {
+		g.hosts = d.values
+	}
+	if d := g.dictionaries["remote_user"]; d != nil {
+		g.remoteUsers = d.values
+	}
+	if cfg.PathCatalogFile != "" {
+		if g.paths, err = readPathCatalog(cfg.PathCatalogFile); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.PathCatalogSize > 0 {
+		if cfg.PathCardinality != 0 {
+			return nil, errors.New("PATH_CATALOG_SIZE cannot be used with PATH_CARDINALITY")
+		}
+		if len(g.paths) == 0 {
+			g.paths = catalogBases
+		}
+		g.paths = buildPathPool(g.paths, cfg.PathCatalogSize)
+	}
+	if g.pods, err = parseRegions(cfg.Regions); err != nil {
+		return nil, err
+	}
+	if g.rewrites, err = parseIngressRewrites(cfg.IngressRewrites); err != nil {
+		return nil, err
+	}
+	if cfg.Sessions > 0 {
+		if g.sessions, err = newSessionEngine(cfg, g.paths); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.BotPercent > 0 {
+		for _, p := range g.paths {
+			if classifyPath(p) == pagePath {
+				g.crawlPages = append(g.crawlPages, p)
+			}
+		}
+		if len(g.crawlPages) == 0 {
+			g.crawlPages = []string{"/"}
+		}
+	}
+	if cfg.XFFChainPercent > 0 {
+		if g.proxies, err = newProxyChain(cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	// Validate that required environment variables are set
+	if len(g.ips) == 0 && !g.regionsCoverIPs() {
+		return nil, errors.New("IP_ADDRESSES environment variable must be set with at least one IP address")
+	}
+	if len(g.methods) == 0 {
+		return nil, errors.New("HTTP_METHODS environment variable must be set with at least one HTTP method")
+	}
+	if len(g.paths) == 0 {
+		return nil, errors.New("PATHS environment variable must be set with at least one path")
+	}
+	if g.statusWeights, err = parseCodeWeights(cfg.StatusWeights, "STATUS_WEIGHTS"); err != nil {
+		return nil, err
+	}
+	if g.statusWeights != nil {
+		for _, code := range g.statusWeights.values {
+			if code < 100 || code > 599 {
+				return nil, fmt.Errorf("STATUS_WEIGHTS may only list codes from 100 to 599, got %d", code)
+			}
+		}
+		// Weights are percentages, and what they leave goes to STATUS_CODES
+		if total := g.statusWeights.total(); len(g.statusCodes) > 0 && total < 100 {
+			g.statusWeights.add(0, 100-total)
+		}
+	}
+	if len(g.statusCodes) == 0 && g.statusWeights == nil {
+		return nil, errors.New("STATUS_CODES or STATUS_WEIGHTS environment variable must be set with at least one status code")
+	}
+	if len(g.hosts) == 0 {
+		return nil, errors.New("HOSTS environment variable must be set with at least one host")
+	}
+
+	if g.failover, err = newFailover(cfg, g.pods); err != nil {
+		return nil, err
+	}
+	g.maintenance = newMaintenance(cfg)
+	if g.ddos, err = newDDoS(cfg, g.rng); err != nil {
+		return nil, err
+	}
+	if cfg.IncidentWebhookURL != "" || cfg.PagerDutyRoutingKey != "" {
+		if g.events.incidents, err = newIncidentNotifier(cfg); err != nil {
+			return nil, err
+		}
+	}
+	if g.events.truth, err = newGroundTruth(cfg.GroundTruthFile); err != nil {
+		return nil, err
+	}
+	if g.clientErrors, err = parseCodeWeights(cfg.ClientErrorWeights, "CLIENT_ERROR_WEIGHTS"); err != nil {
+		return nil, err
+	}
+	if g.clientErrors != nil {
+		for _, code := range g.clientErrors.values {
+			if code < 400 || code > 499 {
+				return nil, fmt.Errorf("CLIENT_ERROR_WEIGHTS may only list 4xx codes, got %d", code)
+			}
+		}
+	}
+	if g.cardinality, err = parseCardinalityLimits(cfg.CardinalityLimits); err != nil {
+		return nil, err
+	}
+	if cfg.ResponseCorrelation && cfg.UpstreamTimeout <= 0 {
+		return nil, errors.New("UPSTREAM_TIMEOUT must be positive")
+	}
+	if g.bodySizes, err = parseBodySizes(cfg.BytesSentProfile); err != nil {
+		return nil, err
+	}
+	if g.traceSampling, err = parseTraceSampling(cfg.TraceSampling); err != nil {
+		return nil, err
+	}
+	if cfg.LatencyMedian > 0 {
+		if g.latency, err = newLatencyModel(cfg.LatencyMedian, cfg.LatencyP99); err != nil {
+			return nil, err
+		}
+	}
+	if g.userAgentMix, err = parseUserAgentMix(cfg.UserAgentMix); err != nil {
+		return nil, err
+	}
+	if g.protocolMix, err = parseProtocolMix(cfg.HTTPProtocolMix); err != nil {
+		return nil, err
+	}
+	if cfg.SSLFields {
+		if g.sslMix, err = parseSSLProtocolMix(cfg.SSLProtocolMix); err != nil {
+			return nil, err
+		}
+	}
+	if g.hourlyRate, err = parseHourlyRate(cfg.HourlyRateFactors); err != nil {
+		return nil, err
+	}
+	if g.spikes, err = parseSpikes(cfg.Spikes); err != nil {
+		return nil, err
+	}
+	if cfg.Diurnal {
+		if g.diurnal, err = newDiurnalCurve(cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.PathCardinality > 0 {
+		g.paths = buildPathPool(g.paths, cfg.PathCardinality)
+	}
+	if cfg.ZipfS < 0 {
+		return nil, fmt.Errorf("ZIPF_S must not be negative, got %g", cfg.ZipfS)
+	}
+	if cfg.ZipfS > 0 {
+		g.pathRanks = zipfWeights(g.paths, cfg.ZipfS)
+	}
+	return g, nil
+}
+
+// next returns a new entry for a request handled at the given time.
+func (g *generator) next(timeLocal time.Time) logEntry {
+	if g.start.IsZero() {
+		g.start = timeLocal
+	}
+
+	elapsed := timeLocal.Sub(g.start)
+
+	var p *pod
+	if pods := g.pods; len(pods) > 0 {
+		if g.failover.active(elapsed) {
+			pods = g.failover.survivors
+			g.markOnce(g.failover.after, "region_failover", map[string]interface{}{"region": g.failover.region})
+		}
+		p = pods[g.rng.Intn(len(pods))]
+	}
+
+	// Use only values from environment variables
+	var ip string
+	if p != nil && p.region.clients != nil {
+		ip = randomIP(g.rng, p.region.clients)
+	} else {
+		ip = g.ips[g.rng.Intn(len(g.ips))]
+	}
+	httpMethod := g.methods[g.rng.Intn(len(g.methods))]
+	var path string
+	if g.pathRanks != nil {
+		path = g.pathRanks.draw(g.rng)
+	} else {
+		path = g.pick("path", g.paths)
+	}
+	statusCode := 0
+	if g.statusWeights != nil {
+		statusCode = g.statusWeights.draw(g.rng)
+	}
+	weightedStatus := statusCode != 0
+	if !weightedStatus {
+		statusCode = g.statusCodes[g.rng.Intn(len(g.statusCodes))]
+	}
+	host := g.pick("host", g.hosts)
+	// Crawlers and attackers send requests of their own making
+	bot, botAgent, attack := false, "", ""
+	if g.cfg.BotPercent > 0 && g.rng.Float64()*100 < g.cfg.BotPercent {
+		bot, httpMethod = true, "GET"
+		ip, botAgent, path, statusCode = g.crawl(statusCode)
+	} else if g.cfg.AttackPercent > 0 && g.rng.Float64()*100 < g.cfg.AttackPercent {
+		bot, httpMethod = true, "GET"
+		ip, botAgent, path, statusCode, attack = g.attack()
+	}
+	var sess *session
+	if g.sessions != nil && !bot {
+		sess, path = g.sessions.request(g, timeLocal, ip, host)
+		ip, host = sess.IP, sess.Host
+		if classifyPath(path) != apiPath {
+			httpMethod = "GET"
+		}
+	}
+	ip = g.capped("nginx.remote_addr", ip, timeLocal)
+	host = g.capped("http.host", host, timeLocal)
+	host = g.retryHost(host, elapsed)
+
+	// Break client errors down into individually weighted 4xx codes, unless
+	// STATUS_WEIGHTS or the attack already chose the code
+	if !weightedStatus && attack == "" && statusCode >= 400 && statusCode < 500 && g.clientErrors != nil {
+		statusCode = g.clientErrors.draw(g.rng)
+	}
+
+	if g.cfg.MethodPathRules && !bot {
+		httpMethod = g.methodFor(httpMethod, classifyPath(path))
+	}
+	if g.cfg.StatusMethodRules && !bot {
+		httpMethod, path, statusCode = g.correlateStatus(httpMethod, path, statusCode)
+	}
+
+	if g.cfg.PathCardinality < 0 {
+		path = uniquePath(g.rng, path)
+	}
+	if !bot && g.rng.Float64()*100 < g.cfg.PathVariantPercent {
+		path = normalizationVariant(g.rng, path)
+	}
+	if !bot && g.rng.Float64()*100 < g.cfg.PercentEncodingPercent {
+		path = percentEncodingVariant(g.rng, path)
+	}
+
+	path = g.capped("http.uri", path, timeLocal)
+
+	// Let the URL and referrer spell the host differently from the Host header
+	urlHost, referrer := host, ""
+	switch {
+	case bot:
+		// Crawlers follow links and attackers forge requests, without a referrer
+	case sess != nil:
+		// Clients sharing an IP browse separately
+		referrer = g.navigate(sess.ID, host, path, httpMethod, statusCode)
+		if sess.done() {
+			delete(g.lastPage, sess.ID)
+		}
+	case g.cfg.ReferrerNavigation:
+		referrer = g.navigate(ip, host, path, httpMethod, statusCode)
+	case g.dictionaries["referrer"] != nil:
+		if referrer = g.dictionaries["referrer"].draw(g.rng); referrer == "-" {
+			referrer = ""
+		}
+	}
+	if !bot && g.rng.Float64()*100 < g.cfg.HostMismatchPercent {
+		urlHost = hostVariant(g.rng, host)
+		referrer = "https://" + hostVariant(g.rng, host) + "/"
+	}
+
+	bodyBytesSent := g.bytesSent(statusCode, path)
+	var userAgent string
+	switch {
+	case bot:
+		userAgent = g.capped("http.user_agent", botAgent, timeLocal)
+	case sess != nil:
+		userAgent = g.capped("http.user_agent", sess.UserAgent, timeLocal)
+	default:
+		userAgent = g.capped("http.user_agent", g.userAgent(), timeLocal)
+	}
+
+	// Generate a fake request ID
+	requestID := newRequestID(g.rng)
+	var traceSessionID string
+	if sess != nil {
+		traceSessionID = sess.ID
+	}
+	contentType := "application/json"
+	if d := g.dictionaries["content_type"]; d != nil {
+		contentType = d.draw(g.rng)
+	}
+	protocol := "HTTP/1.1"
+	if g.protocolMix != nil {
+		protocol = g.protocolMix.draw(g.rng)
+	}
+	requestTime := g.requestTime()
+	if g.cfg.ResponseCorrelation {
+		requestTime = g.correlateLatency(requestTime, statusCode, path)
+	}
+
+	entry := logEntry{
+		Timestamp: timeLocal,
+		HTTP: httpInfo{
+			RequestID:      requestID,
+			Method:         httpMethod,
+			StatusCode:     statusCode,
+			URL:            fmt.Sprintf("%s/%s", urlHost, strings.TrimPrefix(path, "/")),
+			Host:           host,
+			URI:            path,
+			RequestTime:    requestTime,
+			UserAgent:      userAgent,
+			Protocol:       protocol,
+			TraceSessionID: traceSessionID,
+			ServerProtocol: protocol,
+			ContentType:    contentType,
+			BytesSent:      fmt.Sprintf("%d", bodyBytesSent),
+		},
+		Nginx: nginxInfo{
+			XForwardFor:  ip,
+			RemoteAddr:   ip,
+			HTTPReferrer: referrer,
+		},
+	}
+
+	if g.proxies != nil {
+		entry.Nginx.RemoteAddr, entry.Nginx.XForwardFor = g.proxies.forward(g.rng, ip)
+	}
+	if g.cfg.Timezone != "" || g.cfg.BackfillFrom != "" {
+		entry.Nginx.TimeLocal = timeLocal.Format(timeLocalLayout)
+	}
+	if len(g.remoteUsers) > 0 {
+		if user := g.pick("remote_user", g.remoteUsers); user != "-" {
+			entry.Nginx.RemoteUser = user
+		}
+	}
+	if g.cfg.ClientHints {
+		entry.HTTP.SecCHUA, entry.HTTP.SecCHUAPlatform, entry.HTTP.SecCHUAMobile = clientHints(userAgent)
+	}
+	if g.cfg.HeaderFields {
+		entry.HTTP.AcceptEncoding = acceptEncoding(g.rng, userAgent, entry.HTTP.Protocol)
+		entry.HTTP.ContentEncoding = contentEncoding(g.rng, entry.HTTP.AcceptEncoding, path, statusCode)
+		entry.HTTP.Scheme, entry.HTTP.Authority = schemeAndAuthority(g.rng, entry.HTTP.Protocol, host)
+	}
+	if p != nil {
+		entry.HTTP.RequestTime += float32(p.region.latency)
+		entry.Kubernetes = &kubernetesInfo{PodName: p.name, Region: p.region.name, Zone: p.zone}
+	}
+	if d := g.dictionaries["upstream"]; d != nil {
+		entry.Nginx.ProxyUpstreamName = d.draw(g.rng)
+	}
+	if g.cfg.CanaryPercent > 0 {
+		g.applyCanary(&entry)
+	}
+	if g.cfg.BlueGreenAt > 0 {
+		upstream := g.blueGreenUpstream(elapsed)
+		entry.Nginx.ProxyUpstreamName = upstreamName(host, upstream)
+		if upstream == "green" {
+			entry.HTTP.RequestTime *= float32(g.cfg.BlueGreenLatencyFactor)
+			g.markOnce(g.cfg.BlueGreenAt, "bluegreen_cutover", map[string]interface{}{"from": "blue", "to": "green"})
+		}
+	}
+	if g.maintenance != nil {
+		g.applyMaintenance(&entry, elapsed)
+	}
+	if g.ddos != nil {
+		g.applyDDoS(&entry, elapsed)
+	}
+	if len(g.rewrites) > 0 {
+		g.rewrite(&entry)
+	}
+	g.markSpikes(timeLocal)
+	if attack != "" {
+		g.markAttack(timeLocal, &entry, attack)
+	}
+	if g.cfg.UpstreamFields {
+		g.setUpstream(&entry)
+	}
+	if g.sslMix != nil {
+		g.setSSL(&entry)
+	}
+	if g.cfg.HeaderFields {
+		// Framing depends on the final status and size, so it comes last
+		entry.HTTP.TransferEncoding, entry.HTTP.ContentLength = g.framing(&entry)
+	}
+	if class := entry.HTTP.StatusCode / 100; class >= 1 && class <= 5 && g.rng.Float64()*100 < g.traceSampling[class] {
+		entry.HTTP.Traceparent = traceparent(g.rng)
+	}
+	return entry
+}
+
+// methodFor picks a configured method that is plausible for the path class.
+// GET dominates wherever it is configured and allowed; when no configured
+// method fits, the drawn method is kept.
+func (g *generator) methodFor(method string, class pathClass) string {
+	var allowed []string
+	for _, m := range g.methods {
+		if methodAllowed(m, class) {
+			allowed = append(allowed, m)
+		}
+	}
+	if len(allowed) == 0 {
+		return method
+	}
+	if class != apiPath && slices.Contains(allowed, "GET") && g.rng.Intn(10) < 8 {
+		return "GET"
+	}
+	return allowed[g.rng.Intn(len(allowed))]
+}
+
+// markOnce records a scenario event scheduled at the given offset from the
+// start of the run, the first time it is reached.
+func (g *generator) markOnce(at time.Duration, event string, details map[string]interface{}) {
+	g.events.markOnce(event, g.start.Add(at), event, details)
+}
+
+// regionsCoverIPs reports whether every simulated region has its own client
+// IP pool, making IP_ADDRESSES unnecessary.
+func (g *generator) regionsCoverIPs() bool {
+	for _, p := range g.pods {
+		if p.region.clients == nil {
+			return false
+		}
+	}
+	return len(g.pods) > 0
+}
+
+// navigate returns the referrer for a request from the given client: the
+// page it viewed before. Successful page views become the referrer of the
+// client's following requests, so assets and API calls point back to the
+// page that triggered them and page views form a navigation chain.
+func (g *generator) navigate(ip, host, path, method string, status int) string {
+	referrer := g.lastPage[ip]
+	if method == "GET" && status < 400 && classifyPath(path) == pagePath {
+		g.lastPage[ip] = "https://" + host + path
+	}
+	return referrer
+}
+
+// unknownPaths are requested by clients although they rarely exist; real
+// 404 responses cluster on paths like these.
+var unknownPaths = []string{
+	"/favicon.ico",
+	"/apple-touch-icon.png",
+	"/apple-touch-icon-precomposed.png",
+	"/.well-known/security.txt",
+	"/ads.txt",
+}
+
+// correlateStatus adjusts a request so that its status is plausible for its
+// method and path: 201 answers creation requests, 405 answers methods the
+// path does not support and 404s concentrate on a few missing paths.
+func (g *generator) correlateStatus(method, path string, status int) (string, string, int) {
+	switch status {
+	case 200:
+		if method == "POST" && g.hasStatus(201) && g.rng.Intn(10) < 6 {
+			status = 201
+		}
+	case 201:
+		if method != "POST" && method != "PUT" {
+			status = 200
+		}
+	case 404:
+		if g.rng.Intn(10) < 7 {
+			path = unknownPaths[g.rng.Intn(len(unknownPaths))]
+		} else {
+			path = strings.TrimSuffix(path, "/") + "/undefined"
+		}
+	case 405:
+		// Turn the request into one the path cannot serve
+		if class := classifyPath(path); class != apiPath {
+			for _, m := range []string{"DELETE", "PUT", "PATCH"} {
+				if !methodAllowed(m, class) {
+					method = m
+					break
+				}
+			}
+		}
+	}
+
+	// Missing paths answer 404 whatever the method
+	if status != 404 && !methodAllowed(method, classifyPath(path)) && g.hasStatus(405) {
+		status = 405
+	}
+	return method, path, status
+}
+
+func (g *generator) hasStatus(code int) bool {
+	for _, c := range g.statusCodes {
+		if c == code {
+			return true
+		}
+	}
+	if g.statusWeights != nil {
+		for i, c := range g.statusWeights.values {
+			if c == code && g.statusWeights.weight(i) > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// timeLocalLayout is the layout of nginx's $time_local variable.
+const timeLocalLayout = "02/Jan/2006:15:04:05 -0700"
+
+// newRequestID returns a random version 4 UUID. It draws from rng directly
+// rather than through the faker, whose Rand.Read keeps unused bytes between
+// calls that a backfill checkpoint could not capture.
+func newRequestID(rnd *rand.Rand) string {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], rnd.Uint64())
+	binary.BigEndian.PutUint64(b[8:], rnd.Uint64())
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
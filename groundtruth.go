@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// groundTruth records what the generator did on purpose (scenario phases,
+// injected anomalies) as JSON lines, so detection tools can be scored
+// against it. A nil *groundTruth discards all marks.
+type groundTruth struct {
+	file *os.File
+}
+
+func newGroundTruth(path string) (*groundTruth, error) {
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &groundTruth{file: f}, nil
+}
+
+// mark records that event happened at t.
+func (g *groundTruth) mark(t time.Time, event string, details map[string]interface{}) error {
+	if g == nil {
+		return nil
+	}
+	line, err := json.Marshal(struct {
+		Timestamp time.Time              `json:"ts"`
+		Event     string                 `json:"event"`
+		Details   map[string]interface{} `json:"details,omitempty"`
+	}{t, event, details})
+	if err != nil {
+		return err
+	}
+	_, err = g.file.Write(append(line, '\n'))
+	return err
+}
+
+// recorder writes scenario events to the ground truth and announces them to
+// the incident webhook. The generators of a run share one recorder, so with
+// WORKERS every event is still recorded once.
+type recorder struct {
+	mu        sync.Mutex
+	truth     *groundTruth
+	incidents *incidentNotifier
+	// marked lists the events already recorded by markOnce
+	marked map[string]bool
+}
+
+// mark records that event happened at t and announces it. Failures are
+// reported without stopping generation. The announcement is made outside
+// the lock, so a slow webhook only holds up the generator that marks.
+func (r *recorder) mark(t time.Time, event string, details map[string]interface{}) {
+	r.note(t, event, details)
+	if err := r.incidents.notify(t, event, details); err != nil {
+		fmt.Fprintln(os.Stderr, "announcing incident:", err)
+	}
+}
+
+// markOnce marks event the first time it is called with key.
+func (r *recorder) markOnce(key string, t time.Time, event string, details map[string]interface{}) {
+	r.mu.Lock()
+	seen := r.marked[key]
+	r.marked[key] = true
+	r.mu.Unlock()
+	if !seen {
+		r.mark(t, event, details)
+	}
+}
+
+// note writes event to the ground truth without announcing it, for marks
+// about single entries.
+func (r *recorder) note(t time.Time, event string, details map[string]interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.record(t, event, details)
+}
+
+func (r *recorder) record(t time.Time, event string, details map[string]interface{}) {
+	if err := r.truth.mark(t, event, details); err != nil {
+		fmt.Fprintln(os.Stderr, "writing ground truth:", err)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// The streaming service is described by hand instead of generated code, as
+// it only uses well-known types:
+//
+//	service LogStream {
+//	  rpc Subscribe(google.protobuf.StringValue) returns (stream google.protobuf.StringValue);
+//	}
+//
+// The request carries the consumer's filter (see streamFilter) and every
+// response message is one generated line.
+var logStreamDesc = grpc.ServiceDesc{
+	ServiceName: "nginxloggenerator.LogStream",
+	HandlerType: (*interface{})(nil),
+	Streams: []grpc.StreamDesc{{
+		StreamName:    "Subscribe",
+		Handler:       subscribeHandler,
+		ServerStreams: true,
+	}},
+	Metadata: "logstream.proto",
+}
+
+func subscribeHandler(srv interface{}, stream grpc.ServerStream) error {
+	h := srv.(*hub)
+	req := new(wrapperspb.StringValue)
+	if err := stream.RecvMsg(req); err != nil {
+		return err
+	}
+	filter, err := parseStreamFilter(req.GetValue())
+	if err != nil {
+		return err
+	}
+
+	sub := h.subscribe(filter)
+	defer h.unsubscribe(sub)
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case line := <-sub.lines:
+			if err := stream.SendMsg(wrapperspb.String(string(line))); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// serveGRPC starts the gRPC streaming server. It returns once the address is
+// bound.
+func serveGRPC(addr string, h *hub) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("starting gRPC server: %w", err)
+	}
+	srv := grpc.NewServer()
+	srv.RegisterService(&logStreamDesc, h)
+	go srv.Serve(ln)
+	return nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// acceptEncoding returns an Accept-Encoding header typical for the client:
+// current Chromium sends zstd, other browsers stop at br, and HTTP/1.0
+// clients rarely ask for more than gzip.
+func acceptEncoding(rnd *rand.Rand, userAgent, protocol string) string {
+	switch {
+	case protocol == "HTTP/1.0":
+		if rnd.Intn(2) == 0 {
+			return ""
+		}
+		return "gzip"
+	case strings.Contains(userAgent, "Chrome/"):
+		return "gzip, deflate, br, zstd"
+	case strings.Contains(userAgent, "Mozilla/"):
+		return "gzip, deflate, br"
+	default:
+		return "gzip"
+	}
+}
+
+// contentEncoding picks the compression nginx would apply to the response:
+// only bodies of successful, compressible responses are compressed, using
+// the best encoding the client accepts.
+func contentEncoding(rnd *rand.Rand, accept, path string, status int) string {
+	if status != 200 || accept == "" {
+		return ""
+	}
+	if classifyPath(path) == staticPath && !strings.HasSuffix(path, ".css") && !strings.HasSuffix(path, ".js") {
+		// Images, fonts and media are already compressed
+		return ""
+	}
+	if strings.Contains(accept, "br") && rnd.Intn(2) == 0 {
+		return "br"
+	}
+	return "gzip"
+}
+
+// schemeAndAuthority returns the request scheme and the HTTP/2 :authority
+// pseudo-header. HTTP/2 and HTTP/3 are only spoken over TLS and always carry
+// :authority; HTTP/1.x requests have a Host header instead.
+func schemeAndAuthority(rnd *rand.Rand, protocol, host string) (string, string) {
+	if protocol == "HTTP/2.0" || protocol == "HTTP/3.0" {
+		return "https", host
+	}
+	if rnd.Intn(10) == 0 {
+		return "http", ""
+	}
+	return "https", ""
+}
+
+// framing returns the Transfer-Encoding and Content-Length nginx would send
+// with the response. Compressed bodies are always streamed, since gzip and
+// brotli drop the length; HTTP/2 and HTTP/3 frame the stream themselves and
+// never send Transfer-Encoding. Static files and error pages have a known
+// length, and CHUNKED_PERCENT of the remaining dynamic responses are streamed
+// by the upstream.
+func (g *generator) framing(e *logEntry) (string, string) {
+	if e.HTTP.StatusCode == 204 || e.HTTP.StatusCode == 304 || e.HTTP.StatusCode == 499 {
+		return "", ""
+	}
+	streamed := e.HTTP.ContentEncoding != "" ||
+		(e.HTTP.StatusCode < 300 && classifyPath(e.HTTP.URI) != staticPath && g.rng.Float64()*100 < g.cfg.ChunkedPercent)
+	switch {
+	case !streamed:
+		return "", e.HTTP.BytesSent
+	case e.HTTP.Protocol == "HTTP/1.1":
+		return "chunked", ""
+	default:
+		return "", ""
+	}
+}
+
+// httpProtocols maps the versions HTTP_PROTOCOL_MIX accepts to nginx's
+// $server_protocol.
+var httpProtocols = map[string]string{
+	"1.0": "HTTP/1.0", "1.1": "HTTP/1.1", "2": "HTTP/2.0", "2.0": "HTTP/2.0", "3": "HTTP/3.0", "3.0": "HTTP/3.0",
+}
+
+// parseProtocolMix parses "version:weight" pairs such as "1.1:60,2.0:35,3.0:5".
+// It returns nil for an empty spec.
+func parseProtocolMix(spec string) (*weighted[string], error) {
+	var mix *weighted[string]
+	for _, part := range parseEnvList(spec) {
+		version, weight, ok := strings.Cut(strings.TrimSpace(part), ":")
+		protocol, known := httpProtocols[strings.TrimPrefix(strings.ToUpper(version), "HTTP/")]
+		if !ok || !known {
+			return nil, fmt.Errorf("invalid HTTP_PROTOCOL_MIX entry %q (want version:weight, versions 1.0, 1.1, 2.0, 3.0)", part)
+		}
+		w, err := strconv.ParseFloat(weight, 64)
+		if err != nil || w < 0 {
+			return nil, fmt.Errorf("invalid weight in HTTP_PROTOCOL_MIX entry %q", part)
+		}
+		if mix == nil {
+			mix = &weighted[string]{}
+		}
+		mix.add(protocol, w)
+	}
+	if mix != nil && mix.total() == 0 {
+		return nil, fmt.Errorf("HTTP_PROTOCOL_MIX weights must not all be zero")
+	}
+	return mix, nil
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"math/rand"
+	"strings"
+)
+
+// hostVariant returns a spelling of host that refers to the same site but
+// does not compare equal to it: the apex or www subdomain counterpart, a
+// fully-qualified name with a trailing dot, or an upper-cased name.
+func hostVariant(rnd *rand.Rand, host string) string {
+	switch rnd.Intn(3) {
+	case 0:
+		if apex, ok := strings.CutPrefix(host, "www."); ok {
+			return apex
+		}
+		return "www." + host
+	case 1:
+		return host + "."
+	default:
+		return strings.ToUpper(host)
+	}
+}
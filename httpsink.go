@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// httpSink sends batches of lines to an HTTP endpoint, wrapped in the
+// configured envelope, with the configured method and extra headers.
+type httpSink struct {
+	*batcher
+	client   *http.Client
+	method   string
+	url      string
+	header   http.Header
+	envelope envelope
+}
+
+func newHTTPSink(cfg sinkConfig) (*httpSink, error) {
+	if cfg.HTTPURL == "" {
+		return nil, fmt.Errorf("HTTP_URL must be set for the http sink")
+	}
+	env, err := newEnvelope(cfg.HTTPEnvelope)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.HTTPContentType != "" {
+		env.contentType = cfg.HTTPContentType
+	}
+	switch cfg.HTTPMethod {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+	default:
+		return nil, fmt.Errorf("unsupported HTTP_METHOD %q (want POST, PUT or PATCH)", cfg.HTTPMethod)
+	}
+	header, err := parseHeaders(cfg.HTTPHeaders)
+	if err != nil {
+		return nil, err
+	}
+	client, err := newHTTPClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	s := &httpSink{
+		client:   client,
+		method:   cfg.HTTPMethod,
+		url:      cfg.HTTPURL,
+		header:   header,
+		envelope: env,
+	}
+	s.batcher = newBatcher(cfg.BatchSize, cfg.BatchInterval, s.post)
+	return s, nil
+}
+
+func (s *httpSink) post(records []record) error {
+	lines := make([][]byte, len(records))
+	for i, r := range records {
+		lines[i] = r.Line
+	}
+	body, err := s.envelope.wrap(lines)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(s.method, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", s.envelope.contentType)
+	for name, values := range s.header {
+		req.Header[name] = values
+	}
+	return doRequest(s.client, req)
+}
+
+// parseHeaders parses comma-separated "Name: value" pairs such as
+// "Authorization: Splunk 1234,X-Source: generator". Commas within a value,
+// as in Accept lists, are escaped as "\,".
+func parseHeaders(spec string) (http.Header, error) {
+	header := http.Header{}
+	if strings.TrimSpace(spec) == "" {
+		return header, nil
+	}
+	for _, part := range splitEscaped(spec) {
+		name, value, ok := strings.Cut(part, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid HTTP_HEADERS entry %q (want Name: value)", part)
+		}
+		header.Add(name, strings.TrimSpace(value))
+	}
+	return header, nil
+}
+
+// splitEscaped splits s at the commas not escaped as "\,".
+func splitEscaped(s string) []string {
+	var parts []string
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && s[i+1] == ',':
+			b.WriteByte(',')
+			i++
+		case s[i] == ',':
+			parts = append(parts, b.String())
+			b.Reset()
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return append(parts, b.String())
+}
+
+// newHTTPClient returns the client used by HTTP-based sinks, configured with
+// the shared TLS settings. Requests go through PROXY_URL when it is set and
+// through the standard HTTP_PROXY/HTTPS_PROXY/NO_PROXY variables otherwise.
+func newHTTPClient(cfg sinkConfig) (*http.Client, error) {
+	tlsConf, err := cfg.TLS.build()
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConf
+
+	if cfg.ProxyURL != "" {
+		proxyURL, err := url.Parse(cfg.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("parsing PROXY_URL: %w", err)
+		}
+		switch proxyURL.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return nil, fmt.Errorf("unsupported PROXY_URL scheme %q (want http, https, socks5 or socks5h)", proxyURL.Scheme)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	client := &http.Client{Transport: transport, Timeout: 30 * time.Second}
+
+	if cfg.OAuth2TokenURL != "" {
+		cc := clientcredentials.Config{
+			ClientID:     cfg.OAuth2ClientID,
+			ClientSecret: cfg.OAuth2ClientSecret,
+			TokenURL:     cfg.OAuth2TokenURL,
+			Scopes:       parseEnvList(cfg.OAuth2Scopes),
+		}
+		if cfg.OAuth2Audience != "" {
+			cc.EndpointParams = url.Values{"audience": {cfg.OAuth2Audience}}
+		}
+		// The token endpoint is reached with the same TLS and proxy settings;
+		// tokens are cached and refreshed shortly before they expire.
+		ctx := context.WithValue(context.Background(), oauth2.HTTPClient, client)
+		client = cc.Client(ctx)
+		client.Timeout = 30 * time.Second
+	}
+	return client, nil
+}
+
+// doRequest sends req and turns non-2xx responses into errors carrying the
+// beginning of the response body, which is usually where ingestion APIs
+// explain what they rejected.
+func doRequest(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s: %s: %s", req.Method, req.URL, resp.Status, bytes.TrimSpace(msg))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestParseHeaders(t *testing.T) {
+	tests := []struct {
+		spec string
+		want http.Header
+	}{
+		{"", http.Header{}},
+		{"Authorization: Splunk 1234,X-Source: generator", http.Header{"Authorization": {"Splunk 1234"}, "X-Source": {"generator"}}},
+		{`Accept: application/json\, text/plain;q=0.9, X-Id: a:b`, http.Header{"Accept": {"application/json, text/plain;q=0.9"}, "X-Id": {"a:b"}}},
+	}
+	for _, tt := range tests {
+		got, err := parseHeaders(tt.spec)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseHeaders(%q) = %v, %v, want %v", tt.spec, got, err, tt.want)
+		}
+	}
+	if _, err := parseHeaders("Authorization=Splunk 1234"); err == nil {
+		t.Error(`parseHeaders("Authorization=Splunk 1234") succeeded, want an error`)
+	}
+}
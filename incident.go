@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// pagerDutyEventsURL is the PagerDuty Events API v2 endpoint.
+const pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// incidentNotifier announces scenario events, the ones written to the
+// ground truth, to a webhook so that game days can check that alerting
+// fires around the synthetic signal. With the pagerduty format, *_start
+// events and one-off events such as region_failover trigger alerts and
+// *_end events resolve them.
+type incidentNotifier struct {
+	client     *http.Client
+	url        string
+	pagerDuty  bool
+	routingKey string
+	// events limits the events announced, all if empty
+	events []string
+}
+
+func newIncidentNotifier(cfg config) (*incidentNotifier, error) {
+	n := &incidentNotifier{url: cfg.IncidentWebhookURL, routingKey: cfg.PagerDutyRoutingKey, events: parseEnvList(cfg.IncidentEvents)}
+	switch cfg.IncidentWebhookFormat {
+	case "generic":
+		if n.url == "" {
+			return nil, fmt.Errorf("INCIDENT_WEBHOOK_URL must be set for the generic format")
+		}
+	case "pagerduty":
+		n.pagerDuty = true
+		if n.routingKey == "" {
+			return nil, fmt.Errorf("PAGERDUTY_ROUTING_KEY must be set for the pagerduty format")
+		}
+		if n.url == "" {
+			n.url = pagerDutyEventsURL
+		}
+	default:
+		return nil, fmt.Errorf("unknown INCIDENT_WEBHOOK_FORMAT %q (want generic or pagerduty)", cfg.IncidentWebhookFormat)
+	}
+	var err error
+	if n.client, err = newHTTPClient(cfg.Sinks); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// notify posts event, which happened at t, unless INCIDENT_EVENTS leaves it
+// out. A nil *incidentNotifier announces nothing.
+func (n *incidentNotifier) notify(t time.Time, event string, details map[string]interface{}) error {
+	if n == nil || (len(n.events) > 0 && !slices.Contains(n.events, event)) {
+		return nil
+	}
+	var body []byte
+	var err error
+	if n.pagerDuty {
+		body, err = json.Marshal(n.pagerDutyEvent(t, event, details))
+	} else {
+		body, err = json.Marshal(struct {
+			Timestamp time.Time              `json:"ts"`
+			Source    string                 `json:"source"`
+			Event     string                 `json:"event"`
+			Details   map[string]interface{} `json:"details,omitempty"`
+		}{t, "nginx-log-generator", event, details})
+	}
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return doRequest(n.client, req)
+}
+
+// pagerDutyEvent returns the Events API v2 event for a scenario event. The
+// start and end of a scenario share a dedup key, so the end resolves the
+// alert its start triggered.
+func (n *incidentNotifier) pagerDutyEvent(t time.Time, event string, details map[string]interface{}) map[string]interface{} {
+	scenario, ended := strings.CutSuffix(event, "_end")
+	scenario = strings.TrimSuffix(scenario, "_start")
+	h := fnv.New64a()
+	d, _ := json.Marshal(details)
+	h.Write(d)
+	e := map[string]interface{}{
+		"routing_key":  n.routingKey,
+		"event_action": "trigger",
+		"dedup_key":    fmt.Sprintf("nginx-log-generator/%s/%x", scenario, h.Sum64()),
+	}
+	if ended {
+		e["event_action"] = "resolve"
+		return e
+	}
+	e["payload"] = map[string]interface{}{
+		"summary":        "nginx-log-generator scenario: " + event,
+		"source":         "nginx-log-generator",
+		"severity":       "warning",
+		"timestamp":      t.Format(time.RFC3339),
+		"component":      "nginx",
+		"custom_details": details,
+	}
+	return e
+}
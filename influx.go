@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// formatInflux renders an entry in InfluxDB line protocol as a point of the
+// nginx_access measurement: status, method, host and, when present, region,
+// pod and upstream as tags, request time and size as fields, and the
+// timestamp in nanoseconds.
+func formatInflux(e *logEntry) ([]byte, error) {
+	b := []byte("nginx_access")
+	tag := func(key, value string) {
+		// Line protocol has no empty tag values
+		if value != "" {
+			b = fmt.Appendf(b, ",%s=%s", key, influxTagEscaper.Replace(value))
+		}
+	}
+	tag("host", e.HTTP.Host)
+	tag("method", e.HTTP.Method)
+	if e.Kubernetes != nil {
+		tag("pod", e.Kubernetes.PodName)
+		tag("region", e.Kubernetes.Region)
+	}
+	tag("sink", e.Sink)
+	tag("status", strconv.Itoa(e.HTTP.StatusCode))
+	tag("upstream", e.Nginx.ProxyUpstreamName)
+
+	b = fmt.Appendf(b, " request_time=%s", strconv.FormatFloat(float64(e.HTTP.RequestTime), 'f', -1, 32))
+	if n, err := strconv.Atoi(e.HTTP.BytesSent); err == nil {
+		b = fmt.Appendf(b, ",bytes_sent=%di", n)
+	}
+	b = fmt.Appendf(b, `,request_id="%s",uri="%s",remote_addr="%s"`,
+		influxStringEscaper.Replace(e.HTTP.RequestID), influxStringEscaper.Replace(e.HTTP.URI),
+		influxStringEscaper.Replace(e.Nginx.RemoteAddr))
+	return fmt.Appendf(b, " %d", e.Timestamp.UnixNano()), nil
+}
+
+var (
+	influxTagEscaper    = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", "")
+	influxStringEscaper = strings.NewReplacer(`"`, `\"`, `\`, `\\`, "\n", `\n`)
+)
+
+// influxSink writes access entries to the InfluxDB v2 write API, which
+// Telegraf's influxdb_v2_listener also serves. It renders entries in line
+// protocol whatever OUTPUT_FORMAT is, and drops the lines that are not
+// entries, such as controller events and stack traces.
+type influxSink struct {
+	*batcher
+	client *http.Client
+	url    string
+	token  string
+}
+
+func newInfluxSink(cfg sinkConfig) (*influxSink, error) {
+	if cfg.InfluxBucket == "" {
+		return nil, fmt.Errorf("INFLUX_BUCKET must be set for the influxdb sink")
+	}
+	client, err := newHTTPClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	query := url.Values{"bucket": {cfg.InfluxBucket}, "precision": {"ns"}}
+	if cfg.InfluxOrg != "" {
+		query.Set("org", cfg.InfluxOrg)
+	}
+	s := &influxSink{
+		client: client,
+		url:    strings.TrimSuffix(cfg.InfluxURL, "/") + "/api/v2/write?" + query.Encode(),
+		token:  cfg.InfluxToken,
+	}
+	s.batcher = newBatcher(cfg.BatchSize, cfg.BatchInterval, s.write)
+	return s, nil
+}
+
+func (s *influxSink) write(records []record) error {
+	var body bytes.Buffer
+	for _, r := range records {
+		if r.Entry == nil {
+			continue
+		}
+		line, err := formatInflux(r.Entry)
+		if err != nil {
+			return err
+		}
+		body.Write(line)
+		body.WriteByte('\n')
+	}
+	if body.Len() == 0 {
+		return nil
+	}
+	req, err := http.NewRequest(http.MethodPost, s.url, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Token "+s.token)
+	}
+	return doRequest(s.client, req)
+}
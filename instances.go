@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// instance is one logical generator run by the process.
+type instance struct {
+	name string
+	cfg  config
+}
+
+// instanceConfigs returns the instances listed in INSTANCES. Each one sees the
+// process environment overlaid with its INSTANCE_<NAME>_* variables, prefix
+// stripped, so INSTANCE_API_RATE=50 sets RATE for the "api" instance only.
+func instanceConfigs(names string) ([]instance, error) {
+	base, err := processEnviron()
+	if err != nil {
+		return nil, err
+	}
+
+	var instances []instance
+	seen := map[string]bool{}
+	for _, name := range parseEnvList(names) {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			return nil, fmt.Errorf("INSTANCES must list distinct, non-empty names")
+		}
+		seen[name] = true
+
+		environ := overlay(base, "INSTANCE_"+envName(name)+"_")
+		// Instances cannot nest, and the servers are shared
+		delete(environ, "INSTANCES")
+		delete(environ, "ADMIN_ADDR")
+		delete(environ, "GRPC_ADDR")
+
+		cfg, err := parseConfig(environ)
+		if err != nil {
+			return nil, fmt.Errorf("instance %s: %w", name, err)
+		}
+		// Each instance draws from its own stream, so it can be regenerated
+		// alone with INSTANCES=<name> and the same SEED
+		cfg.RNGStream = strings.TrimPrefix(cfg.RNGStream+"/"+name, "/")
+		instances = append(instances, instance{name, cfg})
+	}
+	return instances, nil
+}
+
+// environMap returns the process environment as a map.
+func environMap() map[string]string {
+	m := map[string]string{}
+	for _, kv := range os.Environ() {
+		k, v, _ := strings.Cut(kv, "=")
+		m[k] = v
+	}
+	return m
+}
+
+// overlay returns a copy of base in which every variable starting with
+// prefix also sets the variable named by the rest of its name.
+func overlay(base map[string]string, prefix string) map[string]string {
+	m := make(map[string]string, len(base))
+	for k, v := range base {
+		m[k] = v
+	}
+	for k, v := range base {
+		if strings.HasPrefix(k, prefix) {
+			m[strings.TrimPrefix(k, prefix)] = v
+		}
+	}
+	return m
+}
+
+// envName turns a name such as "blue-green" into its variable form BLUE_GREEN.
+func envName(name string) string {
+	return strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// run starts the configured instances, or a single unnamed one without
+// INSTANCES, and the admin server. It returns when every instance has
+// finished, or as soon as one of them fails.
+func run(cfg config) error {
+	instances := []instance{{"", cfg}}
+	if cfg.Instances != "" {
+		var err error
+		if instances, err = instanceConfigs(cfg.Instances); err != nil {
+			return err
+		}
+	}
+
+	runners := make([]*runner, len(instances))
+	for i, inst := range instances {
+		r, err := newRunner(inst.cfg)
+		if err != nil {
+			if inst.name != "" {
+				err = fmt.Errorf("instance %s: %w", inst.name, err)
+			}
+			return err
+		}
+		r.name = inst.name
+		r.stats.Instance = inst.name
+		runners[i] = r
+	}
+	if cfg.AdminAddr != "" || cfg.GRPCAddr != "" {
+		h := newHub()
+		var pull *pullBuffer
+		if cfg.PullBuffer > 0 {
+			pull = newPullBuffer(cfg.PullBuffer)
+		}
+		for _, r := range runners {
+			r.accessSink = &hubSink{next: r.accessSink, hub: h, instance: r.name}
+			if pull != nil {
+				r.accessSink = &pullSink{next: r.accessSink, buf: pull}
+			}
+		}
+		if cfg.AdminAddr != "" {
+			if err := serveAdmin(cfg.AdminAddr, runners, h, pull); err != nil {
+				return err
+			}
+		}
+		if cfg.GRPCAddr != "" {
+			if err := serveGRPC(cfg.GRPCAddr, h); err != nil {
+				return err
+			}
+		}
+	}
+
+	if cfg.Interactive {
+		go console(os.Stdin, os.Stderr, runners)
+	}
+	if cfg.TUI {
+		dash, err := newDashboard(cfg, runners)
+		if err != nil {
+			return err
+		}
+		dash.start()
+		defer dash.stop()
+	}
+
+	errs := make(chan error, len(runners))
+	for _, r := range runners {
+		go func(r *runner) {
+			err := r.backfillOrLive()
+			if err != nil && r.name != "" {
+				err = fmt.Errorf("instance %s: %w", r.name, err)
+			}
+			errs <- err
+		}(r)
+	}
+	for range runners {
+		if err := <-errs; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// journaldSink sends records to systemd-journald using its native protocol:
+// one datagram per entry on the journal socket, carrying KEY=value fields.
+type journaldSink struct {
+	conn       *net.UnixConn
+	identifier string
+}
+
+func newJournaldSink(cfg sinkConfig) (*journaldSink, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: cfg.JournalSocket, Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("connecting to journald: %w", err)
+	}
+	return &journaldSink{conn: conn, identifier: cfg.JournalIdentifier}, nil
+}
+
+func (s *journaldSink) Send(r record) error {
+	var b bytes.Buffer
+	writeJournalField(&b, "MESSAGE", string(r.Line))
+	writeJournalField(&b, "SYSLOG_IDENTIFIER", s.identifier)
+
+	priority := 6
+	if e := r.Entry; e != nil {
+		switch {
+		case e.HTTP.StatusCode >= 500:
+			priority = 3
+		case e.HTTP.StatusCode >= 400:
+			priority = 4
+		}
+		writeJournalField(&b, "HTTP_REQUEST_ID", e.HTTP.RequestID)
+		writeJournalField(&b, "HTTP_METHOD", e.HTTP.Method)
+		writeJournalField(&b, "HTTP_STATUS_CODE", strconv.Itoa(e.HTTP.StatusCode))
+		writeJournalField(&b, "HTTP_HOST", e.HTTP.Host)
+		writeJournalField(&b, "HTTP_URI", e.HTTP.URI)
+		writeJournalField(&b, "HTTP_USER_AGENT", e.HTTP.UserAgent)
+		writeJournalField(&b, "HTTP_REQUEST_TIME", strconv.FormatFloat(float64(e.HTTP.RequestTime), 'f', 3, 32))
+		writeJournalField(&b, "HTTP_BYTES_SENT", e.HTTP.BytesSent)
+		writeJournalField(&b, "NGINX_REMOTE_ADDR", e.Nginx.RemoteAddr)
+	}
+	writeJournalField(&b, "PRIORITY", strconv.Itoa(priority))
+
+	_, err := s.conn.Write(b.Bytes())
+	return err
+}
+
+func (s *journaldSink) Close() error {
+	return s.conn.Close()
+}
+
+// writeJournalField appends a field in the journal export format. Values
+// containing newlines use the binary-safe form: the name, a newline, the
+// little-endian 64-bit length and the raw value.
+func writeJournalField(b *bytes.Buffer, name, value string) {
+	if !strings.Contains(value, "\n") {
+		fmt.Fprintf(b, "%s=%s\n", name, value)
+		return
+	}
+	b.WriteString(name)
+	b.WriteByte('\n')
+	binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	b.WriteString(value)
+	b.WriteByte('\n')
+}
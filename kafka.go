@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// topicRoute sends access entries whose status matches to topic.
+type topicRoute struct {
+	match func(code int) bool
+	topic string
+}
+
+// parseTopicRoutes parses ordered "condition=topic" rules such as
+// ">=500=errors,4xx=client-errors"; the first matching rule wins.
+func parseTopicRoutes(spec string) ([]topicRoute, error) {
+	var routes []topicRoute
+	for _, part := range parseEnvList(spec) {
+		cond, topic, err := cutRule(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid KAFKA_TOPIC_ROUTES rule %q: %w", part, err)
+		}
+		match, err := statusCondition(cond)
+		if err != nil {
+			return nil, fmt.Errorf("invalid KAFKA_TOPIC_ROUTES rule %q: %w", part, err)
+		}
+		routes = append(routes, topicRoute{match, topic})
+	}
+	return routes, nil
+}
+
+// newKeyTemplate compiles a key or header template: Go template syntax over
+// the entry, such as "{{.HTTP.Host}}", or nginx variables, such as
+// "$host:$status".
+func newKeyTemplate(spec string) (formatter, error) {
+	if !strings.Contains(spec, "{{") {
+		return newTemplateFormatter(spec)
+	}
+	tmpl, err := template.New("").Option("missingkey=error").Parse(spec)
+	if err != nil {
+		return nil, err
+	}
+	// Catch unknown fields now rather than on the first record
+	if err := tmpl.Execute(io.Discard, &logEntry{}); err != nil {
+		return nil, err
+	}
+	return func(e *logEntry) ([]byte, error) {
+		var b bytes.Buffer
+		err := tmpl.Execute(&b, e)
+		return b.Bytes(), err
+	}, nil
+}
+
+// kafkaHeader is a record header with a fixed value, or one rendered from
+// each access entry when value is set.
+type kafkaHeader struct {
+	name  string
+	fixed string
+	value formatter
+}
+
+// parseKafkaHeaders parses "name=value" pairs such as
+// "tenant=acme,schema-version=2,host={{.HTTP.Host}}".
+func parseKafkaHeaders(spec string) ([]kafkaHeader, error) {
+	var headers []kafkaHeader
+	for _, part := range parseEnvList(spec) {
+		name, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid KAFKA_HEADERS entry %q (want name=value)", part)
+		}
+		h := kafkaHeader{name: name, fixed: value}
+		if strings.Contains(value, "{{") || strings.Contains(value, "$") {
+			var err error
+			if h.value, err = newKeyTemplate(value); err != nil {
+				return nil, fmt.Errorf("KAFKA_HEADERS %s: %w", name, err)
+			}
+		}
+		headers = append(headers, h)
+	}
+	return headers, nil
+}
+
+// kafkaSink produces records to Kafka. Access entries go to the topic of the
+// first KAFKA_TOPIC_ROUTES rule their status matches, everything else to
+// KAFKA_TOPIC. Records are produced asynchronously; a failure is reported by
+// the next Send or Flush.
+//
+// KAFKA_DELIVERY picks the broker-level guarantee: at-least-once may write
+// duplicates when produce requests are retried, idempotent (the default) lets
+// the broker drop them, and transactional also commits each batch atomically,
+// so read_committed consumers see all of a batch or none of it.
+type kafkaSink struct {
+	client *kgo.Client
+	topic  string
+	routes []topicRoute
+	// key renders the record key from an entry, nil for unkeyed records
+	key     formatter
+	headers []kafkaHeader
+	// txn batches records into transactions, nil unless transactional
+	txn *batcher
+
+	mu  sync.Mutex
+	err error
+}
+
+func newKafkaSink(cfg sinkConfig) (*kafkaSink, error) {
+	routes, err := parseTopicRoutes(cfg.KafkaTopicRoutes)
+	if err != nil {
+		return nil, err
+	}
+	s := &kafkaSink{topic: cfg.KafkaTopic, routes: routes}
+	if cfg.KafkaKey != "" {
+		if s.key, err = newKeyTemplate(cfg.KafkaKey); err != nil {
+			return nil, fmt.Errorf("KAFKA_KEY: %w", err)
+		}
+	}
+	if s.headers, err = parseKafkaHeaders(cfg.KafkaHeaders); err != nil {
+		return nil, err
+	}
+
+	opts := []kgo.Opt{
+		kgo.SeedBrokers(parseEnvList(cfg.KafkaBrokers)...),
+		kgo.ProducerLinger(cfg.BatchInterval),
+		kgo.ProducerBatchCompression(kgo.SnappyCompression(), kgo.NoCompression()),
+		// Fail rather than buffer forever when the brokers are unreachable
+		kgo.RecordDeliveryTimeout(30 * time.Second),
+	}
+	switch cfg.KafkaDelivery {
+	case "at-least-once":
+		opts = append(opts, kgo.DisableIdempotentWrite())
+	case "idempotent":
+	case "transactional":
+		opts = append(opts, kgo.TransactionalID(cfg.KafkaTransactionalID))
+		s.txn = newBatcher(cfg.BatchSize, cfg.BatchInterval, s.commit)
+	default:
+		return nil, fmt.Errorf("unknown KAFKA_DELIVERY %q (want at-least-once, idempotent or transactional)", cfg.KafkaDelivery)
+	}
+	if cfg.KafkaTLS {
+		conf, err := cfg.TLS.build()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, kgo.DialTLSConfig(conf))
+	}
+	if s.client, err = kgo.NewClient(opts...); err != nil {
+		return nil, fmt.Errorf("creating kafka client: %w", err)
+	}
+	return s, nil
+}
+
+// topicFor returns the topic an entry is routed to.
+func (s *kafkaSink) topicFor(e *logEntry) string {
+	if e != nil {
+		for _, route := range s.routes {
+			if route.match(e.HTTP.StatusCode) {
+				return route.topic
+			}
+		}
+	}
+	return s.topic
+}
+
+func (s *kafkaSink) Send(r record) error {
+	if s.txn != nil {
+		return s.txn.Send(r)
+	}
+	return s.produce(r)
+}
+
+// commit produces records in one transaction.
+func (s *kafkaSink) commit(records []record) error {
+	ctx := context.Background()
+	if err := s.client.BeginTransaction(); err != nil {
+		return err
+	}
+	for _, r := range records {
+		if err := s.produce(r); err != nil {
+			s.client.AbortBufferedRecords(ctx)
+			return errors.Join(err, s.client.EndTransaction(ctx, kgo.TryAbort))
+		}
+	}
+	err := errors.Join(s.client.Flush(ctx), s.failure())
+	end := kgo.TryCommit
+	if err != nil {
+		end = kgo.TryAbort
+	}
+	return errors.Join(err, s.client.EndTransaction(ctx, end))
+}
+
+func (s *kafkaSink) produce(r record) error {
+	if err := s.failure(); err != nil {
+		return err
+	}
+	rec := &kgo.Record{Topic: s.topicFor(r.Entry), Value: r.Line, Timestamp: r.Time}
+	if s.key != nil && r.Entry != nil {
+		key, err := s.key(r.Entry)
+		if err != nil {
+			return fmt.Errorf("rendering KAFKA_KEY: %w", err)
+		}
+		rec.Key = key
+	}
+	for _, h := range s.headers {
+		if h.value == nil {
+			rec.Headers = append(rec.Headers, kgo.RecordHeader{Key: h.name, Value: []byte(h.fixed)})
+			continue
+		}
+		if r.Entry == nil {
+			continue
+		}
+		value, err := h.value(r.Entry)
+		if err != nil {
+			return fmt.Errorf("rendering KAFKA_HEADERS %s: %w", h.name, err)
+		}
+		rec.Headers = append(rec.Headers, kgo.RecordHeader{Key: h.name, Value: value})
+	}
+	s.client.Produce(context.Background(), rec, func(rec *kgo.Record, err error) {
+		if err != nil {
+			s.mu.Lock()
+			if s.err == nil {
+				s.err = fmt.Errorf("producing to %s: %w", rec.Topic, err)
+			}
+			s.mu.Unlock()
+		}
+	})
+	return nil
+}
+
+func (s *kafkaSink) failure() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+func (s *kafkaSink) Flush() error {
+	if s.txn != nil {
+		return s.txn.Flush()
+	}
+	if err := s.client.Flush(context.Background()); err != nil {
+		return err
+	}
+	return s.failure()
+}
+
+func (s *kafkaSink) Close() error {
+	var err error
+	if s.txn != nil {
+		err = s.txn.Close()
+	} else {
+		err = s.Flush()
+	}
+	s.client.Close()
+	return err
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"math"
+)
+
+// latencyModel draws request times from a log-normal distribution with the
+// configured median and 99th percentile, the usual shape of web latencies:
+// most requests are fast and a long tail is not.
+type latencyModel struct {
+	mu, sigma float64
+}
+
+func newLatencyModel(median, p99 float64) (*latencyModel, error) {
+	if median <= 0 || p99 < median {
+		return nil, errors.New("LATENCY_MEDIAN must be positive and LATENCY_P99 at least LATENCY_MEDIAN")
+	}
+	return &latencyModel{mu: math.Log(median), sigma: math.Log(p99/median) / z99}, nil
+}
+
+// requestTime returns the request time of the next entry in seconds.
+func (g *generator) requestTime() float32 {
+	if g.latency == nil {
+		return g.faker.Float32Range(0.001, 2.000)
+	}
+	t := math.Exp(g.latency.mu + g.latency.sigma*g.rng.NormFloat64())
+	// nginx reports milliseconds
+	return float32(max(math.Round(t*1000), 1) / 1000)
+}
+
+// correlateLatency adjusts a request time t to the response, as with
+// RESPONSE_CORRELATION: redirects, cache revalidations and rejected requests
+// return early, static assets are served fast, and server errors are slower,
+// 504s and some other 5xx waiting out UPSTREAM_TIMEOUT.
+func (g *generator) correlateLatency(t float32, statusCode int, path string) float32 {
+	timeout := float32(g.cfg.UpstreamTimeout.Seconds())
+	switch {
+	case statusCode == 504 || (statusCode >= 500 && g.rng.Float64() < 0.1):
+		return timeout + float32(math.Round(g.rng.Float64()*50)/1000)
+	case statusCode >= 500:
+		t *= float32(1.2 + g.rng.Float64()*0.8)
+	case statusCode == 499:
+		// The client gave up, which it does after a while
+		t *= float32(1 + g.rng.Float64()*2)
+	case statusCode >= 300:
+		t *= 0.3
+	case classifyPath(path) == staticPath:
+		t *= 0.5
+	}
+	return min(float32(max(math.Round(float64(t)*1000), 1)/1000), timeout)
+}
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bufio"
+	"crypto/hmac"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// combinedLine matches nginx's combined format, optionally followed by more
+// fields of which the last one, if numeric, is taken as the request time.
+var combinedLine = regexp.MustCompile(`^(\S+) \S+ (\S+) \[([^\]]+)\] "(\S+) (\S+)[^"]*" (\d{3}) \S+ "[^"]*" "([^"]*)"(.*)$`)
+
+// observation is what learn reads from one access log line.
+type observation struct {
+	time        time.Time
+	method      string
+	uri         string
+	host        string
+	status      int
+	requestTime float64
+	userAgent   string
+	remoteAddr  string
+	remoteUser  string
+}
+
+// parseObservation reads a line in this generator's JSON format or in
+// nginx's combined format.
+func parseObservation(line string) (observation, bool) {
+	if strings.HasPrefix(line, "{") {
+		var e logEntry
+		if json.Unmarshal([]byte(line), &e) != nil || e.HTTP.StatusCode == 0 {
+			return observation{}, false
+		}
+		return observation{e.Timestamp, e.HTTP.Method, e.HTTP.URI, e.HTTP.Host, e.HTTP.StatusCode, float64(e.HTTP.RequestTime), e.HTTP.UserAgent, e.Nginx.RemoteAddr, e.Nginx.RemoteUser}, true
+	}
+
+	m := combinedLine.FindStringSubmatch(line)
+	if m == nil {
+		return observation{}, false
+	}
+	t, err := time.Parse(timeLocalLayout, m[3])
+	if err != nil {
+		return observation{}, false
+	}
+	o := observation{time: t, remoteAddr: m[1], method: m[4], uri: m[5], userAgent: m[7]}
+	if m[2] != "-" {
+		o.remoteUser = m[2]
+	}
+	o.status, _ = strconv.Atoi(m[6])
+	if rest := strings.Fields(m[8]); len(rest) > 0 {
+		o.requestTime, _ = strconv.ParseFloat(rest[len(rest)-1], 64)
+	}
+	return o, true
+}
+
+// userAgentClass sorts a User-Agent into a USER_AGENT_MIX class.
+func userAgentClass(ua string) string {
+	lower := strings.ToLower(ua)
+	switch {
+	case strings.Contains(lower, "bot") || strings.Contains(lower, "spider") || strings.Contains(lower, "crawl"):
+		return "bot"
+	case !strings.HasPrefix(ua, "Mozilla/"):
+		return "client"
+	case strings.Contains(ua, "Mobile") || strings.Contains(ua, "Android") || strings.Contains(ua, "iPhone"):
+		return "mobile"
+	default:
+		return "browser"
+	}
+}
+
+// learnOptions control how much of the source log a learned profile
+// reveals.
+type learnOptions struct {
+	// ips is "synthetic" to replace client addresses by documentation ones
+	// or "subnet" to keep their /24 networks with made-up host parts
+	ips string
+	// users is "drop", "hash" (keyed by salt) or "keep" for remote users
+	users string
+	salt  []byte
+	// keepQuery keeps query strings in paths
+	keepQuery bool
+	// minCount drops values seen fewer times, which are the ones that can
+	// single out a client
+	minCount int
+	// epsilon adds Laplace noise of scale 1/epsilon to every count, making
+	// each distribution epsilon-differentially private; 0 disables it
+	epsilon float64
+}
+
+// profileStats accumulates the distributions learn derives a profile from.
+type profileStats struct {
+	opts       learnOptions
+	entries    int
+	first      time.Time
+	last       time.Time
+	statuses   map[string]int
+	methods    map[string]int
+	paths      map[string]int
+	hosts      map[string]int
+	classes    map[string]int
+	subnets    map[string]int
+	users      map[string]int
+	latencies  []float64
+	hourCounts [24]int
+}
+
+func newProfileStats(opts learnOptions) *profileStats {
+	return &profileStats{
+		opts:     opts,
+		subnets:  map[string]int{},
+		users:    map[string]int{},
+		statuses: map[string]int{},
+		methods:  map[string]int{},
+		paths:    map[string]int{},
+		hosts:    map[string]int{},
+		classes:  map[string]int{},
+	}
+}
+
+func (s *profileStats) add(o observation) {
+	s.entries++
+	if s.first.IsZero() || o.time.Before(s.first) {
+		s.first = o.time
+	}
+	if o.time.After(s.last) {
+		s.last = o.time
+	}
+	s.statuses[strconv.Itoa(o.status)]++
+	s.methods[o.method]++
+	// Query strings are left out unless asked for: they carry tokens and
+	// IDs, not shape
+	path := o.uri
+	if !s.opts.keepQuery {
+		path, _, _ = strings.Cut(path, "?")
+	}
+	if !strings.Contains(path, ",") {
+		s.paths[path]++
+	}
+	if o.host != "" {
+		s.hosts[o.host]++
+	}
+	s.classes[userAgentClass(o.userAgent)]++
+	if s.opts.ips == "subnet" {
+		if ip := net.ParseIP(o.remoteAddr).To4(); ip != nil {
+			s.subnets[fmt.Sprintf("%d.%d.%d", ip[0], ip[1], ip[2])]++
+		}
+	}
+	switch {
+	case s.opts.users == "drop":
+	case o.remoteUser == "":
+		s.users["-"]++
+	case s.opts.users == "hash":
+		mac := hmac.New(sha256.New, s.opts.salt)
+		mac.Write([]byte(o.remoteUser))
+		s.users["u"+hex.EncodeToString(mac.Sum(nil))[:10]]++
+	default:
+		s.users[o.remoteUser]++
+	}
+	if o.requestTime > 0 {
+		s.latencies = append(s.latencies, o.requestTime)
+	}
+	s.hourCounts[o.time.Hour()]++
+}
+
+// privatize applies the noise and the minimum count of the options to a
+// distribution.
+func (s *profileStats) privatize(counts map[string]int) map[string]int {
+	out := make(map[string]int, len(counts))
+	for v, n := range counts {
+		if s.opts.epsilon > 0 {
+			n = int(math.Round(float64(n) + laplace(1/s.opts.epsilon)))
+		}
+		if n >= max(s.opts.minCount, 1) {
+			out[v] = n
+		}
+	}
+	return out
+}
+
+// laplace draws from a Laplace distribution centred on 0 with scale b.
+func laplace(b float64) float64 {
+	u := rng.Float64() - 0.5
+	if u < 0 {
+		return b * math.Log(1+2*u)
+	}
+	return -b * math.Log(1-2*u)
+}
+
+// weightedList renders counts as a list in which every value is repeated in
+// proportion to its count, which is how list variables express weights.
+// Only the limit most frequent values are kept.
+func weightedList(counts map[string]int, limit, slots int) string {
+	values := make([]string, 0, len(counts))
+	total := 0
+	for v, n := range counts {
+		values = append(values, v)
+		total += n
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if counts[values[i]] != counts[values[j]] {
+			return counts[values[i]] > counts[values[j]]
+		}
+		return values[i] < values[j]
+	})
+	if len(values) > limit {
+		values = values[:limit]
+	}
+	var list []string
+	for _, v := range values {
+		reps := max(1, int(math.Round(float64(counts[v])/float64(total)*float64(slots))))
+		for i := 0; i < reps; i++ {
+			list = append(list, v)
+		}
+	}
+	return strings.Join(list, ",")
+}
+
+// write prints the profile as KEY=value lines for CONFIG_FILE.
+func (s *profileStats) write(w io.Writer, pathLimit int) {
+	span := s.last.Sub(s.first).Seconds()
+	fmt.Fprintf(w, "# Learned from %d entries between %s and %s\n", s.entries, s.first.Format(time.RFC3339), s.last.Format(time.RFC3339))
+	if span > 0 {
+		rate := float64(s.entries) / span
+		fmt.Fprintf(w, "RATE=%.4g\n", rate)
+
+		// Hours of the day seen several times count proportionally; hours
+		// never covered by the log keep the average rate
+		var seen [24]float64
+		for t := s.first.Truncate(time.Hour); t.Before(s.last); t = t.Add(time.Hour) {
+			from, to := t, t.Add(time.Hour)
+			if from.Before(s.first) {
+				from = s.first
+			}
+			if to.After(s.last) {
+				to = s.last
+			}
+			seen[t.Hour()] += to.Sub(from).Seconds()
+		}
+		factors := make([]string, 24)
+		for h := range factors {
+			f := 1.0
+			if seen[h] >= 60 {
+				f = float64(s.hourCounts[h]) / seen[h] / rate
+			}
+			factors[h] = strconv.FormatFloat(f, 'f', 2, 64)
+		}
+		fmt.Fprintf(w, "HOURLY_RATE_FACTORS=%s\n", strings.Join(factors, ","))
+	}
+
+	fmt.Fprintf(w, "STATUS_CODES=%s\n", weightedList(s.privatize(s.statuses), 30, 100))
+	fmt.Fprintf(w, "HTTP_METHODS=%s\n", weightedList(s.privatize(s.methods), 10, 50))
+	fmt.Fprintf(w, "PATHS=%s\n", weightedList(s.privatize(s.paths), pathLimit, 4*pathLimit))
+	if hosts := s.privatize(s.hosts); len(hosts) > 0 {
+		fmt.Fprintf(w, "HOSTS=%s\n", weightedList(hosts, 20, 40))
+	} else {
+		fmt.Fprintln(w, "# The log has no host field")
+		fmt.Fprintln(w, "HOSTS=example.com")
+	}
+
+	classes := make([]string, 0, len(s.classes))
+	for class, n := range s.privatize(s.classes) {
+		classes = append(classes, fmt.Sprintf("%s:%d", class, n))
+	}
+	sort.Strings(classes)
+	fmt.Fprintf(w, "USER_AGENT_MIX=%s\n", strings.Join(classes, ","))
+
+	if len(s.latencies) > 0 {
+		sort.Float64s(s.latencies)
+		median := s.latencies[len(s.latencies)/2]
+		p99 := s.latencies[min(len(s.latencies)-1, len(s.latencies)*99/100)]
+		fmt.Fprintf(w, "LATENCY_MEDIAN=%.3f\nLATENCY_P99=%.3f\n", max(median, 0.001), max(p99, median, 0.001))
+	}
+
+	users := s.privatize(s.users)
+	if _, anonymous := users["-"]; len(users) > 0 && !(anonymous && len(users) == 1) {
+		fmt.Fprintf(w, "REMOTE_USERS=%s\n", weightedList(users, 50, 200))
+	}
+
+	// Client addresses are never copied: documentation ranges stand in, or
+	// made-up hosts in the networks clients came from
+	var ips []string
+	if subnets := s.privatize(s.subnets); len(subnets) > 0 {
+		fmt.Fprintln(w, "# Client /24 networks with synthetic host addresses")
+		for i, subnet := range strings.Split(weightedList(subnets, 50, 200), ",") {
+			ips = append(ips, fmt.Sprintf("%s.%d", subnet, 1+i%254))
+		}
+	} else {
+		fmt.Fprintln(w, "# Synthetic client addresses from the documentation ranges")
+		for i := 1; i <= 50; i++ {
+			ips = append(ips, fmt.Sprintf("%s.%d", []string{"192.0.2", "198.51.100", "203.0.113"}[i%3], i))
+		}
+	}
+	fmt.Fprintf(w, "IP_ADDRESSES=%s\n", strings.Join(ips, ","))
+}
+
+// runLearn derives a profile from an access log.
+func runLearn(cfg config, args []string) error {
+	fs := flag.NewFlagSet("learn", flag.ExitOnError)
+	in := fs.String("in", "-", "access log to read, - for stdin")
+	out := fs.String("out", "-", "profile file to write, - for stdout")
+	pathLimit := fs.Int("paths", 50, "number of most frequent paths to keep")
+	var opts learnOptions
+	fs.StringVar(&opts.ips, "ips", "synthetic", "client addresses: synthetic, or subnet to keep their /24 networks")
+	fs.StringVar(&opts.users, "users", "drop", "remote users: drop, hash or keep")
+	salt := fs.String("salt", "", "key for -users hash; random when empty, so hashes differ between runs")
+	fs.BoolVar(&opts.keepQuery, "keep-query", false, "keep query strings in paths")
+	fs.IntVar(&opts.minCount, "min-count", 1, "leave out values seen fewer times")
+	fs.Float64Var(&opts.epsilon, "epsilon", 0, "differential privacy budget per distribution; adds Laplace noise to counts when > 0")
+	fs.Parse(args)
+
+	switch {
+	case opts.ips != "synthetic" && opts.ips != "subnet":
+		return fmt.Errorf("-ips must be synthetic or subnet")
+	case opts.users != "drop" && opts.users != "hash" && opts.users != "keep":
+		return fmt.Errorf("-users must be drop, hash or keep")
+	case opts.epsilon < 0:
+		return fmt.Errorf("-epsilon must not be negative")
+	}
+	opts.salt = []byte(*salt)
+	if *salt == "" {
+		opts.salt = make([]byte, 32)
+		crand.Read(opts.salt)
+	}
+
+	var r io.Reader = os.Stdin
+	if *in != "-" {
+		f, err := os.Open(*in)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	stats := newProfileStats(opts)
+	skipped := 0
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		o, ok := parseObservation(scanner.Text())
+		if !ok {
+			skipped++
+			continue
+		}
+		stats.add(o)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if stats.entries == 0 {
+		return fmt.Errorf("no access log lines recognized (want JSON or combined format)")
+	}
+	if skipped > 0 {
+		fmt.Fprintf(os.Stderr, "learn: skipped %d unrecognized lines\n", skipped)
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "-" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	stats.write(w, *pathLimit)
+	return nil
+}
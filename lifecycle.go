@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// runNotifier announces the start and end of a run to a webhook, so that
+// long unattended backfills report when they begin, finish or fail. The
+// start carries a summary of the configuration, the end the run's stats.
+type runNotifier struct {
+	client *http.Client
+	url    string
+	slack  bool
+}
+
+func newRunNotifier(cfg config) (*runNotifier, error) {
+	n := &runNotifier{url: cfg.RunWebhookURL}
+	switch cfg.RunWebhookFormat {
+	case "generic":
+	case "slack":
+		n.slack = true
+	default:
+		return nil, fmt.Errorf("unknown RUN_WEBHOOK_FORMAT %q (want generic or slack)", cfg.RunWebhookFormat)
+	}
+	var err error
+	if n.client, err = newHTTPClient(cfg.Sinks); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// runSummary lists the settings that tell runs apart in a notification.
+func runSummary(cfg config) map[string]string {
+	s := map[string]string{
+		"mode":   "live",
+		"rate":   fmt.Sprint(float64(cfg.Rate)),
+		"sink":   cfg.Sink,
+		"format": cfg.OutputFormat,
+		"seed":   fmt.Sprint(rngSeed),
+	}
+	if cfg.LogFormat != "" {
+		s["format"] = "log_format"
+	} else if cfg.OutputTemplate != "" || cfg.OutputTemplateFile != "" {
+		s["format"] = "template"
+	}
+	if cfg.BackfillFrom != "" {
+		s["mode"] = "backfill"
+		s["from"] = cfg.BackfillFrom
+		s["to"] = cfg.BackfillTo
+	}
+	if cfg.Profile != "" {
+		s["profile"] = cfg.Profile
+	}
+	if cfg.Count > 0 {
+		s["count"] = fmt.Sprint(cfg.Count)
+	}
+	if cfg.Duration > 0 {
+		s["duration"] = cfg.Duration.String()
+	}
+	return s
+}
+
+// notifyStart announces that r began generating. A nil *runNotifier
+// announces nothing; failures are reported without stopping the run.
+func (n *runNotifier) notifyStart(r *runner) {
+	if n == nil {
+		return
+	}
+	summary := runSummary(r.cfg)
+	text := fmt.Sprintf("nginx-log-generator%s started: %s", instanceLabel(r.name), formatSummary(summary))
+	n.post(text, map[string]interface{}{"event": "run_started", "config": summary}, r.name)
+}
+
+// notifyFinish announces that r stopped, with its stats and the error that
+// ended it, if any.
+func (n *runNotifier) notifyFinish(r *runner, runErr error) {
+	if n == nil {
+		return
+	}
+	stats, err := r.stats.marshal()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "announcing run end:", err)
+		return
+	}
+	elapsed := time.Since(r.started).Round(time.Second)
+	fields := map[string]interface{}{"event": "run_finished", "elapsed": elapsed.String(), "stats": json.RawMessage(stats)}
+	r.stats.mu.Lock()
+	text := fmt.Sprintf("nginx-log-generator%s finished after %s: %d entries, %d bytes", instanceLabel(r.name), elapsed, r.stats.Entries, r.stats.Bytes)
+	r.stats.mu.Unlock()
+	if runErr != nil {
+		fields["event"] = "run_failed"
+		fields["error"] = runErr.Error()
+		text = fmt.Sprintf("nginx-log-generator%s failed after %s: %v", instanceLabel(r.name), elapsed, runErr)
+	}
+	n.post(text, fields, r.name)
+}
+
+func (n *runNotifier) post(text string, fields map[string]interface{}, instance string) {
+	var body []byte
+	var err error
+	if n.slack {
+		body, err = json.Marshal(map[string]string{"text": text})
+	} else {
+		fields["ts"] = time.Now().UTC()
+		fields["source"] = "nginx-log-generator"
+		if instance != "" {
+			fields["instance"] = instance
+		}
+		body, err = json.Marshal(fields)
+	}
+	if err == nil {
+		var req *http.Request
+		if req, err = http.NewRequest(http.MethodPost, n.url, bytes.NewReader(body)); err == nil {
+			req.Header.Set("Content-Type", "application/json")
+			err = doRequest(n.client, req)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "announcing run:", err)
+	}
+}
+
+func instanceLabel(name string) string {
+	if name == "" {
+		return ""
+	}
+	return " (" + name + ")"
+}
+
+// formatSummary renders a run summary as sorted key=value pairs.
+func formatSummary(s map[string]string) string {
+	pairs := make([]string, 0, len(s))
+	for k, v := range s {
+		pairs = append(pairs, k+"="+v)
+	}
+	slices.Sort(pairs)
+	return strings.Join(pairs, " ")
+}
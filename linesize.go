@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"strings"
+)
+
+// lineSizer draws target line lengths from a log-normal distribution with
+// the configured mean and 99th percentile, and fits entries to them.
+type lineSizer struct {
+	mu, sigma float64
+}
+
+// z99 is the standard normal quantile of the 99th percentile.
+const z99 = 2.3263
+
+func newLineSizer(mean, p99 int) (*lineSizer, error) {
+	if p99 == 0 || p99 == mean {
+		return &lineSizer{mu: math.Log(float64(mean))}, nil
+	}
+	// For a log-normal distribution, ln(p99/mean) = z99*sigma - sigma²/2
+	ratio := math.Log(float64(p99) / float64(mean))
+	if ratio < 0 || ratio > z99*z99/2 {
+		return nil, errors.New("LINE_SIZE_P99 must be between LINE_SIZE_MEAN and about 15 times LINE_SIZE_MEAN")
+	}
+	sigma := z99 - math.Sqrt(z99*z99-2*ratio)
+	return &lineSizer{mu: math.Log(float64(mean)) - sigma*sigma/2, sigma: sigma}, nil
+}
+
+func (s *lineSizer) target(rnd *rand.Rand) int {
+	return int(math.Round(math.Exp(s.mu + s.sigma*rnd.NormFloat64())))
+}
+
+// minUserAgent is the length user agents are never cut below, that of
+// "Mozilla/5.0"; lines still too long keep the overshoot.
+const minUserAgent = len("Mozilla/5.0")
+
+// optionalFields clear, in order, the parts of an entry many real requests
+// lack, which fit drops before cutting the user agent.
+var optionalFields = []func(e *logEntry){
+	func(e *logEntry) { e.Nginx.HTTPReferrer = "" },
+	func(e *logEntry) { e.HTTP.SecCHUA, e.HTTP.SecCHUAPlatform, e.HTTP.SecCHUAMobile = "", "", "" },
+}
+
+// fit renders e at the next target length. Short lines are padded with a
+// Cookie header of the missing size; long lines lose their optional fields,
+// then the end of their user agent down to minUserAgent. Lines that cannot
+// shrink enough keep their minimal length.
+func (s *lineSizer) fit(rnd *rand.Rand, e *logEntry, format formatter) ([]byte, error) {
+	target := s.target(rnd)
+	line, err := format(e)
+	if err != nil || len(line) == target {
+		return line, err
+	}
+
+	if len(line) > target {
+		if line, err = shrink(e, format, line, target); err != nil || len(line) >= target {
+			return line, err
+		}
+	}
+
+	// Measure what the field costs in this format, then size its value
+	e.Nginx.HTTPCookie = "a"
+	if line, err = format(e); err != nil {
+		return nil, err
+	}
+	missing := target - len(line)
+	if missing < 0 {
+		e.Nginx.HTTPCookie = ""
+		return format(e)
+	}
+	e.Nginx.HTTPCookie = cookie(rnd, 1+missing)
+	return format(e)
+}
+
+// shrink brings line, the rendering of e, down towards target, returning
+// the new rendering. Dropping a field may undershoot the target.
+func shrink(e *logEntry, format formatter, line []byte, target int) ([]byte, error) {
+	var err error
+	for _, clear := range optionalFields {
+		if len(line) <= target {
+			return line, nil
+		}
+		clear(e)
+		if line, err = format(e); err != nil {
+			return nil, err
+		}
+	}
+	if cut := len(line) - target; cut > 0 {
+		ua := e.HTTP.UserAgent
+		e.HTTP.UserAgent = ua[:max(len(ua)-cut, min(len(ua), minUserAgent))]
+		return format(e)
+	}
+	return line, nil
+}
+
+// cookie returns a Cookie header value of exactly n bytes, made of
+// analytics and session cookies.
+func cookie(rnd *rand.Rand, n int) string {
+	var b strings.Builder
+	names := []string{"_ga", "_gid", "sessionid", "csrftoken", "_fbp", "ab_test"}
+	for b.Len() < n {
+		if b.Len() > 0 {
+			b.WriteString("; ")
+		}
+		b.WriteString(names[rnd.Intn(len(names))])
+		b.WriteByte('=')
+		for i := 0; i < 32; i++ {
+			b.WriteByte("0123456789abcdef"[rnd.Intn(16)])
+		}
+	}
+	return b.String()[:n]
+}
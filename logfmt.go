@@ -0,0 +1,35 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// formatLogfmt renders the flattened fields of an entry as logfmt pairs
+// named by their JSON path, such as `http.method=GET http.uri=/login`.
+// Values that are empty or hold spaces, quotes, equals signs, backslashes
+// or unprintable characters are quoted with Go escapes.
+func formatLogfmt(e *logEntry) ([]byte, error) {
+	var b []byte
+	for i, f := range flattenEntry(e) {
+		if i > 0 {
+			b = append(b, ' ')
+		}
+		b = append(b, f.Name...)
+		b = append(b, '=')
+		if logfmtNeedsQuotes(f.Value) {
+			b = strconv.AppendQuote(b, f.Value)
+		} else {
+			b = append(b, f.Value...)
+		}
+	}
+	return b, nil
+}
+
+func logfmtNeedsQuotes(s string) bool {
+	return s == "" || strings.ContainsFunc(s, func(r rune) bool {
+		return r == ' ' || r == '=' || r == '"' || r == '\\' || r == utf8.RuneError || !unicode.IsPrint(r)
+	})
+}
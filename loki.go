@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var lokiLabelName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// lokiLabel is one label of LOKI_LABELS: either a fixed value or an nginx
+// variable, such as $host, evaluated per entry.
+type lokiLabel struct {
+	name     string
+	value    string
+	variable func(e *logEntry) string
+}
+
+// lokiVariables adds label-friendly variables to the nginx ones; $status
+// itself makes for a needlessly large number of streams. $service is the
+// simulated service a host belongs to, "shop" for shop.example.com.
+var lokiVariables = map[string]func(e *logEntry) string{
+	"status_class": func(e *logEntry) string { return strconv.Itoa(e.HTTP.StatusCode/100) + "xx" },
+	"service": func(e *logEntry) string {
+		service, _, _ := strings.Cut(strings.TrimSuffix(strings.ToLower(e.HTTP.Host), "."), ".")
+		return service
+	},
+	"trace_id": func(e *logEntry) string { return traceparentField(e.HTTP.Traceparent, 1) },
+	"span_id":  func(e *logEntry) string { return traceparentField(e.HTTP.Traceparent, 2) },
+}
+
+// traceparentField returns field i of a "version-traceid-spanid-flags"
+// traceparent, or "" for requests without one.
+func traceparentField(traceparent string, i int) string {
+	fields := strings.Split(traceparent, "-")
+	if len(fields) != 4 {
+		return ""
+	}
+	return fields[i]
+}
+
+// lokiValue returns a label for value: fixed, or a $variable.
+func lokiValue(name, value, setting string) (lokiLabel, error) {
+	label := lokiLabel{name: name, value: value}
+	if v, ok := strings.CutPrefix(value, "$"); ok {
+		if label.variable = lokiVariables[v]; label.variable == nil {
+			label.variable = nginxVariables[v]
+		}
+		if label.variable == nil {
+			return label, fmt.Errorf("unsupported variable $%s in %s", v, setting)
+		}
+	}
+	return label, nil
+}
+
+// parseLokiPairs parses "name=value" pairs such as
+// "job=nginx,namespace=prod,status_class=$status_class".
+func parseLokiPairs(spec, setting string) ([]lokiLabel, error) {
+	var labels []lokiLabel
+	for _, part := range parseEnvList(spec) {
+		name, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok || !lokiLabelName.MatchString(name) || value == "" {
+			return nil, fmt.Errorf("invalid %s entry %q (want name=value or name=$variable)", setting, part)
+		}
+		label, err := lokiValue(name, value, setting)
+		if err != nil {
+			return nil, err
+		}
+		labels = append(labels, label)
+	}
+	return labels, nil
+}
+
+// parseLokiLabels parses LOKI_LABELS, which needs at least one fixed label.
+func parseLokiLabels(spec string) ([]lokiLabel, error) {
+	labels, err := parseLokiPairs(spec, "LOKI_LABELS")
+	if err != nil {
+		return nil, err
+	}
+	fixed := false
+	for _, l := range labels {
+		fixed = fixed || l.variable == nil
+	}
+	if !fixed {
+		// Lines other than access entries would end up without any label
+		return nil, fmt.Errorf("LOKI_LABELS needs at least one fixed label, such as job=nginx")
+	}
+	sort.Slice(labels, func(i, j int) bool { return labels[i].name < labels[j].name })
+	return labels, nil
+}
+
+// lokiSink pushes batches to Loki's push API, grouping lines into streams by
+// their label set. Lines that are not access entries only carry the fixed
+// labels. Entries may carry structured metadata, such as their trace ID,
+// which Loki stores without making it a label. A $variable tenant sends each
+// entry to the tenant of its service; other lines go to LOKI_DEFAULT_TENANT.
+type lokiSink struct {
+	*batcher
+	client        *http.Client
+	url           string
+	tenant        lokiLabel
+	defaultTenant string
+	labels        []lokiLabel
+	metadata      []lokiLabel
+}
+
+func newLokiSink(cfg sinkConfig) (*lokiSink, error) {
+	labels, err := parseLokiLabels(cfg.LokiLabels)
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := parseLokiPairs(cfg.LokiMetadata, "LOKI_METADATA")
+	if err != nil {
+		return nil, err
+	}
+	tenant, err := lokiValue("tenant", cfg.LokiTenant, "LOKI_TENANT")
+	if err != nil {
+		return nil, err
+	}
+	client, err := newHTTPClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	s := &lokiSink{
+		client:        client,
+		url:           cfg.LokiURL,
+		tenant:        tenant,
+		defaultTenant: cfg.LokiDefaultTenant,
+		labels:        labels,
+		metadata:      metadata,
+	}
+	s.batcher = newBatcher(cfg.BatchSize, cfg.BatchInterval, s.push)
+	return s, nil
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	// Values are [timestamp, line] or [timestamp, line, metadata]
+	Values [][]interface{} `json:"values"`
+}
+
+// push sends records in one request per tenant.
+func (s *lokiSink) push(records []record) error {
+	var tenants []string
+	byTenant := map[string][]record{}
+	for _, r := range records {
+		tenant := s.tenant.value
+		if s.tenant.variable != nil {
+			tenant = s.defaultTenant
+			if r.Entry != nil {
+				tenant = orDefault(s.tenant.variable(r.Entry), s.defaultTenant)
+			}
+		}
+		if _, ok := byTenant[tenant]; !ok {
+			tenants = append(tenants, tenant)
+		}
+		byTenant[tenant] = append(byTenant[tenant], r)
+	}
+	for _, tenant := range tenants {
+		if err := s.pushTenant(tenant, byTenant[tenant]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *lokiSink) pushTenant(tenant string, records []record) error {
+	var streams []*lokiStream
+	byKey := map[string]*lokiStream{}
+	for _, r := range records {
+		labels := s.labelSet(r.Entry)
+		var key strings.Builder
+		for _, l := range s.labels {
+			key.WriteString(labels[l.name])
+			key.WriteByte(0)
+		}
+		st := byKey[key.String()]
+		if st == nil {
+			st = &lokiStream{Stream: labels}
+			byKey[key.String()] = st
+			streams = append(streams, st)
+		}
+		value := []interface{}{strconv.FormatInt(r.Time.UnixNano(), 10), string(r.Line)}
+		if metadata := s.metadataSet(r.Entry); len(metadata) > 0 {
+			value = append(value, metadata)
+		}
+		st.Values = append(st.Values, value)
+	}
+
+	body, err := json.Marshal(struct {
+		Streams []*lokiStream `json:"streams"`
+	}{streams})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if tenant != "" {
+		req.Header.Set("X-Scope-OrgID", tenant)
+	}
+	return doRequest(s.client, req)
+}
+
+// labelSet evaluates the labels for an entry, or only the fixed ones for
+// other lines. Empty values are left out, as Loki drops them anyway.
+func (s *lokiSink) labelSet(e *logEntry) map[string]string {
+	set := map[string]string{}
+	for _, l := range s.labels {
+		value := l.value
+		if l.variable != nil {
+			if e == nil {
+				continue
+			}
+			value = l.variable(e)
+		}
+		if value != "" {
+			set[l.name] = value
+		}
+	}
+	return set
+}
+
+// metadataSet evaluates the structured metadata of an entry, leaving out
+// empty values such as the trace ID of untraced requests.
+func (s *lokiSink) metadataSet(e *logEntry) map[string]string {
+	if e == nil || len(s.metadata) == 0 {
+		return nil
+	}
+	set := map[string]string{}
+	for _, m := range s.metadata {
+		value := m.value
+		if m.variable != nil {
+			value = m.variable(e)
+		}
+		if value != "" && value != "-" {
+			set[m.name] = value
+		}
+	}
+	return set
+}
@@ -1,19 +1,99 @@
 package main
 
 import (
-	"encoding/json"
-	"fmt"
-	"math/rand"
+	"os"
 	"strconv"
 	"strings"
 	"time"
-
-	"github.com/brianvoe/gofakeit/v6"
-	"github.com/caarlos0/env/v6"
 )
 
 type config struct {
-	Rate float32 `env:"RATE" envDefault:"1"`
+	// Access entries per second, or a count per period such as "10k/s" or "300/min"
+	Rate eventRate `env:"RATE" envDefault:"1"`
+	// uniform spaces entries evenly, poisson draws exponential gaps
+	Arrival string `env:"ARRIVAL" envDefault:"uniform"`
+	// Goroutines rendering entries in parallel, for rates a single one
+	// cannot reach
+	Workers int `env:"WORKERS" envDefault:"1"`
+	// Multipliers of the rate for each hour of the day, 24 values from
+	// midnight in TIMEZONE, or of the week, 168 values from Monday, as
+	// learned from a real log
+	HourlyRateFactors string `env:"HOURLY_RATE_FACTORS" envDefault:""`
+	// Smooth day/night curve of the rate in TIMEZONE: PEAK_FACTOR times RATE
+	// at the peak hour, TROUGH_FACTOR times twelve hours later
+	Diurnal             bool    `env:"DIURNAL" envDefault:"false"`
+	DiurnalPeakHour     float64 `env:"DIURNAL_PEAK_HOUR" envDefault:"14"`
+	DiurnalPeakFactor   float64 `env:"DIURNAL_PEAK_FACTOR" envDefault:"2"`
+	DiurnalTroughFactor float64 `env:"DIURNAL_TROUGH_FACTOR" envDefault:"0.2"`
+	// Daily traffic spikes in TIMEZONE, such as "10:00+5m@10x,14:30+2m@50x"
+	Spikes string `env:"SPIKES" envDefault:""`
+	// Ramp of the rate from RAMP_FROM to RAMP_TO over RAMP_DURATION, used
+	// instead of RATE when the duration is set; RAMP_SHAPE is linear or
+	// exponential
+	RampFrom     eventRate     `env:"RAMP_FROM" envDefault:"1"`
+	RampTo       eventRate     `env:"RAMP_TO" envDefault:"1000"`
+	RampDuration time.Duration `env:"RAMP_DURATION" envDefault:"0"`
+	RampShape    string        `env:"RAMP_SHAPE" envDefault:"linear"`
+	// Stop after COUNT access entries or DURATION of running, whichever
+	// comes first, and write the summary; 0 runs until interrupted or until
+	// the end of the backfill
+	Count    int           `env:"COUNT" envDefault:"0"`
+	Duration time.Duration `env:"DURATION" envDefault:"0"`
+
+	// Line length distribution in bytes: mean and 99th percentile. Lines are
+	// padded with a Cookie header or have their user agent shortened
+	LineSizeMean int `env:"LINE_SIZE_MEAN" envDefault:"0"`
+	LineSizeP99  int `env:"LINE_SIZE_P99" envDefault:"0"`
+
+	// Preset of paths, methods, statuses, latencies and user agents for a
+	// kind of site: blog, ecommerce, api or cdn
+	Profile string `env:"PROFILE" envDefault:""`
+
+	// KEY=value file read under the environment, and where to write the
+	// effective configuration of a run in that format
+	ConfigFile   string `env:"CONFIG_FILE" envDefault:""`
+	ExportConfig string `env:"EXPORT_CONFIG" envDefault:""`
+
+	// Output volume to hold, such as 50GB/day; the rate is adjusted to the
+	// measured size of the output and RATE only applies to the first entry
+	TargetVolume string `env:"TARGET_VOLUME" envDefault:""`
+
+	// Logical generator instances run by this process, each configured by
+	// INSTANCE_<NAME>_* variables over the shared environment
+	Instances string `env:"INSTANCES" envDefault:""`
+	// Listen address of the admin server with /metrics, /healthz and the
+	// /stream Server-Sent Events endpoint
+	AdminAddr string `env:"ADMIN_ADDR" envDefault:""`
+	// Number of recent lines kept for the admin server's /logs pull API
+	PullBuffer int `env:"PULL_BUFFER" envDefault:"0"`
+	// Listen address of the gRPC server streaming generated lines
+	GRPCAddr string `env:"GRPC_ADDR" envDefault:""`
+	// Read rate, spike and inject commands from stdin while generating
+	Interactive bool `env:"INTERACTIVE" envDefault:"false"`
+	// Terminal dashboard on stderr, redrawn every TUI_INTERVAL, with the
+	// achieved rate, status sparklines, scenario phase and sink health
+	TUI         bool          `env:"TUI" envDefault:"false"`
+	TUIInterval time.Duration `env:"TUI_INTERVAL" envDefault:"1s"`
+
+	// Output format, destination and per-sink settings
+	OutputFormat string `env:"OUTPUT_FORMAT" envDefault:"json"`
+	// nginx log_format template such as "$remote_addr [$time_local] ...",
+	// used instead of OUTPUT_FORMAT when set
+	LogFormat string `env:"LOG_FORMAT" envDefault:""`
+	// Go text/template over the log entry, with sprig-style helpers, used
+	// instead of OUTPUT_FORMAT when set; OUTPUT_TEMPLATE_FILE reads it from
+	// a file
+	OutputTemplate     string `env:"OUTPUT_TEMPLATE" envDefault:""`
+	OutputTemplateFile string `env:"OUTPUT_TEMPLATE_FILE" envDefault:""`
+	Sink               string `env:"SINK" envDefault:"stdout"`
+	Sinks              sinkConfig
+	// Processors records pass through on their way to SINK, such as
+	// "sample:10,redact:remote_addr,route:5xx=alerts"
+	Pipeline string `env:"PIPELINE" envDefault:""`
+
+	// Comparison mode: every entry goes to each of these named sinks,
+	// configured by COMPARE_<NAME>_* variables, tagged with the sink name
+	CompareSinks string `env:"COMPARE_SINKS" envDefault:""`
 
 	// Environment variables for specifying exact values
 	IPAddresses string `env:"IP_ADDRESSES" envDefault:""`
@@ -21,12 +101,266 @@ type config struct {
 	Paths       string `env:"PATHS" envDefault:""`
 	StatusCodes string `env:"STATUS_CODES" envDefault:""`
 	Hosts       string `env:"HOSTS" envDefault:""`
+
+	// Weights of individual 4xx codes used whenever a client error is drawn
+	ClientErrorWeights string `env:"CLIENT_ERROR_WEIGHTS" envDefault:""`
+	// Status codes with their percentage of requests, e.g.
+	// "200:70,301:5,404:10,500:3"; the remainder is drawn from STATUS_CODES
+	StatusWeights string `env:"STATUS_WEIGHTS" envDefault:""`
+
+	// Response sizes per status code as code:size or code:min-max entries,
+	// overriding the built-in sizes of nginx's default pages
+	BytesSentProfile string `env:"BYTES_SENT_PROFILE" envDefault:""`
+
+	// Log-normal request times with this median and 99th percentile in
+	// seconds, instead of uniform ones between 1ms and 2s
+	LatencyMedian float64 `env:"LATENCY_MEDIAN" envDefault:"0"`
+	LatencyP99    float64 `env:"LATENCY_P99" envDefault:"0"`
+
+	// Make request_time and bytes_sent follow the status code and path:
+	// small redirects, large static assets, mid-sized API responses, slower
+	// 5xx and 504s at UPSTREAM_TIMEOUT (nginx's proxy_read_timeout)
+	ResponseCorrelation bool          `env:"RESPONSE_CORRELATION" envDefault:"false"`
+	UpstreamTimeout     time.Duration `env:"UPSTREAM_TIMEOUT" envDefault:"60s"`
+
+	// Basic auth users of requests; "-" entries stand for anonymous ones
+	RemoteUsers string `env:"REMOTE_USERS" envDefault:""`
+
+	// Weighted value files for categorical fields as field=file pairs, e.g.
+	// "host=hosts.txt,user_agent=agents.tsv"; fields are host, path,
+	// user_agent, referrer, content_type, remote_user and upstream
+	Dictionaries string `env:"DICTIONARIES" envDefault:""`
+
+	// Weights of user agent classes (browser, mobile, bot, client)
+	UserAgentMix string `env:"USER_AGENT_MIX" envDefault:""`
+
+	// Caps on distinct values per field as field:limit[/window] entries
+	CardinalityLimits string `env:"CARDINALITY_LIMITS" envDefault:""`
+
+	// Number of distinct URIs: 0 uses PATHS as is, N > 0 expands PATHS to
+	// exactly N URIs, a negative value makes every URI unique
+	PathCardinality int `env:"PATH_CARDINALITY" envDefault:"0"`
+
+	// Fixed catalog of URIs: read from PATH_CATALOG_FILE, most popular
+	// first, or PATH_CATALOG_SIZE URIs built from PATHS or, without PATHS,
+	// from the sections of a typical site. ZIPF_S > 0 draws paths with a
+	// Zipf distribution of that exponent instead of uniformly
+	PathCatalogFile string  `env:"PATH_CATALOG_FILE" envDefault:""`
+	PathCatalogSize int     `env:"PATH_CATALOG_SIZE" envDefault:"0"`
+	ZipfS           float64 `env:"ZIPF_S" envDefault:"0"`
+
+	// Percentage of requests sent by search engine and SEO crawlers: GETs of
+	// pages, robots.txt and sitemap.xml from few IPs, without a referrer
+	BotPercent float64 `env:"BOT_PERCENT" envDefault:"0"`
+
+	// Percentage of requests carrying attacks (scans, SQL injection, path
+	// traversal, XSS, header injection) from few IPs, each recorded in
+	// GROUND_TRUTH_FILE as an "attack" event with its request ID
+	AttackPercent float64 `env:"ATTACK_PERCENT" envDefault:"0"`
+
+	// Percentage of requests whose host, URL and referrer hostnames disagree
+	HostMismatchPercent float64 `env:"HOST_MISMATCH_PERCENT" envDefault:"0"`
+
+	// Percentage of URIs re-encoded with mixed-case, double or slash escapes
+	PercentEncodingPercent float64 `env:"PERCENT_ENCODING_PERCENT" envDefault:"0"`
+
+	// Percentage of URIs replaced by an equivalent spelling (/a/b/, /a//b, /a/./b)
+	PathVariantPercent float64 `env:"PATH_VARIANT_PERCENT" envDefault:"0"`
+
+	// Restrict methods to those plausible for the path (no DELETE on images)
+	MethodPathRules bool `env:"METHOD_PATH_RULES" envDefault:"false"`
+
+	// Correlate status codes with methods and paths (201 after POST, 405, 404 clusters)
+	StatusMethodRules bool `env:"STATUS_METHOD_RULES" envDefault:"false"`
+
+	// Set the referrer to the page the same client viewed previously
+	ReferrerNavigation bool `env:"REFERRER_NAVIGATION" envDefault:"false"`
+
+	// Simulated clients browsing at once, each with a stable IP, user agent
+	// and trace_session_id: every page view of a session is followed by its
+	// assets and API calls, then by a pause of about SESSION_THINK_TIME.
+	// Sessions last about SESSION_PAGES page views
+	Sessions         int           `env:"SESSIONS" envDefault:"0"`
+	SessionPages     int           `env:"SESSION_PAGES" envDefault:"5"`
+	SessionThinkTime time.Duration `env:"SESSION_THINK_TIME" envDefault:"10s"`
+
+	// Weights of HTTP versions as version:weight pairs, e.g.
+	// "1.0:2,1.1:58,2.0:35,3.0:5"; all requests use HTTP/1.1 when empty
+	HTTPProtocolMix string `env:"HTTP_PROTOCOL_MIX" envDefault:""`
+
+	// Add sec-ch-ua client hint fields matching the User-Agent
+	ClientHints bool `env:"CLIENT_HINTS" envDefault:"false"`
+
+	// Add accept_encoding, content_encoding, scheme, authority,
+	// transfer_encoding and content_length fields
+	HeaderFields bool `env:"HEADER_FIELDS" envDefault:"false"`
+
+	// Share of uncompressed dynamic HTTP/1.1 responses sent chunked
+	ChunkedPercent float64 `env:"CHUNKED_PERCENT" envDefault:"30"`
+
+	// Add upstream_addr, upstream_status, upstream_response_time and
+	// upstream_response_length; UPSTREAM_RETRY_PERCENT of the requests
+	// reach a second upstream after a failed connection
+	UpstreamFields       bool    `env:"UPSTREAM_FIELDS" envDefault:"false"`
+	UpstreamRetryPercent float64 `env:"UPSTREAM_RETRY_PERCENT" envDefault:"2"`
+
+	// Add scheme, ssl_protocol, ssl_cipher and ssl_server_name fields, with
+	// connections split between TLS versions and plain HTTP by
+	// SSL_PROTOCOL_MIX
+	SSLFields      bool   `env:"SSL_FIELDS" envDefault:"false"`
+	SSLProtocolMix string `env:"SSL_PROTOCOL_MIX" envDefault:"tls1.3:70,tls1.2:27,http:3"`
+
+	// Percentage of requests per status class carrying a sampled traceparent
+	TraceSampling string `env:"TRACE_SAMPLING" envDefault:""`
+
+	// Simulated regions as name:pods[:latency[:cidr]] entries
+	Regions string `env:"REGIONS" envDefault:""`
+
+	// Ingress rewrite rules as name:/pattern=/target entries, like the
+	// rewrite-target annotation: matching requests also log the ingress,
+	// X-Original-URI and the rewritten upstream URI
+	IngressRewrites string `env:"INGRESS_REWRITES" envDefault:""`
+
+	// Percentage of requests arriving through proxies and a load balancer:
+	// remote_addr becomes one of XFF_LB_ADDRESSES and X-Forwarded-For lists
+	// the client and a number of proxies drawn from XFF_HOPS. XFF_REAL_IP
+	// keeps the client in remote_addr, as nginx's realip module does
+	XFFChainPercent float64 `env:"XFF_CHAIN_PERCENT" envDefault:"0"`
+	XFFHops         string  `env:"XFF_HOPS" envDefault:"0,1,1,1,2,2,3"`
+	XFFLBAddresses  string  `env:"XFF_LB_ADDRESSES" envDefault:"10.0.0.10,10.0.0.11"`
+	XFFRealIP       bool    `env:"XFF_REAL_IP" envDefault:"false"`
+
+	// Region failover scenario: the region's pods stop emitting after the delay
+	FailoverRegion string        `env:"FAILOVER_REGION" envDefault:""`
+	FailoverAfter  time.Duration `env:"FAILOVER_AFTER" envDefault:"5m"`
+
+	// Canary scenario: share of traffic served by a canary with its own profile
+	CanaryPercent       float64 `env:"CANARY_PERCENT" envDefault:"0"`
+	CanaryErrorPercent  float64 `env:"CANARY_ERROR_PERCENT" envDefault:"0"`
+	CanaryLatencyFactor float64 `env:"CANARY_LATENCY_FACTOR" envDefault:"1"`
+
+	// Blue/green cutover: all traffic switches to the green upstream at once
+	BlueGreenAt            time.Duration `env:"BLUEGREEN_AT" envDefault:"0"`
+	BlueGreenLatencyFactor float64       `env:"BLUEGREEN_LATENCY_FACTOR" envDefault:"1"`
+
+	// JSON lines file recording scenario events for scoring detectors
+	GroundTruthFile string `env:"GROUND_TRUTH_FILE" envDefault:""`
+	// Webhook announcing the same events, as generic JSON or PagerDuty
+	// Events v2 alerts; INCIDENT_EVENTS limits the events announced
+	IncidentWebhookURL    string `env:"INCIDENT_WEBHOOK_URL" envDefault:""`
+	IncidentWebhookFormat string `env:"INCIDENT_WEBHOOK_FORMAT" envDefault:"generic"`
+	IncidentEvents        string `env:"INCIDENT_EVENTS" envDefault:""`
+	PagerDutyRoutingKey   string `env:"PAGERDUTY_ROUTING_KEY" envDefault:""`
+
+	// Maintenance window: 503 for the listed hosts, then a burst of retries
+	MaintenanceHosts         string        `env:"MAINTENANCE_HOSTS" envDefault:""`
+	MaintenanceStart         time.Duration `env:"MAINTENANCE_START" envDefault:"5m"`
+	MaintenanceDuration      time.Duration `env:"MAINTENANCE_DURATION" envDefault:"10m"`
+	MaintenanceRetryFactor   float64       `env:"MAINTENANCE_RETRY_FACTOR" envDefault:"3"`
+	MaintenanceRetryDuration time.Duration `env:"MAINTENANCE_RETRY_DURATION" envDefault:"1m"`
+
+	// DDoS scenario against DDOS_PATH from DDOS_START for DDOS_DURATION: the
+	// rate ramps up to DDOS_FACTOR times over DDOS_RAMP and back down, the
+	// surplus from DDOS_IPS addresses (0 spoofs a new one per request)
+	DDoSPath     string        `env:"DDOS_PATH" envDefault:""`
+	DDoSStart    time.Duration `env:"DDOS_START" envDefault:"5m"`
+	DDoSDuration time.Duration `env:"DDOS_DURATION" envDefault:"10m"`
+	DDoSRamp     time.Duration `env:"DDOS_RAMP" envDefault:"1m"`
+	DDoSFactor   float64       `env:"DDOS_FACTOR" envDefault:"20"`
+	DDoSIPs      int           `env:"DDOS_IPS" envDefault:"50"`
+
+	// Time zone of the timestamps; TIME_BOUNDARY starts the clock BOUNDARY_LEAD
+	// before the next DST transition, month end, year end or leap day
+	Timezone     string        `env:"TIMEZONE" envDefault:""`
+	TimeBoundary string        `env:"TIME_BOUNDARY" envDefault:""`
+	BoundaryLead time.Duration `env:"BOUNDARY_LEAD" envDefault:"1m"`
+	// Speed of simulated time in live mode: at 60 an hour of timestamps,
+	// and of RATE entries per simulated second, passes in a minute
+	TimeScale float64 `env:"TIME_SCALE" envDefault:"1"`
+
+	// Backfill mode: generate the given historical range as fast as possible
+	// and exit; times without an offset are read in TIMEZONE
+	BackfillFrom string `env:"BACKFILL_FROM" envDefault:""`
+	BackfillTo   string `env:"BACKFILL_TO" envDefault:""`
+	// Backfill progress is saved here every CHECKPOINT_EVERY entries, and an
+	// interrupted backfill resumes from it
+	CheckpointFile  string `env:"CHECKPOINT_FILE" envDefault:""`
+	CheckpointEvery int    `env:"CHECKPOINT_EVERY" envDefault:"10000"`
+
+	// Add emit_ts, the wall-clock time each line is written, shifted by
+	// EMIT_SKEW to simulate an emitter whose clock is off
+	EmitTimestamp bool          `env:"EMIT_TIMESTAMP" envDefault:"false"`
+	EmitSkew      time.Duration `env:"EMIT_SKEW" envDefault:"0"`
+
+	// Latency probes: every PROBE_INTERVAL in live mode, an entry for
+	// /__probe?key=PROBE_KEY&seq=N&emit=UNIXNANO, found by probe-verify
+	ProbeInterval time.Duration `env:"PROBE_INTERVAL" envDefault:"0"`
+	ProbeKey      string        `env:"PROBE_KEY" envDefault:"lgprobe"`
+
+	// Heartbeat records at a fixed cadence on their own sink, for testing
+	// "no data" alerts; live mode only
+	HeartbeatInterval time.Duration `env:"HEARTBEAT_INTERVAL" envDefault:"0"`
+	HeartbeatSink     string        `env:"HEARTBEAT_SINK" envDefault:"stdout"`
+
+	// Sentry error events for SENTRY_SAMPLE_PERCENT of the 5xx entries,
+	// tagged with their request_id
+	SentryDSN           string  `env:"SENTRY_DSN" envDefault:""`
+	SentrySamplePercent float64 `env:"SENTRY_SAMPLE_PERCENT" envDefault:"10"`
+	SentryEnvironment   string  `env:"SENTRY_ENVIRONMENT" envDefault:""`
+
+	// Webhook notified when the run starts, with a summary of the
+	// configuration, and when it finishes or fails, with the run's stats;
+	// RUN_WEBHOOK_FORMAT is generic (JSON) or slack (incoming webhook)
+	RunWebhookURL    string `env:"RUN_WEBHOOK_URL" envDefault:""`
+	RunWebhookFormat string `env:"RUN_WEBHOOK_FORMAT" envDefault:"generic"`
+
+	// End-of-run summary, appended as a JSON line ("-" for stderr); entries
+	// of the first WARMUP_DURATION are left out of it
+	SummaryFile    string        `env:"SUMMARY_FILE" envDefault:""`
+	WarmupDuration time.Duration `env:"WARMUP_DURATION" envDefault:"0"`
+
+	// Seed of the random generator; runs with the same seed and
+	// configuration produce the same entries. 0 picks a random seed
+	Seed int64 `env:"SEED" envDefault:"0"`
+
+	// Random generator backend: pcg, math or crypto; RNG_STREAM derives a
+	// sub-seed from SEED, e.g. per pod, and instances add their name to it
+	RNGBackend string `env:"RNG_BACKEND" envDefault:"pcg"`
+	RNGStream  string `env:"RNG_STREAM" envDefault:""`
+
+	// Controller-level (non-access) lines interleaved with access logs
+	ControllerEventPercent         float64 `env:"CONTROLLER_EVENT_PERCENT" envDefault:"0"`
+	ControllerReloadFailurePercent float64 `env:"CONTROLLER_RELOAD_FAILURE_PERCENT" envDefault:"10"`
+
+	// Multi-line error dumps for testing multiline merging
+	StackTracePercent float64 `env:"STACKTRACE_PERCENT" envDefault:"0"`
+	StackTraceStyle   string  `env:"STACKTRACE_STYLE" envDefault:"mixed"`
+
+	// nginx error_log lines emitted alongside access lines
+	ErrorLogRatio float64 `env:"ERROR_LOG_RATIO" envDefault:"0"`
+	ErrorLogSink  string  `env:"ERROR_LOG_SINK" envDefault:"stderr"`
+	// Processors for ERROR_LOG_SINK, as PIPELINE
+	ErrorLogPipeline string `env:"ERROR_LOG_PIPELINE" envDefault:""`
+
+	// Environment the configuration was read from, nil for the process
+	// environment; named sinks read their settings from it too
+	environ map[string]string
 }
 
 type logEntry struct {
 	Timestamp time.Time `json:"ts"`
-	HTTP      httpInfo  `json:"http"`
-	Nginx     nginxInfo `json:"nginx"`
+	// Wall-clock time the line was written, present with EMIT_TIMESTAMP
+	EmitTimestamp *time.Time `json:"emit_ts,omitempty"`
+
+	HTTP       httpInfo        `json:"http"`
+	Nginx      nginxInfo       `json:"nginx"`
+	Kubernetes *kubernetesInfo `json:"kubernetes,omitempty"`
+
+	// Name of the receiving sink in COMPARE_SINKS mode
+	Sink string `json:"sink,omitempty"`
+
+	// RecordID numbers the delivered entries, for the winevent formats
+	RecordID uint64 `json:"-"`
 }
 
 type httpInfo struct {
@@ -43,95 +377,107 @@ type httpInfo struct {
 	ServerProtocol string  `json:"server_protocol"`
 	ContentType    string  `json:"content_type"`
 	BytesSent      string  `json:"bytes_sent"`
+
+	// Client hints, only present with CLIENT_HINTS enabled
+	SecCHUA         string `json:"sec_ch_ua,omitempty"`
+	SecCHUAPlatform string `json:"sec_ch_ua_platform,omitempty"`
+	SecCHUAMobile   string `json:"sec_ch_ua_mobile,omitempty"`
+
+	// Header-derived fields, only present with HEADER_FIELDS enabled
+	AcceptEncoding  string `json:"accept_encoding,omitempty"`
+	ContentEncoding string `json:"content_encoding,omitempty"`
+	Scheme          string `json:"scheme,omitempty"`
+	Authority       string `json:"authority,omitempty"`
+
+	// Response framing: chunked responses have no content_length
+	TransferEncoding string `json:"transfer_encoding,omitempty"`
+	ContentLength    string `json:"content_length,omitempty"`
+
+	// W3C trace context of sampled requests, see TRACE_SAMPLING
+	Traceparent string `json:"traceparent,omitempty"`
 }
 
 type nginxInfo struct {
 	XForwardFor  string `json:"x-forward-for"`
 	RemoteAddr   string `json:"remote_addr"`
 	HTTPReferrer string `json:"http_referrer"`
-}
 
-func main() {
-	cfg := config{}
-	if err := env.Parse(&cfg); err != nil {
-		panic(err)
-	}
+	// Basic auth user, present with REMOTE_USERS
+	RemoteUser string `json:"remote_user,omitempty"`
+
+	// Request time in nginx $time_local format, present with TIMEZONE or backfill
+	TimeLocal string `json:"time_local,omitempty"`
 
-	ticker := time.NewTicker(time.Second / time.Duration(cfg.Rate))
+	// Request cookies, present when LINE_SIZE_MEAN pads lines
+	HTTPCookie string `json:"http_cookie,omitempty"`
 
-	gofakeit.Seed(time.Now().UnixNano())
+	// Upstream identity, present when canary or cutover scenarios are enabled
+	ProxyUpstreamName            string `json:"proxy_upstream_name,omitempty"`
+	ProxyAlternativeUpstreamName string `json:"proxy_alternative_upstream_name,omitempty"`
 
-	// Parse environment variables for specific values
-	ipList := parseEnvList(cfg.IPAddresses)
-	methodList := parseEnvList(cfg.HTTPMethods)
-	pathList := parseEnvList(cfg.Paths)
-	statusCodeList := parseEnvIntList(cfg.StatusCodes)
-	hostList := parseEnvList(cfg.Hosts)
+	// Upstream attempts as comma-separated lists, present with
+	// UPSTREAM_FIELDS
+	UpstreamAddr           string `json:"upstream_addr,omitempty"`
+	UpstreamStatus         string `json:"upstream_status,omitempty"`
+	UpstreamResponseTime   string `json:"upstream_response_time,omitempty"`
+	UpstreamResponseLength string `json:"upstream_response_length,omitempty"`
+
+	// TLS connection, present with SSL_FIELDS for requests over HTTPS
+	SSLProtocol   string `json:"ssl_protocol,omitempty"`
+	SSLCipher     string `json:"ssl_cipher,omitempty"`
+	SSLServerName string `json:"ssl_server_name,omitempty"`
+
+	// Ingress whose rewrite-target rule matched, the client's URI as the
+	// X-Original-URI header passes it on and the URI sent upstream,
+	// present with INGRESS_REWRITES
+	IngressName  string `json:"ingress_name,omitempty"`
+	XOriginalURI string `json:"x_original_uri,omitempty"`
+	UpstreamURI  string `json:"upstream_uri,omitempty"`
+}
 
-	// Validate that required environment variables are set
-	if len(ipList) == 0 {
-		panic("IP_ADDRESSES environment variable must be set with at least one IP address")
+// kubernetesInfo identifies the simulated ingress pod, present with REGIONS
+type kubernetesInfo struct {
+	PodName string `json:"pod_name"`
+	Region  string `json:"region"`
+	Zone    string `json:"zone"`
+}
+
+func main() {
+	environ, err := processEnviron()
+	if err != nil {
+		panic(err)
 	}
-	if len(methodList) == 0 {
-		panic("HTTP_METHODS environment variable must be set with at least one HTTP method")
+	cfg, err := parseConfig(environ)
+	if err != nil {
+		panic(err)
 	}
-	if len(pathList) == 0 {
-		panic("PATHS environment variable must be set with at least one path")
+
+	seed, err := seedFor(cfg)
+	if err != nil {
+		panic(err)
 	}
-	if len(statusCodeList) == 0 {
-		panic("STATUS_CODES environment variable must be set with at least one status code")
+	if cfg.CheckpointFile != "" && cfg.RNGBackend != "pcg" {
+		panic("CHECKPOINT_FILE requires RNG_BACKEND=pcg")
 	}
-	if len(hostList) == 0 {
-		panic("HOSTS environment variable must be set with at least one host")
+	if err := seedRNG(cfg.RNGBackend, seed); err != nil {
+		panic(err)
 	}
 
-	for range ticker.C {
-		timeLocal := time.Now()
-
-		// Use only values from environment variables
-		ip := ipList[rand.Intn(len(ipList))]
-		httpMethod := methodList[rand.Intn(len(methodList))]
-		path := pathList[rand.Intn(len(pathList))]
-		statusCode := statusCodeList[rand.Intn(len(statusCodeList))]
-		host := hostList[rand.Intn(len(hostList))]
-
-		bodyBytesSent := realisticBytesSent(statusCode)
-		userAgent := gofakeit.UserAgent()
-
-		// Generate a fake request ID
-		requestID := strings.ToLower(gofakeit.UUID())
-
-		logEntry := logEntry{
-			Timestamp: timeLocal,
-			HTTP: httpInfo{
-				RequestID:      requestID,
-				Method:         httpMethod,
-				StatusCode:     statusCode,
-				URL:            fmt.Sprintf("%s/%s", host, strings.TrimPrefix(path, "/")),
-				Host:           host,
-				URI:            path,
-				RequestTime:    gofakeit.Float32Range(0.001, 2.000),
-				UserAgent:      userAgent,
-				Protocol:       "HTTP/1.1",
-				TraceSessionID: "",
-				ServerProtocol: "HTTP/1.1",
-				ContentType:    "application/json",
-				BytesSent:      fmt.Sprintf("%d", bodyBytesSent),
-			},
-			Nginx: nginxInfo{
-				XForwardFor:  ip,
-				RemoteAddr:   ip,
-				HTTPReferrer: "",
-			},
+	if cfg.ExportConfig != "" {
+		if err := exportConfig(cfg); err != nil {
+			panic(err)
 		}
+	}
 
-		jsonData, err := json.Marshal(logEntry)
-		if err != nil {
+	if len(os.Args) > 1 {
+		if err := runCommand(cfg, os.Args[1], os.Args[2:]); err != nil {
 			panic(err)
 		}
+		return
+	}
 
-		// Print with the desired prefix format
-		fmt.Println(string(jsonData))
+	if err := run(cfg); err != nil {
+		panic(err)
 	}
 }
 
@@ -157,11 +503,3 @@ func parseEnvIntList(envVar string) []int {
 	}
 	return result
 }
-
-func realisticBytesSent(statusCode int) int {
-	if statusCode >= 400 {
-		return rand.Intn(120-30) + 30
-	}
-
-	return rand.Intn(3100-800) + 800
-}
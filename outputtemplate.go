@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// templateFuncs are the helpers available to OUTPUT_TEMPLATE, named after
+// their sprig counterparts, plus nginx, which renders a LOG_FORMAT variable
+// of the entry.
+var templateFuncs = template.FuncMap{
+	"upper":     strings.ToUpper,
+	"lower":     strings.ToLower,
+	"trim":      strings.TrimSpace,
+	"replace":   func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+	"contains":  func(substr, s string) bool { return strings.Contains(s, substr) },
+	"hasPrefix": func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+	"hasSuffix": func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+	"trunc": func(n int, s string) string {
+		if len(s) > n {
+			return s[:n]
+		}
+		return s
+	},
+	"split":  func(sep, s string) []string { return strings.Split(s, sep) },
+	"join":   func(sep string, s []string) string { return strings.Join(s, sep) },
+	"quote":  strconv.Quote,
+	"squote": func(s string) string { return "'" + s + "'" },
+	"default": func(def, v interface{}) interface{} {
+		if v == nil || fmt.Sprint(v) == "" || fmt.Sprint(v) == "0" {
+			return def
+		}
+		return v
+	},
+	"toJson": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"date":      func(layout string, t time.Time) string { return t.Format(layout) },
+	"unixEpoch": func(t time.Time) int64 { return t.Unix() },
+	"add":       func(a, b int) int { return a + b },
+	"sub":       func(a, b int) int { return a - b },
+	"mul":       func(a, b int) int { return a * b },
+	"div":       func(a, b int) int { return a / b },
+	"atoi":      atoi,
+	"env":       os.Getenv,
+	"nginx": func(name string, e *logEntry) (string, error) {
+		value, ok := nginxVariables[name]
+		if !ok {
+			return "", fmt.Errorf("unsupported variable $%s", name)
+		}
+		return value(e), nil
+	},
+}
+
+// newGoTemplateFormatter compiles an OUTPUT_TEMPLATE, a Go text/template
+// executed with the *logEntry, such as
+// `{{.Timestamp.Unix}} {{.HTTP.Method | lower}} {{nginx "upstream_addr" .}}`.
+// A trailing newline, as template files usually end with, is dropped.
+func newGoTemplateFormatter(text string) (formatter, error) {
+	tmpl, err := template.New("OUTPUT_TEMPLATE").Option("missingkey=error").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return func(e *logEntry) ([]byte, error) {
+		var b strings.Builder
+		if err := tmpl.Execute(&b, e); err != nil {
+			return nil, err
+		}
+		line := strings.TrimRight(b.String(), "\r\n")
+		if strings.ContainsAny(line, "\r\n") {
+			return nil, fmt.Errorf("OUTPUT_TEMPLATE rendered a line break in the middle of a line")
+		}
+		return []byte(line), nil
+	}, nil
+}
+
+// outputTemplate returns the OUTPUT_TEMPLATE, read from OUTPUT_TEMPLATE_FILE
+// when that is set.
+func outputTemplate(cfg config) (string, error) {
+	if cfg.OutputTemplateFile == "" {
+		return cfg.OutputTemplate, nil
+	}
+	if cfg.OutputTemplate != "" {
+		return "", fmt.Errorf("OUTPUT_TEMPLATE and OUTPUT_TEMPLATE_FILE cannot both be set")
+	}
+	data, err := os.ReadFile(cfg.OutputTemplateFile)
+	if err != nil {
+		return "", fmt.Errorf("reading OUTPUT_TEMPLATE_FILE: %w", err)
+	}
+	return string(data), nil
+}
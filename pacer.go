@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// eventRate is an access entry rate in entries per second. RATE accepts a
+// plain number, as before, or a count with an optional k/M suffix per
+// period, such as "10k/s", "300/min" or "2/h".
+type eventRate float64
+
+func (r *eventRate) UnmarshalText(text []byte) error {
+	s := strings.ReplaceAll(string(text), " ", "")
+	count, period, per := strings.Cut(s, "/")
+	d := time.Second
+	if per {
+		var known bool
+		if d, known = volumePeriods[strings.ToLower(period)]; !known {
+			return fmt.Errorf("invalid RATE %q (want e.g. 5, 0.5, 10k/s, 300/min)", s)
+		}
+	}
+	multiplier := 1.0
+	switch {
+	case strings.HasSuffix(count, "k"):
+		count, multiplier = strings.TrimSuffix(count, "k"), 1e3
+	case strings.HasSuffix(count, "M"):
+		count, multiplier = strings.TrimSuffix(count, "M"), 1e6
+	}
+	n, err := strconv.ParseFloat(count, 64)
+	if err != nil || n <= 0 {
+		return fmt.Errorf("invalid RATE %q (want e.g. 5, 0.5, 10k/s, 300/min)", s)
+	}
+	*r = eventRate(n * multiplier / d.Seconds())
+	return nil
+}
+
+// ramp moves the rate from one value to another over a duration, then holds
+// it, to find the rate at which a pipeline breaks in a single run.
+type ramp struct {
+	from, to    float64
+	duration    time.Duration
+	exponential bool
+
+	mu    sync.Mutex
+	start time.Time
+}
+
+func newRamp(cfg config) (*ramp, error) {
+	r := &ramp{from: float64(cfg.RampFrom), to: float64(cfg.RampTo), duration: cfg.RampDuration}
+	switch cfg.RampShape {
+	case "linear":
+	case "exponential":
+		r.exponential = true
+	default:
+		return nil, fmt.Errorf("unknown RAMP_SHAPE %q (want linear or exponential)", cfg.RampShape)
+	}
+	return r, nil
+}
+
+// begin starts the ramp at t.
+func (r *ramp) begin(t time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.start = t
+}
+
+// rate returns the rate at t: RAMP_FROM before the ramp begins and
+// RAMP_TO once it is over.
+func (r *ramp) rate(t time.Time) float64 {
+	r.mu.Lock()
+	start := r.start
+	r.mu.Unlock()
+	if start.IsZero() || t.IsZero() {
+		return r.from
+	}
+	progress := min(max(t.Sub(start).Seconds()/r.duration.Seconds(), 0), 1)
+	if r.exponential {
+		return r.from * math.Pow(r.to/r.from, progress)
+	}
+	return r.from + (r.to-r.from)*progress
+}
+
+// pacerMinWait bounds how often the pacer wakes up. Above 1000 entries per
+// second, several entries are generated per wakeup instead.
+const pacerMinWait = time.Millisecond
+
+// pacerBurst is how far the pacer catches up after generation fell behind,
+// as when a sink blocked; anything older is dropped rather than flooding.
+const pacerBurst = time.Second
+
+// pacer is a token bucket filled at the current rate, so fractional rates
+// keep their average and high rates are not limited by one timer per entry.
+// Each entry costs the tokens cost draws: always one for evenly spaced
+// entries, exponentially distributed ones for Poisson arrivals.
+type pacer struct {
+	tokens float64
+	last   time.Time
+	cost   func() float64
+	next   float64
+}
+
+func newPacer(now time.Time, cost func() float64) *pacer {
+	return &pacer{last: now, cost: cost, next: cost()}
+}
+
+// take fills the bucket up to now and returns the number of entries due.
+func (p *pacer) take(now time.Time, rate float64) int {
+	p.tokens += now.Sub(p.last).Seconds() * rate
+	p.tokens = min(p.tokens, max(p.next, rate*pacerBurst.Seconds()))
+	p.last = now
+	n := 0
+	for p.tokens >= p.next {
+		p.tokens -= p.next
+		p.next = p.cost()
+		n++
+	}
+	return n
+}
+
+// wait returns the pause until the next entry is due at rate.
+func (p *pacer) wait(rate float64) time.Duration {
+	return max(time.Duration((p.next-p.tokens)/rate*float64(time.Second)), pacerMinWait)
+}
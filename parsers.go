@@ -0,0 +1,204 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// nginxErrorRegex matches the error_log lines written alongside access
+// entries when ERROR_LOG_RATIO is set.
+const nginxErrorRegex = `^(?<time>\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}) \[(?<level>\w+)\] (?<pid>\d+)#(?<tid>\d+): (?:\*(?<connection>\d+) )?(?<message>.*)$`
+
+// errInfluxParser is returned for OUTPUT_FORMAT=influx, which needs no parser.
+var errInfluxParser = errors.New("the influx output format is read by Telegraf's influx data format or InfluxDB itself, not by a log parser")
+
+// runPrintParser prints a Fluent Bit parser or Logstash filter that ingests
+// the configured output format, and the error log when one is generated.
+func runPrintParser(cfg config, args []string) error {
+	fs := flag.NewFlagSet("print-parser", flag.ExitOnError)
+	target := fs.String("target", "fluent-bit", "configuration to print: fluent-bit or logstash")
+	fs.Parse(args)
+
+	if err := needBuiltinFormat(cfg, "print-parser"); err != nil {
+		return err
+	}
+	var conf string
+	var err error
+	switch *target {
+	case "fluent-bit":
+		conf, err = fluentBitParsers(cfg)
+	case "logstash":
+		conf, err = logstashFilter(cfg)
+	default:
+		return fmt.Errorf("unknown target %q (want fluent-bit or logstash)", *target)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.WriteString(conf)
+	return err
+}
+
+func fluentBitParsers(cfg config) (string, error) {
+	var b strings.Builder
+	switch cfg.OutputFormat {
+	case "json":
+		b.WriteString(fluentBitParser("nginx_json", "json", "", "ts", "%Y-%m-%dT%H:%M:%S.%L%z", ""))
+	case "winevent-json":
+		b.WriteString(fluentBitParser("nginx_winevent", "json", "", "@timestamp", "%Y-%m-%dT%H:%M:%S.%L%z", ""))
+	case "combined":
+		regex := `^(?<remote>[^ ]*) - (?<user>[^ ]*) \[(?<time>[^\]]*)\] "(?<method>\S+)(?: +(?<path>[^\"]*?)(?: +\S*)?)?" (?<code>[^ ]*) (?<size>[^ ]*) "(?<referer>[^\"]*)" "(?<agent>[^\"]*)"$`
+		b.WriteString(fluentBitParser("nginx_combined", "regex", regex, "time", "%d/%b/%Y:%H:%M:%S %z", "code:integer size:integer"))
+	case "winevent-xml":
+		// Fluent Bit cannot parse XML, so pick out the System fields and keep
+		// EventData for a Lua filter or the backend
+		regex := `^<Event [^>]*><System>.*<EventID>(?<event_id>\d+)</EventID><Level>(?<level>\d+)</Level><TimeCreated SystemTime="(?<time>[^"]+)"></TimeCreated>.*<EventData>(?<event_data>.*)</EventData></Event>$`
+		b.WriteString(fluentBitParser("nginx_winevent", "regex", regex, "time", "%Y-%m-%dT%H:%M:%S.%L%z", "event_id:integer level:integer"))
+	case "logfmt":
+		b.WriteString(fluentBitParser("nginx_logfmt", "logfmt", "", "ts", "%Y-%m-%dT%H:%M:%S.%L%z", ""))
+	case "csv":
+		return "", errors.New("Fluent Bit has no CSV parser, use -target logstash or another output format")
+	case "influx":
+		return "", errInfluxParser
+	default:
+		return "", fmt.Errorf("unknown output format %q", cfg.OutputFormat)
+	}
+	if cfg.ErrorLogRatio > 0 {
+		b.WriteString("\n")
+		b.WriteString(fluentBitParser("nginx_error", "regex", nginxErrorRegex, "time", "%Y/%m/%d %H:%M:%S", "pid:integer tid:integer connection:integer"))
+	}
+	return b.String(), nil
+}
+
+func fluentBitParser(name, format, regex, timeKey, timeFormat, types string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[PARSER]\n    Name        %s\n    Format      %s\n", name, format)
+	if regex != "" {
+		fmt.Fprintf(&b, "    Regex       %s\n", regex)
+	}
+	fmt.Fprintf(&b, "    Time_Key    %s\n    Time_Format %s\n    Time_Keep   On\n", timeKey, timeFormat)
+	if types != "" {
+		fmt.Fprintf(&b, "    Types       %s\n", types)
+	}
+	return b.String()
+}
+
+func logstashFilter(cfg config) (string, error) {
+	var access string
+	switch cfg.OutputFormat {
+	case "json":
+		access = `json {
+  source => "message"
+}
+date {
+  match => ["ts", "ISO8601"]
+}
+mutate {
+  convert => { "[http][bytes_sent]" => "integer" }
+}
+`
+	case "combined":
+		access = `grok {
+  match => { "message" => "%{COMBINEDAPACHELOG}" }
+}
+date {
+  match => ["timestamp", "dd/MMM/yyyy:HH:mm:ss Z"]
+}
+`
+	case "winevent-json":
+		// The json filter takes @timestamp from the document itself
+		access = `json {
+  source => "message"
+}
+mutate {
+  convert => {
+    "[winlog][event_data][http.status_code]" => "integer"
+    "[winlog][event_data][http.bytes_sent]" => "integer"
+    "[winlog][event_data][http.request_time]" => "float"
+  }
+}
+`
+	case "winevent-xml":
+		// Extract every EventData field the generator currently writes into
+		// the same nested layout as the JSON output
+		entries, _, err := sample(cfg, 1)
+		if err != nil {
+			return "", err
+		}
+		var xpath strings.Builder
+		xpath.WriteString("    \"/Event/System/TimeCreated/@SystemTime\" => \"system_time\"\n")
+		for _, f := range flattenEntry(&entries[0]) {
+			fmt.Fprintf(&xpath, "    \"/Event/EventData/Data[@Name='%s']/text()\" => \"[%s]\"\n", f.Name, strings.ReplaceAll(f.Name, ".", "]["))
+		}
+		access = fmt.Sprintf(`xml {
+  source => "message"
+  store_xml => false
+  remove_namespaces => true
+  xpath => {
+%s  }
+}
+date {
+  match => ["[system_time][0]", "ISO8601"]
+}
+`, xpath.String())
+	case "logfmt":
+		access = `kv {
+  source => "message"
+  field_split => " "
+  value_split => "="
+}
+date {
+  match => ["ts", "ISO8601"]
+}
+mutate {
+  convert => { "http.bytes_sent" => "integer" }
+}
+`
+	case "csv":
+		columns := make([]string, len(csvColumns))
+		for i, c := range csvColumns {
+			columns[i] = strconv.Quote(c.name)
+		}
+		access = fmt.Sprintf(`csv {
+  source => "message"
+  columns => [%s]
+  convert => { "status" => "integer" "bytes_sent" => "integer" "request_time" => "float" }
+}
+date {
+  match => ["ts", "ISO8601"]
+}
+`, strings.Join(columns, ", "))
+	case "influx":
+		return "", errInfluxParser
+	default:
+		return "", fmt.Errorf("unknown output format %q", cfg.OutputFormat)
+	}
+
+	if cfg.ErrorLogRatio <= 0 {
+		return "filter {\n" + indent(access, "  ") + "}\n", nil
+	}
+	errorLog := `grok {
+  match => { "message" => "(?<timestamp>%{YEAR}/%{MONTHNUM}/%{MONTHDAY} %{TIME}) \[%{LOGLEVEL:level}\] %{POSINT:pid}#%{NUMBER:tid}: (\*%{NUMBER:connection} )?%{GREEDYDATA:error_message}" }
+}
+date {
+  match => ["timestamp", "yyyy/MM/dd HH:mm:ss"]
+}
+`
+	return "filter {\n  if [message] =~ /^\\d{4}\\/\\d{2}\\/\\d{2} / {\n" + indent(errorLog, "    ") +
+		"  } else {\n" + indent(access, "    ") + "  }\n}\n", nil
+}
+
+// indent prefixes every non-empty line of s.
+func indent(s, prefix string) string {
+	lines := strings.SplitAfter(s, "\n")
+	for i, line := range lines {
+		if strings.TrimSpace(line) != "" {
+			lines[i] = prefix + line
+		}
+	}
+	return strings.Join(lines, "")
+}
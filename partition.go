@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// partitionedSink writes lines into Hive-style dt=YYYY-MM-DD/hour=HH
+// directories under a root directory, so engines such as DuckDB or Athena can
+// prune partitions by the record timestamp. Partitions use UTC.
+type partitionedSink struct {
+	root    string
+	current string
+	file    *os.File
+}
+
+func newPartitionedSink(cfg sinkConfig) (*partitionedSink, error) {
+	if err := os.MkdirAll(cfg.PartitionDir, 0o755); err != nil {
+		return nil, err
+	}
+	return &partitionedSink{root: cfg.PartitionDir}, nil
+}
+
+func (s *partitionedSink) Send(r record) error {
+	t := r.Time.UTC()
+	dir := filepath.Join(s.root, "dt="+t.Format("2006-01-02"), fmt.Sprintf("hour=%02d", t.Hour()))
+	if dir != s.current {
+		if err := s.open(dir); err != nil {
+			return err
+		}
+	}
+	_, err := s.file.Write(append(r.Line, '\n'))
+	return err
+}
+
+func (s *partitionedSink) open(dir string) error {
+	if err := s.Close(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, "part-0.ndjson"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	s.file, s.current = f, dir
+	return nil
+}
+
+func (s *partitionedSink) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file, s.current = nil, ""
+	return err
+}
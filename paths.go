@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// buildPathPool expands the configured paths into exactly n distinct URIs.
+// The configured paths come first; further URIs are derived from them by
+// appending a numeric resource ID, e.g. /api/v1/users/17.
+func buildPathPool(paths []string, n int) []string {
+	seen := make(map[string]bool, n)
+	pool := make([]string, 0, n)
+	for _, p := range paths {
+		if len(pool) < n && !seen[p] {
+			seen[p] = true
+			pool = append(pool, p)
+		}
+	}
+	for id := 1; len(pool) < n; id++ {
+		for _, p := range paths {
+			derived := strings.TrimSuffix(p, "/") + "/" + strconv.Itoa(id)
+			if len(pool) < n && !seen[derived] {
+				seen[derived] = true
+				pool = append(pool, derived)
+			}
+		}
+	}
+	return pool
+}
+
+// uniquePath appends a random resource ID to path, giving practically
+// unbounded path cardinality.
+func uniquePath(rnd *rand.Rand, path string) string {
+	return strings.TrimSuffix(path, "/") + "/" + strconv.Itoa(rnd.Intn(1_000_000_000))
+}
+
+// percentEncodingVariant re-encodes the path of uri using one of the
+// encodings that commonly trip URL-decoding logic: unnecessary escapes with
+// mixed-case hex digits, double encoding, or encoded slashes. The query is
+// kept as is, so the request means the same.
+func percentEncodingVariant(rnd *rand.Rand, uri string) string {
+	path, query, hasQuery := strings.Cut(uri, "?")
+	var b strings.Builder
+	technique := rnd.Intn(3)
+	encoded := false
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		switch {
+		case technique == 2 && c == '/' && i > 0:
+			b.WriteString(randomCase(rnd, "%2F"))
+			encoded = true
+		case technique != 2 && c != '/' && rnd.Intn(3) == 0:
+			escape := randomCase(rnd, fmt.Sprintf("%%%02X", c))
+			if technique == 1 {
+				// Encode the percent sign of the escape once more
+				escape = "%25" + escape[1:]
+			}
+			b.WriteString(escape)
+			encoded = true
+		default:
+			b.WriteByte(c)
+		}
+	}
+	variant := b.String()
+	if !encoded {
+		// Nothing was picked (e.g. "/"); encode a trailing dot segment instead
+		variant = strings.TrimSuffix(path, "/") + "/%2e"
+	}
+	if hasQuery {
+		variant += "?" + query
+	}
+	return variant
+}
+
+// randomCase flips the case of each hex letter in an escape at random.
+func randomCase(rnd *rand.Rand, s string) string {
+	out := []byte(s)
+	for i, c := range out {
+		if c >= 'A' && c <= 'F' && rnd.Intn(2) == 0 {
+			out[i] = c + 'a' - 'A'
+		}
+	}
+	return string(out)
+}
+
+// normalizationVariant returns a URI that normalizes to the same route as
+// uri: its path with a trailing slash toggled, a doubled slash, a "."
+// segment or a ".." segment that backs out of a dummy directory, followed by
+// the unchanged query.
+func normalizationVariant(rnd *rand.Rand, uri string) string {
+	path, query, hasQuery := strings.Cut(uri, "?")
+	if hasQuery {
+		return normalizationVariant(rnd, path) + "?" + query
+	}
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	i := rnd.Intn(len(segments))
+	switch rnd.Intn(4) {
+	case 0:
+		if strings.HasSuffix(path, "/") && path != "/" {
+			return strings.TrimSuffix(path, "/")
+		}
+		return path + "/"
+	case 1:
+		segments[i] = "/" + segments[i]
+	case 2:
+		segments[i] = "./" + segments[i]
+	default:
+		segments[i] = "tmp/../" + segments[i]
+	}
+	variant := "/" + strings.Join(segments, "/")
+	if strings.HasSuffix(path, "/") && path != "/" {
+		variant += "/"
+	}
+	return variant
+}
+
+// pathClass is the kind of resource a path refers to.
+type pathClass int
+
+const (
+	pagePath pathClass = iota
+	staticPath
+	apiPath
+)
+
+var staticExtensions = map[string]bool{
+	".css": true, ".js": true, ".map": true, ".png": true, ".jpg": true, ".jpeg": true,
+	".gif": true, ".svg": true, ".webp": true, ".ico": true, ".woff": true, ".woff2": true,
+	".ttf": true, ".mp4": true, ".pdf": true, ".txt": true, ".xml": true,
+}
+
+// classifyPath tells static assets (by file extension) and API endpoints
+// (by an /api, /graphql or /vN segment) apart from ordinary pages.
+func classifyPath(path string) pathClass {
+	path, _, _ = strings.Cut(path, "?")
+	if dot := strings.LastIndexByte(path, '.'); dot > strings.LastIndexByte(path, '/') {
+		if staticExtensions[strings.ToLower(path[dot:])] {
+			return staticPath
+		}
+	}
+	for _, seg := range strings.Split(path, "/") {
+		if seg == "api" || seg == "graphql" || (len(seg) >= 2 && seg[0] == 'v' && seg[1] >= '0' && seg[1] <= '9') {
+			return apiPath
+		}
+	}
+	return pagePath
+}
+
+// methodAllowed reports whether method is plausible for a path of the given
+// class: state-changing methods only hit APIs, pages are fetched or
+// preflighted, assets are only fetched.
+func methodAllowed(method string, class pathClass) bool {
+	switch class {
+	case staticPath:
+		return method == "GET" || method == "HEAD"
+	case pagePath:
+		return method == "GET" || method == "HEAD" || method == "OPTIONS"
+	default:
+		return true
+	}
+}
+
+// catalogBases seed PATH_CATALOG_SIZE when PATHS is not set: the sections
+// of a typical site, each expanded with resource IDs.
+var catalogBases = []string{
+	"/", "/products", "/category", "/blog", "/docs", "/search",
+	"/api/v1/items", "/api/v1/users", "/api/v1/orders",
+}
+
+// readPathCatalog reads one path per line from PATH_CATALOG_FILE, the most
+// requested first; blank lines and lines starting with "#" are skipped.
+func readPathCatalog(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading PATH_CATALOG_FILE: %w", err)
+	}
+	var paths []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			paths = append(paths, line)
+		}
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("PATH_CATALOG_FILE %s lists no paths", path)
+	}
+	return paths, nil
+}
+
+// zipfWeights weights paths by rank, the k-th with 1/k^s, so that a few top
+// pages get most of the traffic, as on real sites. Unlike rand.Zipf it
+// accepts the exponents below 1 typical of web traffic.
+func zipfWeights(paths []string, s float64) *weighted[string] {
+	w := &weighted[string]{}
+	for k, p := range paths {
+		w.add(p, math.Pow(float64(k+1), -s))
+	}
+	return w
+}
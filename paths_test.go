@@ -0,0 +1,55 @@
+package main
+
+import (
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestBuildPathPool(t *testing.T) {
+	tests := []struct {
+		name  string
+		paths []string
+		n     int
+		want  []string
+	}{
+		{"truncated", []string{"/a", "/b", "/c"}, 2, []string{"/a", "/b"}},
+		{"duplicates dropped before truncating", []string{"/a", "/a", "/b", "/c"}, 3, []string{"/a", "/b", "/c"}},
+		{"duplicates replaced by derived paths", []string{"/a", "/a", "/b/"}, 3, []string{"/a", "/b/", "/a/1"}},
+		{"derived paths skip configured ones", []string{"/a", "/a/1"}, 4, []string{"/a", "/a/1", "/a/1/1", "/a/2"}},
+	}
+	for _, tt := range tests {
+		if got := buildPathPool(tt.paths, tt.n); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: buildPathPool(%q, %d) = %q, want %q", tt.name, tt.paths, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestPercentEncodingKeepsQuery(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, uri := range []string{"/", "/search?q=a&page=2", "/api/v1/items?id=3", "/?x=1"} {
+		path, query, _ := strings.Cut(uri, "?")
+		for range 100 {
+			variant := percentEncodingVariant(rnd, uri)
+			gotPath, gotQuery, _ := strings.Cut(variant, "?")
+			if gotQuery != query || gotPath == path {
+				t.Fatalf("percentEncodingVariant(%q) = %q, want the path re-encoded and the query kept", uri, variant)
+			}
+		}
+	}
+}
+
+func TestNormalizationVariantKeepsQuery(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, uri := range []string{"/", "/a?x=1", "/a/b/?x=1&y=2", "/?q=/"} {
+		path, query, _ := strings.Cut(uri, "?")
+		for range 100 {
+			variant := normalizationVariant(rnd, uri)
+			gotPath, gotQuery, _ := strings.Cut(variant, "?")
+			if gotQuery != query || !strings.HasPrefix(gotPath, "/") || gotPath == path {
+				t.Fatalf("normalizationVariant(%q) = %q, want another spelling of the path and the query kept", uri, variant)
+			}
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+
+	"github.com/caarlos0/env/v6"
+)
+
+// redacted replaces the values of redacted fields.
+const redacted = "REDACTED"
+
+// redactableFields are the nginx variables the redact processor can blank
+// out: those that carry personal data or secrets.
+var redactableFields = map[string]func(e *logEntry){
+	"remote_addr":          func(e *logEntry) { e.Nginx.RemoteAddr = redacted },
+	"remote_user":          func(e *logEntry) { e.Nginx.RemoteUser = redacted },
+	"http_x_forwarded_for": func(e *logEntry) { e.Nginx.XForwardFor = redacted },
+	"http_user_agent":      func(e *logEntry) { e.HTTP.UserAgent = redacted },
+	"http_referer":         func(e *logEntry) { e.Nginx.HTTPReferrer = redacted },
+	"http_cookie":          func(e *logEntry) { e.Nginx.HTTPCookie = redacted },
+	"args": func(e *logEntry) {
+		path, _, ok := strings.Cut(e.HTTP.URI, "?")
+		if ok {
+			e.HTTP.URL = strings.TrimSuffix(e.HTTP.URL, e.HTTP.URI) + path + "?" + redacted
+			e.HTTP.URI = path + "?" + redacted
+		}
+	},
+}
+
+// processor is one stage of a PIPELINE. It returns the record to pass on,
+// or false to drop it.
+type processor func(r record) (record, bool, error)
+
+// pipelineSink runs records through a chain of processors before they reach
+// the sink, as a log shipper would: "sample:10,redact:remote_addr|http_cookie,
+// truncate:512,route:5xx=alerts". Processors run in order; redact works on
+// the access entry and renders it again, truncate on the rendered line.
+type pipelineSink struct {
+	sink       sink
+	processors []processor
+	// routes are the sinks route and tee send to, closed with the pipeline
+	routes []namedSink
+}
+
+// newPipelineSink wraps s in the processors of spec. Sinks that route and
+// tee name are configured by ROUTE_<NAME>_* variables of environ, as
+// ROUTE_ALERTS_SINK=file; a name without ROUTE_<NAME>_SINK is a sink type.
+func newPipelineSink(s sink, spec string, environ map[string]string, format formatter) (*pipelineSink, error) {
+	p := &pipelineSink{sink: s}
+	for _, part := range parseEnvList(spec) {
+		name, arg, _ := strings.Cut(strings.TrimSpace(part), ":")
+		var proc processor
+		var err error
+		switch name {
+		case "sample":
+			proc, err = sampleProcessor(arg)
+		case "redact":
+			proc, err = redactProcessor(arg, format)
+		case "truncate":
+			proc, err = truncateProcessor(arg)
+		case "route", "tee":
+			proc, err = p.routeProcessor(arg, name == "tee", environ)
+		default:
+			err = fmt.Errorf("unknown processor %q (want sample, redact, truncate, route or tee)", name)
+		}
+		if err != nil {
+			p.closeRoutes()
+			return nil, fmt.Errorf("PIPELINE: %w", err)
+		}
+		p.processors = append(p.processors, proc)
+	}
+	return p, nil
+}
+
+// sampleProcessor keeps the given percentage of records. Access entries are
+// chosen by their request ID, so every output sampling at the same
+// percentage keeps the same ones.
+func sampleProcessor(arg string) (processor, error) {
+	percent, err := strconv.ParseFloat(arg, 64)
+	if err != nil || percent < 0 || percent > 100 {
+		return nil, fmt.Errorf("invalid sample percentage %q", arg)
+	}
+	return func(r record) (record, bool, error) {
+		var h uint64
+		if r.Entry != nil {
+			h = entryHash(r.Entry, "sample")
+		} else {
+			f := fnv.New64a()
+			f.Write(r.Line)
+			h = f.Sum64()
+		}
+		return r, float64(h%10000) < percent*100, nil
+	}, nil
+}
+
+// redactProcessor replaces the "|"-separated fields of arg with REDACTED.
+func redactProcessor(arg string, format formatter) (processor, error) {
+	var redact []func(e *logEntry)
+	for _, field := range strings.Split(arg, "|") {
+		f := redactableFields[strings.TrimPrefix(strings.TrimSpace(field), "$")]
+		if f == nil {
+			return nil, fmt.Errorf("cannot redact %q", field)
+		}
+		redact = append(redact, f)
+	}
+	return func(r record) (record, bool, error) {
+		if r.Entry == nil {
+			return r, true, nil
+		}
+		e := *r.Entry
+		for _, f := range redact {
+			f(&e)
+		}
+		line, err := format(&e)
+		if err != nil {
+			return r, false, err
+		}
+		r.Entry, r.Line = &e, line
+		return r, true, nil
+	}, nil
+}
+
+// truncateProcessor cuts lines longer than the given number of bytes.
+func truncateProcessor(arg string) (processor, error) {
+	n, err := strconv.Atoi(arg)
+	if err != nil || n <= 0 {
+		return nil, fmt.Errorf("invalid truncate length %q", arg)
+	}
+	return func(r record) (record, bool, error) {
+		if len(r.Line) > n {
+			r.Line = r.Line[:n:n]
+		}
+		return r, true, nil
+	}, nil
+}
+
+// routeProcessor sends access entries matching a status condition, such as
+// "5xx=alerts" or ">=400=stderr", to another sink. route takes them out of
+// the pipeline; tee sends a copy and passes them on.
+func (p *pipelineSink) routeProcessor(arg string, tee bool, environ map[string]string) (processor, error) {
+	cond, name, err := cutRule(arg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid route %q (want e.g. 5xx=alerts)", arg)
+	}
+	match, err := statusCondition(cond)
+	if err != nil {
+		return nil, fmt.Errorf("invalid route %q: %w", arg, err)
+	}
+	var sc struct {
+		Sink  string `env:"SINK" envDefault:""`
+		Sinks sinkConfig
+	}
+	prefix := "ROUTE_" + envName(name) + "_"
+	if err := env.Parse(&sc, env.Options{Environment: overlay(environ, prefix)}); err != nil {
+		return nil, fmt.Errorf("route %s: %w", name, err)
+	}
+	if environ[prefix+"SINK"] == "" {
+		sc.Sink = name
+	}
+	s, err := newSink(sc.Sink, sc.Sinks)
+	if err != nil {
+		return nil, fmt.Errorf("route %s: %w", name, err)
+	}
+	p.routes = append(p.routes, namedSink{name, s})
+	return func(r record) (record, bool, error) {
+		if r.Entry == nil || !match(r.Entry.HTTP.StatusCode) {
+			return r, true, nil
+		}
+		if err := s.Send(r); err != nil {
+			return r, false, fmt.Errorf("route %s: %w", name, err)
+		}
+		return r, tee, nil
+	}, nil
+}
+
+// cutRule splits a "condition=target" rule at its last "=", as conditions
+// such as ">=500" contain one themselves.
+func cutRule(rule string) (cond, target string, err error) {
+	i := strings.LastIndex(rule, "=")
+	if i <= 0 || i == len(rule)-1 {
+		return "", "", fmt.Errorf("want condition=target")
+	}
+	return strings.TrimSpace(rule[:i]), strings.TrimSpace(rule[i+1:]), nil
+}
+
+// statusCondition parses a status class such as "5xx", an exact code, or a
+// comparison such as ">=500" or "status < 400".
+func statusCondition(cond string) (func(code int) bool, error) {
+	cond = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(cond), "status"))
+	for _, op := range []string{">=", "<=", "!=", ">", "<"} {
+		rest, ok := strings.CutPrefix(cond, op)
+		if !ok {
+			continue
+		}
+		c, err := strconv.Atoi(strings.TrimSpace(rest))
+		if err != nil {
+			return nil, fmt.Errorf("invalid status comparison %q", cond)
+		}
+		switch op {
+		case ">=":
+			return func(code int) bool { return code >= c }, nil
+		case "<=":
+			return func(code int) bool { return code <= c }, nil
+		case "!=":
+			return func(code int) bool { return code != c }, nil
+		case ">":
+			return func(code int) bool { return code > c }, nil
+		default:
+			return func(code int) bool { return code < c }, nil
+		}
+	}
+	if class, ok := strings.CutSuffix(strings.ToLower(cond), "xx"); ok {
+		c, err := strconv.Atoi(class)
+		if err != nil || c < 1 || c > 5 {
+			return nil, fmt.Errorf("invalid status class %q", cond)
+		}
+		return func(code int) bool { return code/100 == c }, nil
+	}
+	c, err := strconv.Atoi(cond)
+	if err != nil {
+		return nil, fmt.Errorf("invalid status %q", cond)
+	}
+	return func(code int) bool { return code == c }, nil
+}
+
+func (p *pipelineSink) Send(r record) error {
+	for _, proc := range p.processors {
+		var keep bool
+		var err error
+		if r, keep, err = proc(r); err != nil || !keep {
+			return err
+		}
+	}
+	return p.sink.Send(r)
+}
+
+func (p *pipelineSink) Flush() error {
+	errs := []error{flushSink(p.sink)}
+	for _, ns := range p.routes {
+		if err := flushSink(ns.sink); err != nil {
+			errs = append(errs, fmt.Errorf("route %s: %w", ns.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (p *pipelineSink) Close() error {
+	return errors.Join(p.sink.Close(), p.closeRoutes())
+}
+
+func (p *pipelineSink) closeRoutes() error {
+	var errs []error
+	for _, ns := range p.routes {
+		if err := ns.sink.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("route %s: %w", ns.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// probeUserAgent marks probe entries for readers of the raw logs.
+const probeUserAgent = "nginx-log-generator-probe"
+
+// emitProbe writes a marker entry whose URI carries the probe key, a
+// sequence number and the emit time in nanoseconds. Keeping them in the URI
+// makes probes recognizable in every output format and every backend.
+func (r *runner) emitProbe(seq uint64) error {
+	now := time.Now()
+	g := r.prober
+	if g.start.IsZero() {
+		g.start = r.gen.start
+	}
+	out := &rendered{entry: g.next(now.In(r.clk.loc))}
+	e := &out.entry
+	r.records++
+	e.RecordID = r.records
+	e.HTTP.Method, e.HTTP.StatusCode, e.HTTP.UserAgent = "GET", 200, probeUserAgent
+	e.HTTP.URI = fmt.Sprintf("/__probe?key=%s&seq=%d&emit=%d", r.cfg.ProbeKey, seq, now.UnixNano())
+	e.HTTP.URL = e.HTTP.Host + e.HTTP.URI
+	e.EmitTimestamp = &now
+
+	line, err := r.format(e)
+	if err != nil {
+		return err
+	}
+	out.access = append(out.access, record{Time: now, Entry: e, Line: line})
+	return r.deliver(out)
+}
+
+// runProbeVerify polls a log backend for probe entries and reports how long
+// each took from being written to becoming searchable, and how many arrived
+// more than once or never.
+func runProbeVerify(cfg config, args []string) error {
+	fs := flag.NewFlagSet("probe-verify", flag.ExitOnError)
+	backend := fs.String("backend", "loki", "backend to query: loki, elasticsearch, clickhouse or kafka")
+	base := fs.String("url", "", "backend base URL, e.g. http://localhost:3100, or the brokers for kafka")
+	selector := fs.String("selector", `{job="nginx"}`, "Loki stream selector")
+	index := fs.String("index", "*", "Elasticsearch index pattern")
+	table := fs.String("table", "nginx_access", "ClickHouse table")
+	column := fs.String("column", "uri", "ClickHouse column holding the request URI")
+	topic := fs.String("topic", "nginx-access", "Kafka topic")
+	readCommitted := fs.Bool("read-committed", false, "only read committed Kafka transactions")
+	duration := fs.Duration("duration", time.Minute, "how long to poll")
+	every := fs.Duration("poll", time.Second, "poll interval, which bounds the latency resolution")
+	fs.Parse(args)
+
+	if *base == "" {
+		return fmt.Errorf("probe-verify needs -url")
+	}
+	key := cfg.ProbeKey
+	start := time.Now()
+	client, err := newHTTPClient(cfg.Sinks)
+	if err != nil {
+		return err
+	}
+
+	// poll returns the records found; HTTP backends return every probe
+	// stored so far on each poll, kafka only the ones consumed since the
+	// previous one
+	var poll func() ([][]byte, error)
+	cumulative := true
+	switch *backend {
+	case "loki":
+		poll = func() ([][]byte, error) {
+			q := url.Values{
+				"query":     {fmt.Sprintf(`%s |= "__probe?key=%s&"`, *selector, key)},
+				"start":     {strconv.FormatInt(start.Add(-time.Minute).UnixNano(), 10)},
+				"limit":     {"5000"},
+				"direction": {"forward"},
+			}
+			var resp struct {
+				Data struct {
+					Result []struct {
+						Values [][2]string `json:"values"`
+					} `json:"result"`
+				} `json:"data"`
+			}
+			if err := fetchJSON(client, http.MethodGet, *base+"/loki/api/v1/query_range?"+q.Encode(), nil, &resp); err != nil {
+				return nil, err
+			}
+			var records [][]byte
+			for _, stream := range resp.Data.Result {
+				for _, v := range stream.Values {
+					records = append(records, []byte(v[1]))
+				}
+			}
+			return records, nil
+		}
+	case "elasticsearch":
+		poll = func() ([][]byte, error) {
+			q := url.Values{"q": {strconv.Quote(key)}, "size": {"10000"}}
+			var resp struct {
+				Hits struct {
+					Hits []struct {
+						Source json.RawMessage `json:"_source"`
+					} `json:"hits"`
+				} `json:"hits"`
+			}
+			if err := fetchJSON(client, http.MethodGet, *base+"/"+*index+"/_search?"+q.Encode(), nil, &resp); err != nil {
+				return nil, err
+			}
+			var records [][]byte
+			for _, hit := range resp.Hits.Hits {
+				records = append(records, hit.Source)
+			}
+			return records, nil
+		}
+	case "clickhouse":
+		poll = func() ([][]byte, error) {
+			sql := fmt.Sprintf("SELECT %s FROM %s WHERE %s LIKE '%%__probe?key=%s&%%' FORMAT TSV", *column, *table, *column, key)
+			req, err := http.NewRequest(http.MethodPost, *base+"/", strings.NewReader(sql))
+			if err != nil {
+				return nil, err
+			}
+			body, err := fetch(client, req)
+			if err != nil {
+				return nil, err
+			}
+			return bytes.Split(bytes.TrimSpace(body), []byte("\n")), nil
+		}
+	case "kafka":
+		opts := []kgo.Opt{
+			kgo.SeedBrokers(parseEnvList(*base)...),
+			kgo.ConsumeTopics(*topic),
+			kgo.ConsumeResetOffset(kgo.NewOffset().AtEnd()),
+		}
+		if *readCommitted {
+			opts = append(opts, kgo.FetchIsolationLevel(kgo.ReadCommitted()))
+		}
+		consumer, err := kgo.NewClient(opts...)
+		if err != nil {
+			return fmt.Errorf("creating kafka client: %w", err)
+		}
+		defer consumer.Close()
+		cumulative = false
+		poll = func() ([][]byte, error) {
+			ctx, cancel := context.WithTimeout(context.Background(), *every)
+			defer cancel()
+			fetches := consumer.PollFetches(ctx)
+			for _, fe := range fetches.Errors() {
+				if !errors.Is(fe.Err, context.DeadlineExceeded) {
+					return nil, fe.Err
+				}
+			}
+			var records [][]byte
+			fetches.EachRecord(func(r *kgo.Record) { records = append(records, r.Value) })
+			return records, nil
+		}
+	default:
+		return fmt.Errorf("unknown backend %q (want loki, elasticsearch, clickhouse or kafka)", *backend)
+	}
+
+	probeRE := regexp.MustCompile(`__probe\?key=` + regexp.QuoteMeta(key) + `(?:&|\\u0026)seq=(\d+)(?:&|\\u0026)emit=(\d+)`)
+	// copies counts how many times each probe was stored
+	copies := map[uint64]int{}
+	var latencies []time.Duration
+
+	ticker := time.NewTicker(*every)
+	defer ticker.Stop()
+	for deadline := start.Add(*duration); time.Now().Before(deadline); <-ticker.C {
+		records, err := poll()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "query failed:", err)
+			continue
+		}
+		polled := time.Now()
+		found := map[uint64]int{}
+		for _, record := range records {
+			// A record may mention its URI more than once, as in the url
+			// and uri fields of JSON entries
+			m := probeRE.FindSubmatch(record)
+			if m == nil {
+				continue
+			}
+			seq, _ := strconv.ParseUint(string(m[1]), 10, 64)
+			emit, _ := strconv.ParseInt(string(m[2]), 10, 64)
+			// Only probes written while polling give meaningful latencies
+			if emit < start.UnixNano() {
+				continue
+			}
+			if copies[seq] == 0 && found[seq] == 0 {
+				latencies = append(latencies, polled.Sub(time.Unix(0, emit)))
+			}
+			found[seq]++
+		}
+		for seq, n := range found {
+			if cumulative {
+				copies[seq] = max(copies[seq], n)
+			} else {
+				copies[seq] += n
+			}
+		}
+	}
+
+	if len(latencies) == 0 {
+		return fmt.Errorf("no probes found; is the generator running with PROBE_INTERVAL and PROBE_KEY=%s?", key)
+	}
+	// Probes are numbered from 1, so gaps between the first and last one
+	// seen were lost
+	var duplicates int
+	first, last := uint64(math.MaxUint64), uint64(0)
+	for seq, n := range copies {
+		duplicates += n - 1
+		first, last = min(first, seq), max(last, seq)
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	pct := func(p float64) string {
+		return latencies[int(p*float64(len(latencies)-1))].Round(time.Millisecond).String()
+	}
+	return json.NewEncoder(os.Stdout).Encode(map[string]interface{}{
+		"probes":     len(latencies),
+		"duplicates": duplicates,
+		"missing":    int(last-first+1) - len(copies),
+		"resolution": every.String(),
+		"p50":        pct(0.5),
+		"p90":        pct(0.9),
+		"p99":        pct(0.99),
+		"max":        pct(1),
+	})
+}
+
+// fetchJSON sends a request and decodes the JSON body of a 2xx response
+// into v.
+func fetchJSON(client *http.Client, method, url string, body io.Reader, v interface{}) error {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return err
+	}
+	b, err := fetch(client, req)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// fetch sends req and returns the response body of a 2xx response.
+func fetch(client *http.Client, req *http.Request) ([]byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("%s %s: %s", req.Method, req.URL, resp.Status)
+	}
+	return body, nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/caarlos0/env/v6"
+)
+
+// profiles are the presets PROFILE selects: defaults for the variables a
+// site of that kind would be tuned with. Variables set explicitly win over
+// the preset. Repeated list values weight the draw.
+var profiles = map[string]map[string]string{
+	"blog": {
+		"IP_ADDRESSES":        "203.0.113.10,203.0.113.25,198.51.100.7,198.51.100.42,192.0.2.15,192.0.2.99",
+		"HOSTS":               "blog.example.com",
+		"HTTP_METHODS":        "GET,GET,GET,GET,GET,GET,GET,GET,HEAD,POST",
+		"PATHS":               "/,/blog,/blog/2024/05/hello-world,/blog/2024/06/scaling-nginx,/blog/tags/go,/about,/feed.xml,/sitemap.xml,/wp-login.php,/static/css/main.css,/static/js/app.js,/images/cover.jpg",
+		"STATUS_CODES":        "200,200,200,200,200,200,200,200,304,304,301,404",
+		"LATENCY_MEDIAN":      "0.04",
+		"LATENCY_P99":         "0.8",
+		"USER_AGENT_MIX":      "browser:55,mobile:30,bot:15",
+		"METHOD_PATH_RULES":   "true",
+		"REFERRER_NAVIGATION": "true",
+	},
+	"ecommerce": {
+		"IP_ADDRESSES":        "203.0.113.10,203.0.113.25,198.51.100.7,198.51.100.42,192.0.2.15,192.0.2.99",
+		"HOSTS":               "shop.example.com,www.shop.example.com",
+		"HTTP_METHODS":        "GET,GET,GET,GET,GET,GET,POST,POST,PUT,DELETE",
+		"PATHS":               "/,/catalog,/catalog/shoes,/catalog/jackets,/product/10234,/product/10877,/search,/cart,/checkout,/api/cart/items,/api/orders,/account/login,/static/js/app.js,/images/products/10234.jpg",
+		"STATUS_CODES":        "200,200,200,200,200,200,200,201,302,304,400,404,500",
+		"LATENCY_MEDIAN":      "0.12",
+		"LATENCY_P99":         "1.5",
+		"USER_AGENT_MIX":      "browser:50,mobile:45,bot:5",
+		"METHOD_PATH_RULES":   "true",
+		"STATUS_METHOD_RULES": "true",
+		"REFERRER_NAVIGATION": "true",
+	},
+	"api": {
+		"IP_ADDRESSES":        "10.0.1.12,10.0.1.27,10.0.2.8,10.0.2.31,203.0.113.10,198.51.100.7",
+		"HOSTS":               "api.example.com",
+		"HTTP_METHODS":        "GET,GET,GET,GET,POST,POST,PUT,PATCH,DELETE",
+		"PATHS":               "/api/v1/users,/api/v1/users/42,/api/v1/orders,/api/v1/orders/1001,/api/v1/orders/1001/items,/api/v1/auth/token,/api/v1/search,/healthz",
+		"STATUS_CODES":        "200,200,200,200,200,200,201,204,400,401,403,404,409,422,429,500,503",
+		"LATENCY_MEDIAN":      "0.025",
+		"LATENCY_P99":         "0.4",
+		"USER_AGENT_MIX":      "client:85,browser:10,bot:5",
+		"METHOD_PATH_RULES":   "true",
+		"STATUS_METHOD_RULES": "true",
+	},
+	"cdn": {
+		"IP_ADDRESSES":   "203.0.113.10,203.0.113.25,198.51.100.7,198.51.100.42,192.0.2.15,192.0.2.99",
+		"HOSTS":          "cdn.example.com,static.example.com",
+		"HTTP_METHODS":   "GET,GET,GET,GET,GET,GET,GET,GET,GET,HEAD",
+		"PATHS":          "/assets/app.3f2a1c.js,/assets/vendor.9b8e7d.js,/assets/main.51c0e2.css,/images/hero.webp,/images/logo.svg,/fonts/inter.woff2,/video/intro.mp4,/favicon.ico",
+		"STATUS_CODES":   "200,200,200,200,200,200,304,304,304,206,404",
+		"LATENCY_MEDIAN": "0.004",
+		"LATENCY_P99":    "0.09",
+		"USER_AGENT_MIX": "browser:55,mobile:40,bot:5",
+		"HEADER_FIELDS":  "true",
+	},
+}
+
+// parseConfig reads the configuration from environ on top of the preset
+// named by its PROFILE.
+func parseConfig(environ map[string]string) (config, error) {
+	cfg := config{}
+	if err := env.Parse(&cfg, env.Options{Environment: environ}); err != nil {
+		return cfg, err
+	}
+	cfg.environ = environ
+	if cfg.Profile == "" {
+		return cfg, nil
+	}
+	preset, ok := profiles[cfg.Profile]
+	if !ok {
+		names := make([]string, 0, len(profiles))
+		for name := range profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return cfg, fmt.Errorf("unknown PROFILE %q (want one of %s)", cfg.Profile, strings.Join(names, ", "))
+	}
+
+	merged := make(map[string]string, len(environ)+len(preset))
+	for k, v := range preset {
+		merged[k] = v
+	}
+	for k, v := range environ {
+		merged[k] = v
+	}
+	cfg = config{}
+	if err := env.Parse(&cfg, env.Options{Environment: merged}); err != nil {
+		return cfg, err
+	}
+	cfg.environ = merged
+	return cfg, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// pullBuffer keeps the most recent lines for the /logs pull API. Every line
+// gets a sequence number; a cursor is the sequence number of the last line
+// a consumer has seen.
+type pullBuffer struct {
+	mu    sync.Mutex
+	lines [][]byte
+	next  uint64 // sequence number of the next line
+}
+
+func newPullBuffer(size int) *pullBuffer {
+	return &pullBuffer{lines: make([][]byte, size)}
+}
+
+func (b *pullBuffer) add(line []byte) {
+	b.mu.Lock()
+	b.lines[b.next%uint64(len(b.lines))] = line
+	b.next++
+	b.mu.Unlock()
+}
+
+// page returns up to limit lines after cursor, the cursor of the last line
+// returned, whether more lines are buffered, and whether lines after cursor
+// were already evicted.
+func (b *pullBuffer) page(cursor uint64, limit int) (lines [][]byte, next uint64, more, gap bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	oldest := uint64(0)
+	if b.next > uint64(len(b.lines)) {
+		oldest = b.next - uint64(len(b.lines))
+	}
+	if cursor > b.next {
+		cursor = b.next
+	}
+	if cursor < oldest {
+		cursor, gap = oldest, true
+	}
+	for seq := cursor; seq < b.next && len(lines) < limit; seq++ {
+		lines = append(lines, b.lines[seq%uint64(len(b.lines))])
+	}
+	next = cursor + uint64(len(lines))
+	return lines, next, next < b.next, gap
+}
+
+// pullSink passes records on to the next sink and buffers their lines.
+type pullSink struct {
+	next sink
+	buf  *pullBuffer
+}
+
+func (s *pullSink) Send(r record) error {
+	s.buf.add(r.Line)
+	return s.next.Send(r)
+}
+
+func (s *pullSink) Flush() error {
+	return flushSink(s.next)
+}
+
+func (s *pullSink) Close() error {
+	return s.next.Close()
+}
+
+// servePull answers GET /logs?since=CURSOR&limit=N the way vendor log APIs
+// do: a page of events, the cursor to continue from and whether to poll
+// again right away. A missing since starts at the oldest buffered line;
+// "truncated" reports lines evicted before the consumer fetched them.
+func servePull(w http.ResponseWriter, req *http.Request, b *pullBuffer) {
+	q := req.URL.Query()
+	var cursor uint64
+	if s := q.Get("since"); s != "" {
+		var err error
+		if cursor, err = strconv.ParseUint(s, 10, 64); err != nil {
+			http.Error(w, "invalid since cursor", http.StatusBadRequest)
+			return
+		}
+	}
+	limit := 100
+	if s := q.Get("limit"); s != "" {
+		var err error
+		if limit, err = strconv.Atoi(s); err != nil || limit <= 0 || limit > 1000 {
+			http.Error(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+			return
+		}
+	}
+
+	lines, next, more, gap := b.page(cursor, limit)
+	events := make([]json.RawMessage, len(lines))
+	for i, line := range lines {
+		events[i] = jsonValue(line)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Events     []json.RawMessage `json:"events"`
+		NextCursor string            `json:"next_cursor"`
+		HasMore    bool              `json:"has_more"`
+		Truncated  bool              `json:"truncated"`
+	}{events, strconv.FormatUint(next, 10), more, gap})
+}
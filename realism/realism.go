@@ -0,0 +1,210 @@
+// Package realism holds the realism guarantees of the access log entries
+// nginx-log-generator writes, as properties over their fields. The check
+// command verifies them on generated streams; tests of new fields can use
+// them to make sure the rest of the entry stays consistent.
+package realism
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Entry holds the fields of an access log entry the invariants look at. Its
+// JSON tags follow the generator's json output, so a line decodes into it.
+type Entry struct {
+	HTTP  HTTP  `json:"http"`
+	Nginx Nginx `json:"nginx"`
+}
+
+// HTTP holds the request and response fields of an Entry.
+type HTTP struct {
+	RequestID      string  `json:"request_id"`
+	StatusCode     int     `json:"status_code"`
+	URL            string  `json:"url"`
+	Host           string  `json:"host"`
+	URI            string  `json:"uri"`
+	RequestTime    float64 `json:"request_time"`
+	Protocol       string  `json:"protocol"`
+	ServerProtocol string  `json:"server_protocol"`
+	BytesSent      string  `json:"bytes_sent"`
+	ContentLength  string  `json:"content_length"`
+	Scheme         string  `json:"scheme"`
+}
+
+// Nginx holds the connection, upstream and ingress fields of an Entry.
+type Nginx struct {
+	XForwardFor          string `json:"x-forward-for"`
+	RemoteAddr           string `json:"remote_addr"`
+	UpstreamAddr         string `json:"upstream_addr"`
+	UpstreamStatus       string `json:"upstream_status"`
+	UpstreamResponseTime string `json:"upstream_response_time"`
+	SSLProtocol          string `json:"ssl_protocol"`
+	SSLServerName        string `json:"ssl_server_name"`
+	IngressName          string `json:"ingress_name"`
+	XOriginalURI         string `json:"x_original_uri"`
+	UpstreamURI          string `json:"upstream_uri"`
+}
+
+// SizeRange bounds the body sizes of responses with a status code, as
+// BYTES_SENT_PROFILE sets them.
+type SizeRange struct {
+	Min, Max int
+}
+
+// Invariant is a realism guarantee every generated entry keeps, whatever
+// the configuration. Check returns why e breaks it, or "". sizes may be
+// nil, which leaves body sizes unchecked.
+type Invariant struct {
+	Name  string
+	Check func(e *Entry, sizes map[int]SizeRange) string
+}
+
+var requestIDPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+// Invariants are the properties every entry keeps. New fields should come
+// with the invariants that tie them to the rest of the entry.
+var Invariants = []Invariant{
+	{"valid_addresses", func(e *Entry, _ map[int]SizeRange) string {
+		if net.ParseIP(e.Nginx.RemoteAddr) == nil {
+			return fmt.Sprintf("remote_addr %q is not an IP address", e.Nginx.RemoteAddr)
+		}
+		for _, hop := range strings.Split(e.Nginx.XForwardFor, ", ") {
+			if net.ParseIP(hop) == nil {
+				return fmt.Sprintf("x-forward-for %q lists %q, not an IP address", e.Nginx.XForwardFor, hop)
+			}
+		}
+		return ""
+	}},
+	{"valid_url", func(e *Entry, _ map[int]SizeRange) string {
+		if !strings.HasPrefix(e.HTTP.URI, "/") {
+			return fmt.Sprintf("uri %q does not start with /", e.HTTP.URI)
+		}
+		if _, err := url.ParseRequestURI(e.HTTP.URI); err != nil {
+			return fmt.Sprintf("uri %q: %v", e.HTTP.URI, err)
+		}
+		if u, err := url.Parse("https://" + e.HTTP.URL); err != nil || u.Host == "" {
+			return fmt.Sprintf("url %q is not host and path", e.HTTP.URL)
+		}
+		return ""
+	}},
+	{"valid_request_id", func(e *Entry, _ map[int]SizeRange) string {
+		if !requestIDPattern.MatchString(e.HTTP.RequestID) {
+			return fmt.Sprintf("request_id %q is not a version 4 UUID", e.HTTP.RequestID)
+		}
+		return ""
+	}},
+	{"valid_status", func(e *Entry, _ map[int]SizeRange) string {
+		if e.HTTP.StatusCode < 100 || e.HTTP.StatusCode > 599 {
+			return fmt.Sprintf("status %d is outside 100-599", e.HTTP.StatusCode)
+		}
+		return ""
+	}},
+	{"valid_protocol", func(e *Entry, _ map[int]SizeRange) string {
+		switch {
+		case !strings.HasPrefix(e.HTTP.Protocol, "HTTP/"):
+			return fmt.Sprintf("protocol %q is not an HTTP version", e.HTTP.Protocol)
+		case e.HTTP.ServerProtocol != e.HTTP.Protocol:
+			return fmt.Sprintf("server_protocol %q differs from protocol %q", e.HTTP.ServerProtocol, e.HTTP.Protocol)
+		}
+		return ""
+	}},
+	{"request_time", func(e *Entry, _ map[int]SizeRange) string {
+		if e.HTTP.RequestTime < 0 || math.IsNaN(e.HTTP.RequestTime) {
+			return fmt.Sprintf("request_time %v is negative", e.HTTP.RequestTime)
+		}
+		return ""
+	}},
+	{"bytes_match_status", func(e *Entry, sizes map[int]SizeRange) string {
+		n, err := strconv.Atoi(e.HTTP.BytesSent)
+		switch {
+		case err != nil || n < 0:
+			return fmt.Sprintf("bytes_sent %q is not a size", e.HTTP.BytesSent)
+		case e.HTTP.ContentLength != "" && e.HTTP.ContentLength != e.HTTP.BytesSent:
+			return fmt.Sprintf("content_length %s differs from bytes_sent %s", e.HTTP.ContentLength, e.HTTP.BytesSent)
+		}
+		if r, ok := sizes[e.HTTP.StatusCode]; ok && (n < r.Min || n > r.Max) {
+			return fmt.Sprintf("bytes_sent %d of a %d is outside %d-%d", n, e.HTTP.StatusCode, r.Min, r.Max)
+		}
+		return ""
+	}},
+	{"upstream_matches_request", func(e *Entry, _ map[int]SizeRange) string {
+		if e.Nginx.UpstreamAddr == "" {
+			return ""
+		}
+		addrs := strings.Split(e.Nginx.UpstreamAddr, ", ")
+		statuses := strings.Split(e.Nginx.UpstreamStatus, ", ")
+		times := strings.Split(e.Nginx.UpstreamResponseTime, ", ")
+		if len(statuses) != len(addrs) || len(times) != len(addrs) {
+			return fmt.Sprintf("upstream_addr %q, upstream_status %q and upstream_response_time %q list different attempts", e.Nginx.UpstreamAddr, e.Nginx.UpstreamStatus, e.Nginx.UpstreamResponseTime)
+		}
+		if last := statuses[len(statuses)-1]; last != "-" && last != strconv.Itoa(e.HTTP.StatusCode) {
+			return fmt.Sprintf("last upstream_status %s differs from status %d", last, e.HTTP.StatusCode)
+		}
+		total := 0.0
+		for _, t := range times {
+			v, err := strconv.ParseFloat(t, 64)
+			if err != nil || v < 0 {
+				return fmt.Sprintf("upstream_response_time %q is not a list of durations", e.Nginx.UpstreamResponseTime)
+			}
+			total += v
+		}
+		// Both are logged with millisecond precision
+		if total > e.HTTP.RequestTime+0.001 {
+			return fmt.Sprintf("upstream_response_time %s exceeds request_time %.3f", e.Nginx.UpstreamResponseTime, e.HTTP.RequestTime)
+		}
+		return ""
+	}},
+	{"rewrite_keeps_request", func(e *Entry, _ map[int]SizeRange) string {
+		if e.Nginx.IngressName == "" {
+			return ""
+		}
+		_, query, _ := strings.Cut(e.HTTP.URI, "?")
+		_, upstreamQuery, _ := strings.Cut(e.Nginx.UpstreamURI, "?")
+		switch {
+		case e.Nginx.XOriginalURI != e.HTTP.URI:
+			return fmt.Sprintf("x_original_uri %q differs from uri %q", e.Nginx.XOriginalURI, e.HTTP.URI)
+		case !strings.HasPrefix(e.Nginx.UpstreamURI, "/") || upstreamQuery != query:
+			return fmt.Sprintf("upstream_uri %q is not a rewrite of %q", e.Nginx.UpstreamURI, e.HTTP.URI)
+		}
+		return ""
+	}},
+	{"tls_matches_scheme", func(e *Entry, _ map[int]SizeRange) string {
+		switch {
+		case e.Nginx.SSLProtocol != "" && e.HTTP.Scheme != "https":
+			return fmt.Sprintf("ssl_protocol %s on a %q request", e.Nginx.SSLProtocol, e.HTTP.Scheme)
+		case e.Nginx.SSLProtocol != "" && e.Nginx.SSLServerName != e.HTTP.Host:
+			return fmt.Sprintf("ssl_server_name %q differs from host %q", e.Nginx.SSLServerName, e.HTTP.Host)
+		case e.HTTP.Scheme == "http" && (e.HTTP.Protocol == "HTTP/2.0" || e.HTTP.Protocol == "HTTP/3.0"):
+			return fmt.Sprintf("%s over plain HTTP", e.HTTP.Protocol)
+		case e.HTTP.Protocol == "HTTP/3.0" && e.Nginx.SSLProtocol != "" && e.Nginx.SSLProtocol != "TLSv1.3":
+			return fmt.Sprintf("HTTP/3.0 over %s", e.Nginx.SSLProtocol)
+		}
+		return ""
+	}},
+}
+
+// Violation is an invariant an entry breaks, and why.
+type Violation struct {
+	Invariant string
+	Reason    string
+}
+
+func (v Violation) String() string {
+	return v.Invariant + ": " + v.Reason
+}
+
+// Check returns the invariants e breaks.
+func Check(e *Entry, sizes map[int]SizeRange) []Violation {
+	var violations []Violation
+	for _, inv := range Invariants {
+		if why := inv.Check(e, sizes); why != "" {
+			violations = append(violations, Violation{inv.Name, why})
+		}
+	}
+	return violations
+}
@@ -0,0 +1,177 @@
+package realism
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/quick"
+)
+
+// validLine is a json line of the generator with upstream, TLS and rewrite
+// fields.
+const validLine = `{"ts":"2024-01-01T00:00:00Z","http":{"request_id":"b0e25b30-eec2-46e0-a6bc-b1f1cf76435c","method":"GET","status_code":200,"url":"example.com/api/v1/users?id=3","host":"example.com","uri":"/api/v1/users?id=3","request_time":0.25,"user_agent":"Mozilla/5.0","protocol":"HTTP/2.0","trace_session_id":"","server_protocol":"HTTP/2.0","content_type":"application/json","bytes_sent":"1024","scheme":"https","content_length":"1024"},"nginx":{"x-forward-for":"203.0.113.7, 10.1.2.3","remote_addr":"10.0.0.10","http_referrer":"","upstream_addr":"10.244.0.5:8080, 10.244.0.6:8080","upstream_status":"502, 200","upstream_response_time":"0.050, 0.190","ssl_protocol":"TLSv1.3","ssl_cipher":"TLS_AES_128_GCM_SHA256","ssl_server_name":"example.com","ingress_name":"api","x_original_uri":"/api/v1/users?id=3","upstream_uri":"/v1/users?id=3"}}`
+
+func validEntry(t *testing.T) *Entry {
+	t.Helper()
+	var e Entry
+	if err := json.Unmarshal([]byte(validLine), &e); err != nil {
+		t.Fatal(err)
+	}
+	return &e
+}
+
+func TestValidEntryKeepsInvariants(t *testing.T) {
+	sizes := map[int]SizeRange{200: {Min: 800, Max: 3100}}
+	if v := Check(validEntry(t), sizes); len(v) > 0 {
+		t.Errorf("Check(valid entry) = %v, want none", v)
+	}
+}
+
+func TestInvariantsCatchBrokenEntries(t *testing.T) {
+	tests := []struct {
+		invariant string
+		breakIt   func(e *Entry)
+	}{
+		{"valid_addresses", func(e *Entry) { e.Nginx.RemoteAddr = "999.0.0.1" }},
+		{"valid_addresses", func(e *Entry) { e.Nginx.XForwardFor = "203.0.113.7,10.1.2.3" }},
+		{"valid_url", func(e *Entry) { e.HTTP.URI = "api/v1/users" }},
+		{"valid_url", func(e *Entry) { e.HTTP.URL = "/api/v1/users" }},
+		{"valid_request_id", func(e *Entry) { e.HTTP.RequestID = "b0e25b30eec246e0a6bcb1f1cf76435c" }},
+		{"valid_status", func(e *Entry) { e.HTTP.StatusCode = 700 }},
+		{"valid_protocol", func(e *Entry) { e.HTTP.ServerProtocol = "HTTP/1.1" }},
+		{"request_time", func(e *Entry) { e.HTTP.RequestTime = -0.001 }},
+		{"bytes_match_status", func(e *Entry) { e.HTTP.BytesSent = "-" }},
+		{"bytes_match_status", func(e *Entry) { e.HTTP.ContentLength = "512" }},
+		{"bytes_match_status", func(e *Entry) { e.HTTP.BytesSent, e.HTTP.ContentLength = "99", "" }},
+		{"upstream_matches_request", func(e *Entry) { e.Nginx.UpstreamStatus = "200" }},
+		{"upstream_matches_request", func(e *Entry) { e.Nginx.UpstreamStatus = "502, 504" }},
+		{"upstream_matches_request", func(e *Entry) { e.HTTP.RequestTime = 0.1 }},
+		{"rewrite_keeps_request", func(e *Entry) { e.Nginx.UpstreamURI = "/v1/users" }},
+		{"rewrite_keeps_request", func(e *Entry) { e.Nginx.XOriginalURI = "/v1/users?id=3" }},
+		{"tls_matches_scheme", func(e *Entry) { e.HTTP.Scheme = "http" }},
+		{"tls_matches_scheme", func(e *Entry) { e.Nginx.SSLServerName = "other.org" }},
+	}
+	sizes := map[int]SizeRange{200: {Min: 800, Max: 3100}}
+	for _, tt := range tests {
+		e := validEntry(t)
+		tt.breakIt(e)
+		v := Check(e, sizes)
+		if !slices.ContainsFunc(v, func(v Violation) bool { return v.Invariant == tt.invariant }) {
+			t.Errorf("%+v: Check = %v, want %s among them", *e, v, tt.invariant)
+		}
+	}
+}
+
+// upstreamAttempts returns the fields of an entry whose upstream attempts
+// took the given milliseconds, the last one answering status.
+func upstreamAttempts(millis []uint16, status int) (addrs, statuses, times string) {
+	var a, s, ts []string
+	for i, ms := range millis {
+		a = append(a, fmt.Sprintf("10.244.0.%d:8080", i+1))
+		s = append(s, "502")
+		ts = append(ts, strconv.FormatFloat(float64(ms)/1000, 'f', 3, 64))
+	}
+	s[len(s)-1] = strconv.Itoa(status)
+	return strings.Join(a, ", "), strings.Join(s, ", "), strings.Join(ts, ", ")
+}
+
+// The request lasts at least as long as all its upstream attempts together.
+func TestRequestTimeBoundsUpstreamTimes(t *testing.T) {
+	property := func(millis []uint16, extra uint16) bool {
+		if len(millis) == 0 {
+			return true
+		}
+		e := validEntry(t)
+		e.Nginx.UpstreamAddr, e.Nginx.UpstreamStatus, e.Nginx.UpstreamResponseTime = upstreamAttempts(millis, e.HTTP.StatusCode)
+		total := 0
+		for _, ms := range millis {
+			total += int(ms)
+		}
+		e.HTTP.RequestTime = float64(total+int(extra)) / 1000
+		kept := Check(e, nil) == nil
+		// A request shorter than its attempts by more than the precision
+		// of the fields breaks the invariant
+		e.HTTP.RequestTime = float64(total-2) / 1000
+		broken := total < 2 || Check(e, nil) != nil
+		return kept && broken
+	}
+	if err := quick.Check(property, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+// Any body size within the range of its status passes, any outside fails.
+func TestBytesSentWithinStatusRange(t *testing.T) {
+	property := func(code uint16, lo, width, n uint16) bool {
+		status := 100 + int(code)%500
+		r := SizeRange{Min: int(lo), Max: int(lo) + int(width)}
+		e := validEntry(t)
+		e.HTTP.StatusCode = status
+		e.HTTP.BytesSent, e.HTTP.ContentLength = strconv.Itoa(int(n)), ""
+		e.Nginx.UpstreamAddr = ""
+		inside := int(n) >= r.Min && int(n) <= r.Max
+		return (Check(e, map[int]SizeRange{status: r}) == nil) == inside
+	}
+	if err := quick.Check(property, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+// Every IPv4 or IPv6 address is a valid client, and so is every chain of
+// them; other strings are not.
+func TestValidAddresses(t *testing.T) {
+	property := func(v4 [4]byte, v6 [16]byte, hops uint8) bool {
+		e := validEntry(t)
+		client := net.IP(v4[:]).String()
+		chain := []string{client}
+		for range hops % 4 {
+			chain = append(chain, net.IP(v6[:]).String())
+		}
+		e.Nginx.RemoteAddr, e.Nginx.XForwardFor = client, strings.Join(chain, ", ")
+		if Check(e, nil) != nil {
+			return false
+		}
+		e.Nginx.XForwardFor += ", unknown"
+		return Check(e, nil) != nil
+	}
+	if err := quick.Check(property, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+// Paths made of unreserved characters and percent-encoded bytes, with an
+// optional query, are valid URIs and URLs.
+func TestValidURLs(t *testing.T) {
+	const unreserved = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-._~"
+	property := func(segments [][]byte, query []byte) bool {
+		var path strings.Builder
+		for _, seg := range segments {
+			path.WriteByte('/')
+			for _, b := range seg {
+				if strings.IndexByte(unreserved, b) >= 0 {
+					path.WriteByte(b)
+				} else {
+					fmt.Fprintf(&path, "%%%02X", b)
+				}
+			}
+		}
+		uri := path.String()
+		if uri == "" {
+			uri = "/"
+		}
+		if len(query) > 0 {
+			uri += "?q=" + fmt.Sprintf("%x", query)
+		}
+		e := validEntry(t)
+		e.HTTP.URI, e.HTTP.URL = uri, e.HTTP.Host+uri
+		e.Nginx.IngressName = ""
+		return Check(e, nil) == nil
+	}
+	if err := quick.Check(property, nil); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// region is a simulated datacenter with its own latency baseline and,
+// optionally, its own client IP pool.
+type region struct {
+	name    string
+	latency float64
+	clients *net.IPNet
+}
+
+// pod is a single simulated ingress controller replica.
+type pod struct {
+	name   string
+	zone   string
+	region *region
+}
+
+// parseRegions parses REGIONS entries of the form
+// name:pods[:latency[:cidr]], e.g. "eu-west-1:3:0.020:10.1.0.0/16", and
+// returns the pods of all regions. Pods are spread over zones a, b and c of
+// their region.
+func parseRegions(spec string) ([]*pod, error) {
+	var pods []*pod
+	for _, part := range parseEnvList(spec) {
+		fields := strings.Split(strings.TrimSpace(part), ":")
+		if len(fields) < 2 || len(fields) > 4 || fields[0] == "" {
+			return nil, fmt.Errorf("invalid REGIONS entry %q (want name:pods[:latency[:cidr]])", part)
+		}
+		r := &region{name: fields[0]}
+		count, err := strconv.Atoi(fields[1])
+		if err != nil || count < 1 {
+			return nil, fmt.Errorf("invalid pod count in REGIONS entry %q", part)
+		}
+		if len(fields) > 2 && fields[2] != "" {
+			if r.latency, err = strconv.ParseFloat(fields[2], 64); err != nil {
+				return nil, fmt.Errorf("invalid latency in REGIONS entry %q: %w", part, err)
+			}
+		}
+		if len(fields) > 3 {
+			if _, r.clients, err = net.ParseCIDR(fields[3]); err != nil || r.clients.IP.To4() == nil {
+				return nil, fmt.Errorf("invalid IPv4 CIDR in REGIONS entry %q", part)
+			}
+		}
+		for i := 0; i < count; i++ {
+			pods = append(pods, &pod{
+				name:   fmt.Sprintf("ingress-nginx-controller-%s-%d", r.name, i),
+				zone:   r.name + string(rune('a'+i%3)),
+				region: r,
+			})
+		}
+	}
+	return pods, nil
+}
+
+// randomIP returns a random host address within an IPv4 network.
+func randomIP(rnd *rand.Rand, n *net.IPNet) string {
+	ones, bits := n.Mask.Size()
+	base := binary.BigEndian.Uint32(n.IP.To4())
+	offset := uint32(0)
+	if size := uint64(1) << (bits - ones); size > 2 {
+		// Skip the network and broadcast addresses
+		offset = uint32(rnd.Int63n(int64(size-2))) + 1
+	}
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, base+offset)
+	return ip.String()
+}
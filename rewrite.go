@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ingressRewrite is an ingress with the use-regex and rewrite-target
+// annotations of ingress-nginx: requests whose path matches pattern reach
+// the upstream at target, in which $1, $2... stand for the groups.
+type ingressRewrite struct {
+	name    string
+	pattern *regexp.Regexp
+	target  string
+}
+
+// parseIngressRewrites parses INGRESS_REWRITES entries of the form
+// "name:pattern=target", such as "api:/api(/|$)(.*)=/$2". Patterns match
+// from the start of the path, case-insensitively, like ingress-nginx
+// regex locations.
+func parseIngressRewrites(spec string) ([]ingressRewrite, error) {
+	var rules []ingressRewrite
+	for _, part := range parseEnvList(spec) {
+		part = strings.TrimSpace(part)
+		name, rest, ok1 := strings.Cut(part, ":")
+		pattern, target, ok2 := strings.Cut(rest, "=")
+		if !ok1 || !ok2 || name == "" || !strings.HasPrefix(pattern, "/") || !strings.HasPrefix(target, "/") {
+			return nil, fmt.Errorf("invalid INGRESS_REWRITES entry %q (want name:/pattern=/target, e.g. api:/api(/|$)(.*)=/$2)", part)
+		}
+		re, err := regexp.Compile("(?i)^" + pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern in INGRESS_REWRITES entry %q: %w", part, err)
+		}
+		rules = append(rules, ingressRewrite{name: name, pattern: re, target: target})
+	}
+	return rules, nil
+}
+
+// rewrite fills the ingress fields of e from the first rule matching its
+// path. The query string is passed on unchanged, as nginx appends it to a
+// rewritten URI.
+func (g *generator) rewrite(e *logEntry) {
+	path, query, hasQuery := strings.Cut(e.HTTP.URI, "?")
+	for _, rule := range g.rewrites {
+		m := rule.pattern.FindStringSubmatchIndex(path)
+		if m == nil {
+			continue
+		}
+		upstream := string(rule.pattern.ExpandString(nil, rule.target, path, m))
+		if !strings.HasPrefix(upstream, "/") {
+			upstream = "/" + upstream
+		}
+		if hasQuery {
+			upstream += "?" + query
+		}
+		e.Nginx.IngressName = rule.name
+		e.Nginx.XOriginalURI = e.HTTP.URI
+		e.Nginx.UpstreamURI = upstream
+		return
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	crand "crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	randv2 "math/rand/v2"
+	"sync"
+	"time"
+)
+
+// rng is the source of randomness outside of generators, which each draw
+// from their own stream (see streamSource). A SEED makes runs reproducible,
+// and the state of the default PCG backend can be saved and restored, which
+// backfill checkpoints rely on.
+var (
+	rngSource randSource = &pcgSource{pcg: randv2.NewPCG(uint64(time.Now().UnixNano()), 0)}
+	rng                  = rand.New(rngSource)
+	rngSeed   int64
+)
+
+// randSource is a backend of rng. Implementations serialize access so that
+// several instances can share them.
+type randSource interface {
+	rand.Source64
+	// state and restore save and load the position in the sequence, for
+	// checkpoints; backends that cannot do it return an error
+	state() ([]byte, error)
+	restore(state []byte) error
+}
+
+// newRandSource returns the RNG_BACKEND called name.
+func newRandSource(name string) (randSource, error) {
+	switch name {
+	case "pcg":
+		return &pcgSource{pcg: randv2.NewPCG(0, 0)}, nil
+	case "math":
+		return &mathSource{src: rand.NewSource(0).(rand.Source64)}, nil
+	case "crypto":
+		return cryptoSource{}, nil
+	default:
+		return nil, fmt.Errorf("unknown RNG_BACKEND %q", name)
+	}
+}
+
+// pcgSource adapts a PCG to math/rand.
+type pcgSource struct {
+	mu  sync.Mutex
+	pcg *randv2.PCG
+}
+
+func (s *pcgSource) Uint64() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pcg.Uint64()
+}
+
+func (s *pcgSource) Int63() int64 {
+	return int64(s.Uint64() >> 1)
+}
+
+func (s *pcgSource) Seed(seed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pcg.Seed(uint64(seed), uint64(seed)^0x9e3779b97f4a7c15)
+}
+
+func (s *pcgSource) state() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pcg.MarshalBinary()
+}
+
+func (s *pcgSource) restore(state []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pcg.UnmarshalBinary(state)
+}
+
+// mathSource is the math/rand generator: the fastest, but its state cannot
+// be saved.
+type mathSource struct {
+	mu  sync.Mutex
+	src rand.Source64
+}
+
+func (s *mathSource) Uint64() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.src.Uint64()
+}
+
+func (s *mathSource) Int63() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.src.Int63()
+}
+
+func (s *mathSource) Seed(seed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.src.Seed(seed)
+}
+
+func (s *mathSource) state() ([]byte, error) {
+	return nil, fmt.Errorf("RNG_BACKEND=math does not support checkpoints, use pcg")
+}
+
+func (s *mathSource) restore([]byte) error {
+	return fmt.Errorf("RNG_BACKEND=math does not support checkpoints, use pcg")
+}
+
+// cryptoSource reads crypto/rand. It cannot be seeded, so runs using it
+// are never reproducible.
+type cryptoSource struct{}
+
+func (cryptoSource) Uint64() uint64 {
+	var b [8]byte
+	if _, err := crand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return binary.BigEndian.Uint64(b[:])
+}
+
+func (s cryptoSource) Int63() int64 {
+	return int64(s.Uint64() >> 1)
+}
+
+func (cryptoSource) Seed(int64) {}
+
+func (cryptoSource) state() ([]byte, error) {
+	return nil, fmt.Errorf("RNG_BACKEND=crypto does not support checkpoints, use pcg")
+}
+
+func (cryptoSource) restore([]byte) error {
+	return fmt.Errorf("RNG_BACKEND=crypto does not support checkpoints, use pcg")
+}
+
+// seedRNG switches rng to backend and seeds it with seed, or with a random
+// seed when it is 0, and remembers the seed for checkpoints and for the
+// streams of the generators.
+func seedRNG(backend string, seed int64) error {
+	src, err := newRandSource(backend)
+	if err != nil {
+		return err
+	}
+	if _, ok := src.(cryptoSource); ok && seed != 0 {
+		return fmt.Errorf("SEED cannot be used with RNG_BACKEND=crypto")
+	}
+	for seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	rngSeed = seed
+	src.Seed(seed)
+	rngSource, rng = src, rand.New(src)
+	return nil
+}
+
+// streamSource returns a source for the stream named by RNG_STREAM. Its seed
+// derives from rngSeed and the name, so every stream, be it a pod sharing
+// SEED with others or an instance, is reproducible on its own. The unnamed
+// stream is mixed too, so that it does not replay the sequence of rng.
+func streamSource(cfg config) (randSource, error) {
+	src, err := newRandSource(cfg.RNGBackend)
+	if err != nil {
+		return nil, err
+	}
+	src.Seed(streamSeed(rngSeed, cfg.RNGStream))
+	return src, nil
+}
+
+func streamSeed(seed int64, stream string) int64 {
+	h := fnv.New64a()
+	h.Write(binary.BigEndian.AppendUint64(nil, uint64(seed)))
+	h.Write([]byte("stream/" + stream))
+	return int64(h.Sum64())
+}
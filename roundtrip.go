@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// formatRoundTrip renders an entry in one output format and parses the line
+// back with a reference parser, returning why the entry fails it, or "".
+type formatRoundTrip struct {
+	name  string
+	check func(e *logEntry) string
+}
+
+// lineParsers are the reference parsers of the built-in output formats.
+var lineParsers = []struct {
+	format string
+	parse  func(e *logEntry, line []byte) string
+}{
+	{"json", checkJSONLine},
+	{"combined", checkCombinedLine},
+	{"influx", checkInfluxLine},
+	{"winevent-xml", checkWinEventXMLLine},
+	{"winevent-json", checkWinEventJSONLine},
+	{"logfmt", checkLogfmtLine},
+	{"csv", checkCSVLine},
+}
+
+// formatRoundTrips returns the round trips of every built-in output format,
+// and of LOG_FORMAT when it is set.
+func formatRoundTrips(cfg config) ([]formatRoundTrip, error) {
+	var trips []formatRoundTrip
+	add := func(name string, c config, parse func(e *logEntry, line []byte) string) error {
+		format, err := newFormatter(c)
+		if err != nil {
+			return err
+		}
+		trips = append(trips, formatRoundTrip{name, func(e *logEntry) string {
+			line, err := format(e)
+			switch {
+			case err != nil:
+				return err.Error()
+			case bytes.ContainsAny(line, "\r\n"):
+				return fmt.Sprintf("line %q spans several lines", line)
+			}
+			return parse(e, line)
+		}})
+		return nil
+	}
+	for _, p := range lineParsers {
+		c := cfg
+		c.OutputFormat, c.LogFormat, c.OutputTemplate, c.OutputTemplateFile = p.format, "", "", ""
+		if err := add(p.format, c, p.parse); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.LogFormat != "" {
+		if err := add("LOG_FORMAT", cfg, checkEscapedLine); err != nil {
+			return nil, err
+		}
+	}
+	return trips, nil
+}
+
+// checkJSONLine decodes the line into an entry and requires it to encode
+// to the same line again.
+func checkJSONLine(_ *logEntry, line []byte) string {
+	var decoded logEntry
+	if err := json.Unmarshal(line, &decoded); err != nil {
+		return fmt.Sprintf("%v in %s", err, line)
+	}
+	again, err := json.Marshal(&decoded)
+	if err != nil || !bytes.Equal(again, line) {
+		return fmt.Sprintf("%s decodes to an entry encoding to %s", line, again)
+	}
+	return ""
+}
+
+// combinedReference is a strict parser of the combined format, as log
+// shippers use it: quoted fields may only contain escaped quotes.
+var combinedReference = regexp.MustCompile(`^(\S+) - (\S+) \[([^\]]+)\] "((?:[^"\\]|\\.)*)" (\d{3}) (\d+|-) "((?:[^"\\]|\\.)*)" "((?:[^"\\]|\\.)*)"$`)
+
+func checkCombinedLine(e *logEntry, line []byte) string {
+	m := combinedReference.FindStringSubmatch(string(line))
+	if m == nil {
+		return fmt.Sprintf("%s does not parse as combined", line)
+	}
+	t, err := time.Parse(timeLocalLayout, m[3])
+	want := map[string][2]string{
+		"remote_addr":     {m[1], e.Nginx.RemoteAddr},
+		"request":         {unescapeNginx(m[4]), e.HTTP.Method + " " + e.HTTP.URI + " " + e.HTTP.Protocol},
+		"status":          {m[5], strconv.Itoa(e.HTTP.StatusCode)},
+		"body_bytes_sent": {m[6], e.HTTP.BytesSent},
+		"http_referer":    {unescapeNginx(m[7]), orDash(e.Nginx.HTTPReferrer)},
+		"http_user_agent": {unescapeNginx(m[8]), orDash(e.HTTP.UserAgent)},
+	}
+	if err != nil || !t.Equal(e.Timestamp.Truncate(time.Second)) {
+		return fmt.Sprintf("time_local %q of %s is not the entry's time", m[3], line)
+	}
+	for name, v := range want {
+		if v[0] != v[1] {
+			return fmt.Sprintf("%s parses as %q, want %q, in %s", name, v[0], v[1], line)
+		}
+	}
+	return ""
+}
+
+// unescapeNginx reverses escapeNginx.
+func unescapeNginx(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) && s[i+1] == 'x' {
+			if c, err := strconv.ParseUint(s[i+2:i+4], 16, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// checkEscapedLine checks a LOG_FORMAT line, whose layout is the user's, for
+// what nginx's escaping guarantees: printable ASCII only.
+func checkEscapedLine(_ *logEntry, line []byte) string {
+	for _, c := range line {
+		if c < 0x20 || c > 0x7e {
+			return fmt.Sprintf("unescaped byte %#x in %q", c, line)
+		}
+	}
+	return ""
+}
+
+// checkInfluxLine splits the line protocol into measurement and tags, fields
+// and timestamp, and compares what the entry fills in.
+func checkInfluxLine(e *logEntry, line []byte) string {
+	sections := splitInflux(string(line), ' ')
+	if len(sections) != 3 {
+		return fmt.Sprintf("%s has %d space-separated sections, want 3", line, len(sections))
+	}
+	tags := map[string]string{}
+	for _, kv := range splitInflux(sections[0], ',')[1:] {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			return fmt.Sprintf("tag %q has no value in %s", kv, line)
+		}
+		tags[k] = influxUnescape(v)
+	}
+	fields := map[string]string{}
+	for _, kv := range splitInflux(sections[1], ',') {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			return fmt.Sprintf("field %q has no value in %s", kv, line)
+		}
+		if s, quoted := strings.CutPrefix(v, `"`); quoted {
+			if !strings.HasSuffix(s, `"`) {
+				return fmt.Sprintf("field %s is not terminated in %s", k, line)
+			}
+			v = strings.NewReplacer(`\"`, `"`, `\\`, `\`, `\n`, "\n").Replace(strings.TrimSuffix(s, `"`))
+		}
+		fields[k] = v
+	}
+	want := map[string][2]string{
+		"status tag":  {tags["status"], strconv.Itoa(e.HTTP.StatusCode)},
+		"method tag":  {tags["method"], e.HTTP.Method},
+		"uri":         {fields["uri"], e.HTTP.URI},
+		"request_id":  {fields["request_id"], e.HTTP.RequestID},
+		"remote_addr": {fields["remote_addr"], e.Nginx.RemoteAddr},
+		"timestamp":   {sections[2], strconv.FormatInt(e.Timestamp.UnixNano(), 10)},
+	}
+	for name, v := range want {
+		if v[0] != v[1] {
+			return fmt.Sprintf("%s parses as %q, want %q, in %s", name, v[0], v[1], line)
+		}
+	}
+	return ""
+}
+
+// splitInflux splits s at sep where it is neither escaped nor quoted.
+func splitInflux(s string, sep byte) []string {
+	var parts []string
+	quoted, start := false, 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func influxUnescape(s string) string {
+	return strings.NewReplacer(`\,`, ",", `\=`, "=", `\ `, " ").Replace(s)
+}
+
+// checkWinEventXMLLine decodes the event and compares its data with the
+// entry's flattened fields. XML cannot carry most control characters, so
+// values holding them only need to decode.
+func checkWinEventXMLLine(e *logEntry, line []byte) string {
+	var ev winEventXML
+	if err := xml.Unmarshal(line, &ev); err != nil {
+		return fmt.Sprintf("%v in %s", err, line)
+	}
+	data := map[string]string{}
+	for _, d := range ev.EventData.Data {
+		data[d.Name] = d.Value
+	}
+	return compareFlattened(e, data, line, true)
+}
+
+func checkWinEventJSONLine(e *logEntry, line []byte) string {
+	var ev winEventJSON
+	if err := json.Unmarshal(line, &ev); err != nil {
+		return fmt.Sprintf("%v in %s", err, line)
+	}
+	return compareFlattened(e, ev.Winlog.EventData, line, false)
+}
+
+func compareFlattened(e *logEntry, data map[string]string, line []byte, xmlText bool) string {
+	for _, f := range flattenEntry(e) {
+		if xmlText && strings.ContainsFunc(f.Value, func(r rune) bool { return r < 0x20 && r != '\t' && r != '\n' }) {
+			continue
+		}
+		if got, ok := data[f.Name]; !ok || got != f.Value {
+			return fmt.Sprintf("%s decodes as %q, want %q, in %s", f.Name, got, f.Value, line)
+		}
+	}
+	return ""
+}
+
+// checkLogfmtLine parses the pairs strictly and compares them with the
+// entry's flattened fields.
+func checkLogfmtLine(e *logEntry, line []byte) string {
+	pairs, err := parseLogfmt(string(line))
+	if err != nil {
+		return fmt.Sprintf("%v in %s", err, line)
+	}
+	return compareFlattened(e, pairs, line, false)
+}
+
+// parseLogfmt is a strict logfmt parser: pairs separated by single spaces,
+// each a key, "=" and either a bare value without spaces, quotes or equals
+// signs or a double-quoted value with Go escapes. Keys must be unique.
+func parseLogfmt(line string) (map[string]string, error) {
+	pairs := map[string]string{}
+	for line != "" {
+		key, rest, ok := strings.Cut(line, "=")
+		if !ok || key == "" || strings.ContainsAny(key, ` "`) {
+			return nil, fmt.Errorf("no key=value pair at %q", line)
+		}
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := 1
+			for end < len(rest) && rest[end] != '"' {
+				if rest[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(rest) {
+				return nil, fmt.Errorf("unterminated value of %s", key)
+			}
+			var err error
+			if value, err = strconv.Unquote(rest[:end+1]); err != nil {
+				return nil, fmt.Errorf("value of %s: %v", key, err)
+			}
+			rest = rest[end+1:]
+		} else {
+			end := strings.IndexByte(rest, ' ')
+			if end < 0 {
+				end = len(rest)
+			}
+			if value, rest = rest[:end], rest[end:]; strings.ContainsAny(value, `="`) {
+				return nil, fmt.Errorf("bare value %q of %s", value, key)
+			}
+		}
+		if rest != "" {
+			if rest = strings.TrimPrefix(rest, " "); rest == "" || rest[0] == ' ' {
+				return nil, fmt.Errorf("pairs are not separated by one space after %s", key)
+			}
+		}
+		if _, dup := pairs[key]; dup {
+			return nil, fmt.Errorf("duplicate key %s", key)
+		}
+		pairs[key] = value
+		line = rest
+	}
+	return pairs, nil
+}
+
+// checkCSVLine reads the line with encoding/csv as a single record of
+// csvColumns and compares the unescaped columns with the entry.
+func checkCSVLine(e *logEntry, line []byte) string {
+	r := csv.NewReader(bytes.NewReader(line))
+	r.FieldsPerRecord = len(csvColumns)
+	record, err := r.Read()
+	if err != nil {
+		return fmt.Sprintf("%v in %s", err, line)
+	}
+	if _, err := r.Read(); err != io.EOF {
+		return fmt.Sprintf("%s holds more than one record", line)
+	}
+	for i, c := range csvColumns {
+		if got, want := unescapeNginx(record[i]), c.value(e); got != want {
+			return fmt.Sprintf("%s parses as %q, want %q, in %s", c.name, got, want, line)
+		}
+	}
+	return ""
+}
+
+// fuzzAlphabet holds what breaks naive formatters: quotes, escapes,
+// separators of every format, markup, control and multi-byte characters.
+var fuzzAlphabet = []string{
+	`"`, `\`, `\x22`, " ", ",", "=", "[", "]", "-", "<", ">", "&", "'", "\n", "\r", "\t", "\x00", "\x1b",
+	"é", "日本", "\U0001F600", "%", "%22", "{", "}", "$", "a", "Z", "0",
+}
+
+// fuzzEntry returns a copy of e whose free-text fields hold random strings
+// over fuzzAlphabet. The URI keeps to what a request line can carry.
+func fuzzEntry(rnd *rand.Rand, e logEntry) logEntry {
+	text := func(inURI bool) string {
+		var b strings.Builder
+		for range rnd.Intn(12) {
+			s := fuzzAlphabet[rnd.Intn(len(fuzzAlphabet))]
+			if inURI && strings.ContainsAny(s, " \r\n\t\x00") {
+				continue
+			}
+			b.WriteString(s)
+		}
+		return b.String()
+	}
+	e.HTTP.UserAgent = text(false)
+	e.Nginx.HTTPReferrer = text(false)
+	e.HTTP.URI = "/" + text(true) + "?q=" + text(true)
+	if e.Nginx.RemoteUser != "" {
+		// Unquoted in combined, like $remote_addr, so only escaping applies
+		e.Nginx.RemoteUser = strings.Map(func(r rune) rune {
+			if r == ' ' {
+				return -1
+			}
+			return r
+		}, text(false))
+	}
+	return e
+}
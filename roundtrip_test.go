@@ -0,0 +1,84 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// requestLineText drops what cannot appear in a request line.
+func requestLineText(s string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(" \r\n\t\x00", r) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// FuzzFormatRoundTrips renders an entry with fuzzed free-text fields in
+// every built-in output format and parses it back with the reference
+// parsers: nginx combined regex, logfmt, CSV, line protocol, JSON and XML.
+func FuzzFormatRoundTrips(f *testing.F) {
+	cfg := testConfig(f, map[string]string{"REMOTE_USERS": "alice", "HEADER_FIELDS": "true"})
+	entries, _, err := sample(cfg, 1)
+	if err != nil {
+		f.Fatal(err)
+	}
+	trips, err := formatRoundTrips(cfg)
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add("Mozilla/5.0 (X11; Linux x86_64)", "https://example.com/", "api/users", "id=42", "alice")
+	f.Add(`"quoted" \x22 \`, "a=b c,d", "caf%C3%A9", "q=%22", "bob")
+	f.Add("\n\r\t\x00\x1b", "<a href='x'>&amp;</a>", "日本", "x=\U0001F600", "é")
+	f.Add("", "-", "", "", "")
+	f.Fuzz(func(t *testing.T, userAgent, referrer, path, query, user string) {
+		// JSON and XML replace invalid UTF-8, so only valid text can
+		// come back unchanged
+		for _, s := range []string{userAgent, referrer, path, query, user} {
+			if !utf8.ValidString(s) {
+				t.Skip()
+			}
+		}
+		e := entries[0]
+		e.HTTP.UserAgent, e.Nginx.HTTPReferrer = userAgent, referrer
+		e.HTTP.URI = "/" + requestLineText(path) + "?" + requestLineText(query)
+		// Unquoted in combined, like $remote_addr
+		e.Nginx.RemoteUser = strings.ReplaceAll(user, " ", "")
+		for _, trip := range trips {
+			if why := trip.check(&e); why != "" {
+				t.Errorf("%s: %s", trip.name, why)
+			}
+		}
+	})
+}
+
+// FuzzLogFormat renders fuzzed fields through LOG_FORMAT, whose escaping
+// must keep every line printable ASCII.
+func FuzzLogFormat(f *testing.F) {
+	cfg := testConfig(f, map[string]string{
+		"LOG_FORMAT": `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent" $request_time`,
+	})
+	entries, _, err := sample(cfg, 1)
+	if err != nil {
+		f.Fatal(err)
+	}
+	format, err := newFormatter(cfg)
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add("Mozilla/5.0", "https://example.com/", "/a", "alice")
+	f.Add("\xff\xfe", "\"\\\n", "/日本", "\x00")
+	f.Fuzz(func(t *testing.T, userAgent, referrer, uri, user string) {
+		e := entries[0]
+		e.HTTP.UserAgent, e.Nginx.HTTPReferrer, e.HTTP.URI, e.Nginx.RemoteUser = userAgent, referrer, uri, user
+		line, err := format(&e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if why := checkEscapedLine(&e, line); why != "" {
+			t.Error(why)
+		}
+	})
+}
@@ -0,0 +1,592 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// runner drives generation: it asks the generator for entries at the right
+// times, renders them and hands the lines to the sinks.
+type runner struct {
+	name       string
+	cfg        config
+	gen        *generator
+	clk        *clock
+	format     formatter
+	accessSink sink
+	errorSink  sink
+	// heartbeatSink receives HEARTBEAT_INTERVAL records, nil without them
+	heartbeatSink sink
+	// sentrySink receives error events for 5xx entries, nil without
+	// SENTRY_DSN
+	sentrySink sink
+	// lifecycle announces the start and end of the run, nil without
+	// RUN_WEBHOOK_URL
+	lifecycle *runNotifier
+
+	// entries counts generated access entries, for the admin server
+	entries atomic.Uint64
+	bytes   atomic.Uint64
+	ctl     control
+	volume  *volumeTarget
+	ramp    *ramp
+	// arrivals draws the gaps between entries with ARRIVAL=poisson, nil
+	// for evenly spaced ones
+	arrivalSrc randSource
+	arrivals   *rand.Rand
+	sizer      *lineSizer
+	stats      *runStats
+	// pool renders entries with WORKERS > 1, nil otherwise
+	pool *workerPool
+	// prober generates PROBE_INTERVAL probes on a stream of its own, so
+	// that they leave the seeded entries unchanged
+	prober *generator
+
+	// started is when generation began and scheduled the number of access
+	// entries generated or handed to the pool since, for COUNT and DURATION;
+	// limited is set once either stopped the run
+	started   time.Time
+	scheduled int
+	limited   bool
+	// records is the record ID of the last entry handed out for rendering
+	records uint64
+}
+
+func newRunner(cfg config) (*runner, error) {
+	switch cfg.StackTraceStyle {
+	case "go", "nginx", "mixed":
+	default:
+		return nil, errors.New("STACKTRACE_STYLE must be one of: go, nginx, mixed")
+	}
+
+	if cfg.Count < 0 || cfg.Duration < 0 {
+		return nil, errors.New("COUNT and DURATION must not be negative")
+	}
+
+	if cfg.CheckpointFile != "" && cfg.CheckpointEvery < 1 {
+		return nil, errors.New("CHECKPOINT_EVERY must be at least 1")
+	}
+
+	r := &runner{cfg: cfg}
+	r.ctl.changed = make(chan struct{}, 1)
+	r.stats = newRunStats("")
+	var err error
+	if cfg.LineSizeMean > 0 {
+		if r.sizer, err = newLineSizer(cfg.LineSizeMean, cfg.LineSizeP99); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.TargetVolume != "" {
+		if r.volume, err = parseVolume(cfg.TargetVolume); err != nil {
+			return nil, err
+		}
+	}
+	switch cfg.Arrival {
+	case "uniform":
+	case "poisson":
+		// A stream of its own keeps the entries the same as with uniform
+		// arrivals
+		arrivalCfg := cfg
+		arrivalCfg.RNGStream = strings.TrimPrefix(cfg.RNGStream+"/arrival", "/")
+		if r.arrivalSrc, err = streamSource(arrivalCfg); err != nil {
+			return nil, err
+		}
+		r.arrivals = rand.New(r.arrivalSrc)
+	default:
+		return nil, fmt.Errorf("unknown ARRIVAL %q (want uniform or poisson)", cfg.Arrival)
+	}
+	if cfg.RampDuration > 0 {
+		if r.ramp, err = newRamp(cfg); err != nil {
+			return nil, err
+		}
+	}
+	if r.gen, err = newGenerator(cfg); err != nil {
+		return nil, err
+	}
+	if r.clk, err = newClock(cfg); err != nil {
+		return nil, err
+	}
+	if r.format, err = newFormatter(cfg); err != nil {
+		return nil, err
+	}
+	if cfg.CompareSinks != "" {
+		// Each compared sink runs its own COMPARE_<NAME>_PIPELINE
+		r.accessSink, err = newCompareSink(cfg, r.format)
+	} else {
+		r.accessSink, err = newSink(cfg.Sink, cfg.Sinks)
+		if err == nil && cfg.Pipeline != "" {
+			r.accessSink, err = newPipelineSink(r.accessSink, cfg.Pipeline, cfg.environ, r.format)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if r.errorSink, err = newSink(cfg.ErrorLogSink, cfg.Sinks); err != nil {
+		return nil, err
+	}
+	if cfg.ErrorLogPipeline != "" {
+		if r.errorSink, err = newPipelineSink(r.errorSink, cfg.ErrorLogPipeline, cfg.environ, r.format); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.HeartbeatInterval > 0 {
+		if r.heartbeatSink, err = newSink(cfg.HeartbeatSink, cfg.Sinks); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.SentryDSN != "" {
+		if r.sentrySink, err = newSentrySink(cfg.SentryDSN, cfg.Sinks); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.RunWebhookURL != "" {
+		if r.lifecycle, err = newRunNotifier(cfg); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Workers > 1 {
+		if cfg.CheckpointFile != "" {
+			return nil, errors.New("CHECKPOINT_FILE cannot be used with WORKERS")
+		}
+		if r.pool, err = newWorkerPool(r, cfg.Workers); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.ProbeInterval > 0 {
+		if r.prober, err = r.sideGenerator("probe"); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// sideGenerator returns a generator on stream "<RNG_STREAM>/<name>" that
+// records scenario events through r.gen, which owns the ground truth and
+// the incident webhook.
+func (r *runner) sideGenerator(name string) (*generator, error) {
+	cfg := r.cfg
+	cfg.RNGStream = strings.TrimPrefix(cfg.RNGStream+"/"+name, "/")
+	cfg.GroundTruthFile, cfg.IncidentWebhookURL, cfg.PagerDutyRoutingKey = "", "", ""
+	g, err := newGenerator(cfg)
+	if err != nil {
+		return nil, err
+	}
+	g.events = r.gen.events
+	return g, nil
+}
+
+// interval returns the pause before the entry following one generated at t.
+// Scenarios such as retry bursts and console spikes change the rate over
+// time.
+func (r *runner) interval(t time.Time) time.Duration {
+	return time.Duration(float64(time.Second) / r.rate(t))
+}
+
+// gap returns the time from an entry at t to the next one: the interval, or
+// with Poisson arrivals an exponentially distributed gap averaging it.
+func (r *runner) gap(t time.Time) time.Duration {
+	return time.Duration(float64(time.Second) * r.arrivalCost() / r.rate(t))
+}
+
+// arrivalCost returns the share of the mean interval until the next entry.
+func (r *runner) arrivalCost() float64 {
+	if r.arrivals == nil {
+		return 1
+	}
+	return r.arrivals.ExpFloat64()
+}
+
+// rate returns the entries per second due at t.
+func (r *runner) rate(t time.Time) float64 {
+	return r.baseRate(t) * r.gen.rateFactor(t) * r.ctl.rateFactor()
+}
+
+// backfillOrLive backfills BACKFILL_FROM..BACKFILL_TO when it is set and
+// generates in real time otherwise, announcing the run to RUN_WEBHOOK_URL.
+func (r *runner) backfillOrLive() error {
+	r.started = time.Now()
+	r.lifecycle.notifyStart(r)
+	var err error
+	if r.cfg.BackfillFrom != "" {
+		err = r.backfill()
+	} else {
+		err = r.live()
+	}
+	r.lifecycle.notifyFinish(r, err)
+	return err
+}
+
+// remaining returns how many of n entries COUNT still allows.
+func (r *runner) remaining(n int) int {
+	if r.cfg.Count == 0 {
+		return n
+	}
+	return max(min(n, r.cfg.Count-r.scheduled), 0)
+}
+
+// limitReached reports whether COUNT entries have been generated or the run
+// has lasted DURATION, and marks the run as limited if so.
+func (r *runner) limitReached() bool {
+	if (r.cfg.Count > 0 && r.scheduled >= r.cfg.Count) ||
+		(r.cfg.Duration > 0 && time.Since(r.started) >= r.cfg.Duration) {
+		r.limited = true
+	}
+	return r.limited
+}
+
+// live generates entries in real time until interrupted or stopped by COUNT
+// or DURATION.
+func (r *runner) live() error {
+	if r.ramp != nil {
+		r.ramp.begin(r.clk.now())
+	}
+	pace := newPacer(time.Now(), r.arrivalCost)
+	timer := time.NewTimer(pace.wait(r.rate(r.clk.now()) * r.clk.scale))
+	defer timer.Stop()
+
+	// Batching sinks keep records in memory, so flush them on shutdown
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+	var probes <-chan time.Time
+	if r.cfg.ProbeInterval > 0 {
+		probeTicker := time.NewTicker(r.cfg.ProbeInterval)
+		defer probeTicker.Stop()
+		probes = probeTicker.C
+	}
+	var probeSeq uint64
+
+	var heartbeats <-chan time.Time
+	if r.cfg.HeartbeatInterval > 0 {
+		heartbeatTicker := time.NewTicker(r.cfg.HeartbeatInterval)
+		defer heartbeatTicker.Stop()
+		heartbeats = heartbeatTicker.C
+	}
+	var heartbeatSeq uint64
+
+	var results <-chan workerResult
+	if r.pool != nil {
+		results = r.pool.results
+	}
+
+	var deadline <-chan time.Time
+	if r.cfg.Duration > 0 {
+		deadlineTimer := time.NewTimer(r.cfg.Duration - time.Since(r.started))
+		defer deadlineTimer.Stop()
+		deadline = deadlineTimer.C
+	}
+
+	for {
+		select {
+		case <-stop:
+			return r.close()
+		case <-deadline:
+			r.limited = true
+			return r.close()
+		case <-timer.C:
+		case <-probes:
+			probeSeq++
+			if err := r.emitProbe(probeSeq); err != nil {
+				return err
+			}
+			continue
+		case res := <-results:
+			if err := r.pool.collect(res); err != nil {
+				return err
+			}
+			continue
+		case <-heartbeats:
+			heartbeatSeq++
+			if err := r.emitHeartbeat(heartbeatSeq); err != nil {
+				return err
+			}
+			continue
+		case <-r.ctl.changed:
+			timer.Reset(pace.wait(r.rate(r.clk.now()) * r.clk.scale))
+			continue
+		}
+
+		// The pacer runs on the wall clock, through which simulated time
+		// passes TIME_SCALE times as fast
+		rate := r.rate(r.clk.now()) * r.clk.scale
+		n := r.remaining(pace.take(time.Now(), rate))
+		if r.pool != nil && n > 0 {
+			if err := r.spread(r.clk.now(), n); err != nil {
+				return err
+			}
+			n = 0
+		}
+		for ; n > 0; n-- {
+			if err := r.emit(r.clk.now()); err != nil {
+				return err
+			}
+		}
+		if r.limitReached() {
+			return r.close()
+		}
+		timer.Reset(pace.wait(rate))
+	}
+}
+
+// backfill generates the BACKFILL_FROM..BACKFILL_TO range without waiting,
+// spacing entries as live mode would, then flushes the sinks.
+func (r *runner) backfill() error {
+	from, err := parseTime(r.cfg.BackfillFrom, r.clk.loc)
+	if err != nil {
+		return fmt.Errorf("parsing BACKFILL_FROM: %w", err)
+	}
+	if r.ramp != nil {
+		// A resumed backfill keeps ramping from the original start
+		r.ramp.begin(from)
+	}
+	to := r.clk.now()
+	if r.cfg.BackfillTo != "" {
+		if to, err = parseTime(r.cfg.BackfillTo, r.clk.loc); err != nil {
+			return fmt.Errorf("parsing BACKFILL_TO: %w", err)
+		}
+	}
+	if !from.Before(to) {
+		return errors.New("BACKFILL_FROM must be before BACKFILL_TO")
+	}
+
+	if r.cfg.CheckpointFile != "" {
+		ck, err := loadCheckpoint(r.cfg.CheckpointFile)
+		if err != nil {
+			return err
+		}
+		if ck != nil {
+			if from, to, err = r.resume(ck); err != nil {
+				return err
+			}
+		}
+	}
+
+	if r.pool != nil {
+		return r.backfillParallel(from, to)
+	}
+	for t := from; t.Before(to); t = t.Add(r.gap(t)) {
+		if r.limitReached() {
+			return r.stopBackfill(to, t)
+		}
+		if r.cfg.CheckpointFile != "" && r.entries.Load() > 0 && r.entries.Load()%uint64(r.cfg.CheckpointEvery) == 0 {
+			if err := r.saveCheckpoint(to, t); err != nil {
+				return fmt.Errorf("saving checkpoint: %w", err)
+			}
+		}
+		if err := r.emit(t); err != nil {
+			return err
+		}
+	}
+	if err := r.close(); err != nil {
+		return err
+	}
+	if r.cfg.CheckpointFile != "" {
+		// The backfill is complete; a new run starts from scratch
+		if err := os.Remove(r.cfg.CheckpointFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// stopBackfill ends a backfill stopped by COUNT or DURATION before next,
+// saving a checkpoint so that the next run resumes there.
+func (r *runner) stopBackfill(to, next time.Time) error {
+	if r.cfg.CheckpointFile != "" {
+		if err := r.saveCheckpoint(to, next); err != nil {
+			return fmt.Errorf("saving checkpoint: %w", err)
+		}
+	}
+	return r.close()
+}
+
+// emit generates the entry for timeLocal and sends it, with the lines that
+// accompany it, to the sinks.
+func (r *runner) emit(timeLocal time.Time) error {
+	r.scheduled++
+	r.records++
+	out, err := r.render(r.gen, r.format, timeLocal, r.records)
+	if err != nil {
+		return err
+	}
+	return r.deliver(out)
+}
+
+// rendered is an access entry with the lines that accompany it, ready for
+// the sinks.
+type rendered struct {
+	entry  logEntry
+	warmup bool
+	// access holds the entry's own line first, then controller events and
+	// stack traces
+	access []record
+	errors []record
+}
+
+// render generates the entry for timeLocal with g, numbered recordID, and
+// renders its lines with format. Formatters may keep state, so each worker passes a generator
+// and a formatter of its own; the rest of r is only read, or locked as the
+// control state is, and workers render in parallel.
+func (r *runner) render(g *generator, format formatter, timeLocal time.Time, recordID uint64) (*rendered, error) {
+	cfg := r.cfg
+	out := &rendered{entry: g.next(timeLocal)}
+	out.entry.RecordID = recordID
+	out.warmup = timeLocal.Sub(g.start) < cfg.WarmupDuration
+	logEntry := &out.entry
+	if code := r.ctl.injectedStatus(g.rng); code != 0 {
+		g.forceStatus(logEntry, code)
+	}
+
+	if cfg.EmitTimestamp {
+		emitted := time.Now().Add(cfg.EmitSkew).In(r.clk.loc)
+		logEntry.EmitTimestamp = &emitted
+	}
+	var line []byte
+	var err error
+	if r.sizer != nil {
+		line, err = r.sizer.fit(g.rng, logEntry, format)
+	} else {
+		line, err = format(logEntry)
+	}
+	if err != nil {
+		return nil, err
+	}
+	out.access = append(out.access, record{Time: timeLocal, Entry: logEntry, Line: line})
+
+	// Occasionally mix in controller reload events, as real ingress-nginx stdout does
+	if g.rng.Float64()*100 < cfg.ControllerEventPercent {
+		for _, line := range controllerReloadEvent(g.rng, timeLocal, cfg.ControllerReloadFailurePercent) {
+			out.access = append(out.access, record{Time: timeLocal, Line: []byte(line)})
+		}
+	}
+
+	if g.rng.Float64()*100 < cfg.StackTracePercent {
+		out.access = append(out.access, record{Time: timeLocal, Line: []byte(stackTrace(g.rng, timeLocal, cfg.StackTraceStyle))})
+	}
+
+	// A fractional ratio such as 0.05 yields one error line per 20 access lines on average
+	errorLines := int(cfg.ErrorLogRatio)
+	if g.rng.Float64() < cfg.ErrorLogRatio-float64(errorLines) {
+		errorLines++
+	}
+	for i := 0; i < errorLines; i++ {
+		out.errors = append(out.errors, record{Time: timeLocal, Line: []byte(errorLogLine(g.rng, timeLocal, logEntry))})
+	}
+	return out, nil
+}
+
+// deliver sends the lines of out to the sinks and accounts for them.
+func (r *runner) deliver(out *rendered) error {
+	start := r.bytes.Load()
+	defer func() {
+		written := r.bytes.Load() - start
+		if r.volume != nil {
+			r.volume.observe(written)
+		}
+		r.stats.observe(&out.entry, written, out.warmup)
+	}()
+	for i, rec := range out.access {
+		if err := r.send(r.accessSink, rec); err != nil {
+			return err
+		}
+		if i == 0 {
+			r.entries.Add(1)
+		}
+	}
+	for _, rec := range out.errors {
+		if err := r.send(r.errorSink, rec); err != nil {
+			return err
+		}
+	}
+	if r.sentrySink != nil {
+		return r.reportError(&out.entry)
+	}
+	return nil
+}
+
+// backfillParallel backfills from..to with the worker pool, in chunks of
+// workerChunk entries.
+func (r *runner) backfillParallel(from, to time.Time) error {
+	r.gen.start = from
+	var times []time.Time
+	for t := from; t.Before(to) && !r.limitReached(); t = t.Add(r.gap(t)) {
+		r.scheduled++
+		if times = append(times, t); len(times) == workerChunk {
+			if err := r.pool.dispatch(times); err != nil {
+				return err
+			}
+			times = nil
+		}
+	}
+	if len(times) > 0 {
+		if err := r.pool.dispatch(times); err != nil {
+			return err
+		}
+	}
+	return r.close()
+}
+
+// spread hands n entries at t to the worker pool.
+func (r *runner) spread(t time.Time, n int) error {
+	// r.gen paces the workers, so its scenarios start with the first entry
+	if r.gen.start.IsZero() {
+		r.gen.start = t
+	}
+	r.scheduled += n
+	return r.pool.spread(t, n)
+}
+
+// send hands rec to s, counting the bytes written.
+func (r *runner) send(s sink, rec record) error {
+	r.bytes.Add(uint64(len(rec.Line)) + 1)
+	return s.Send(rec)
+}
+
+// close flushes and closes all sinks, then writes the run summary: to
+// SUMMARY_FILE, or to stderr for a run stopped by COUNT or DURATION.
+func (r *runner) close() error {
+	var errs []error
+	if r.pool != nil {
+		errs = append(errs, r.pool.wait())
+		r.pool.stop()
+	}
+	for _, s := range []sink{r.accessSink, r.errorSink, r.heartbeatSink, r.sentrySink} {
+		if s == nil {
+			continue
+		}
+		if err := s.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	summary := r.cfg.SummaryFile
+	if summary == "" && r.limited {
+		summary = "-"
+	}
+	if summary != "" {
+		if err := r.stats.write(summary); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// parseTime reads a timestamp in RFC 3339 form, or without an offset (and
+// optionally without a time of day) in the given location.
+func parseTime(s string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.In(loc), nil
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("cannot parse %q as a time", s)
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// failover takes a region's pods out of rotation FAILOVER_AFTER into the
+// run. Because the overall rate is unchanged, the surviving regions' rates
+// grow in proportion to their share of pods.
+type failover struct {
+	region    string
+	after     time.Duration
+	survivors []*pod
+}
+
+func newFailover(cfg config, pods []*pod) (*failover, error) {
+	if cfg.FailoverRegion == "" {
+		return nil, nil
+	}
+	f := &failover{region: cfg.FailoverRegion, after: cfg.FailoverAfter}
+	found := false
+	for _, p := range pods {
+		if p.region.name == f.region {
+			found = true
+		} else {
+			f.survivors = append(f.survivors, p)
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("FAILOVER_REGION %q is not listed in REGIONS", f.region)
+	}
+	if len(f.survivors) == 0 {
+		return nil, fmt.Errorf("FAILOVER_REGION %q is the only region, nothing could take over its traffic", f.region)
+	}
+	return f, nil
+}
+
+// active reports whether the region has failed at the given point of the run.
+func (f *failover) active(elapsed time.Duration) bool {
+	return f != nil && elapsed >= f.after
+}
+
+// upstreamName returns the ingress-nginx upstream name for a host, following
+// the namespace-service-port convention, e.g. "default-api-80".
+func upstreamName(host, variant string) string {
+	service, _, _ := strings.Cut(strings.TrimSuffix(strings.ToLower(host), "."), ".")
+	if variant != "" {
+		service += "-" + variant
+	}
+	return "default-" + service + "-80"
+}
+
+// applyCanary routes a share of requests to a canary upstream whose error
+// rate and latency differ from the primary one. The canary upstream shows
+// up in proxy_alternative_upstream_name, as with ingress-nginx canary
+// annotations.
+func (g *generator) applyCanary(e *logEntry) {
+	e.Nginx.ProxyUpstreamName = upstreamName(e.HTTP.Host, "")
+	if g.rng.Float64()*100 >= g.cfg.CanaryPercent {
+		return
+	}
+	e.Nginx.ProxyAlternativeUpstreamName = upstreamName(e.HTTP.Host, "canary")
+	e.HTTP.RequestTime *= float32(g.cfg.CanaryLatencyFactor)
+	if g.rng.Float64()*100 < g.cfg.CanaryErrorPercent {
+		g.forceStatus(e, []int{500, 502, 503}[g.rng.Intn(3)])
+	}
+}
+
+// blueGreenUpstream returns the upstream serving traffic at the given point
+// of the run: "blue" before BLUEGREEN_AT and "green" from then on. The
+// switch is instantaneous for all traffic.
+func (g *generator) blueGreenUpstream(elapsed time.Duration) string {
+	if elapsed < g.cfg.BlueGreenAt {
+		return "blue"
+	}
+	return "green"
+}
+
+// maintenance describes a window during which selected hosts answer every
+// request with a tiny static 503 page, followed by a burst of client
+// retries once the hosts are back.
+type maintenance struct {
+	hosts       map[string]bool
+	hostList    []string
+	start, end  time.Duration
+	retryEnd    time.Duration
+	retryFactor float64
+}
+
+func newMaintenance(cfg config) *maintenance {
+	hosts := parseEnvList(cfg.MaintenanceHosts)
+	if len(hosts) == 0 {
+		return nil
+	}
+	m := &maintenance{
+		hosts:       map[string]bool{},
+		hostList:    hosts,
+		start:       cfg.MaintenanceStart,
+		end:         cfg.MaintenanceStart + cfg.MaintenanceDuration,
+		retryEnd:    cfg.MaintenanceStart + cfg.MaintenanceDuration + cfg.MaintenanceRetryDuration,
+		retryFactor: cfg.MaintenanceRetryFactor,
+	}
+	for _, h := range hosts {
+		m.hosts[h] = true
+	}
+	return m
+}
+
+func (m *maintenance) inWindow(elapsed time.Duration) bool {
+	return m != nil && elapsed >= m.start && elapsed < m.end
+}
+
+func (m *maintenance) retrying(elapsed time.Duration) bool {
+	return m != nil && m.retryFactor > 1 && elapsed >= m.end && elapsed < m.retryEnd
+}
+
+// applyMaintenance turns requests to hosts under maintenance into 503
+// responses; retryHost steers the retry burst that follows to those hosts.
+func (g *generator) applyMaintenance(e *logEntry, elapsed time.Duration) {
+	m := g.maintenance
+	switch {
+	case m.inWindow(elapsed):
+		g.markOnce(m.start, "maintenance_start", map[string]interface{}{"hosts": m.hostList})
+		if m.hosts[e.HTTP.Host] {
+			g.forceStatus(e, 503)
+			e.HTTP.RequestTime = float32(g.rng.Intn(3)) / 1000
+		}
+	case elapsed >= m.end:
+		g.markOnce(m.end, "maintenance_end", map[string]interface{}{"hosts": m.hostList})
+	}
+}
+
+// retryHost steers the retry surplus after a maintenance window to the
+// hosts that were down, and returns host for other requests. It runs before
+// the URL, referrer and upstream are derived from the host.
+func (g *generator) retryHost(host string, elapsed time.Duration) string {
+	m := g.maintenance
+	// With the rate multiplied by retryFactor, this share of requests is
+	// the retry surplus
+	if m.retrying(elapsed) && g.rng.Float64() < 1-1/m.retryFactor {
+		return m.hostList[g.rng.Intn(len(m.hostList))]
+	}
+	return host
+}
+
+// rateFactor returns the multiplier HOURLY_RATE_FACTORS, DIURNAL, SPIKES
+// and scenarios apply to the configured rate at the given time.
+func (g *generator) rateFactor(now time.Time) float64 {
+	factor := 1.0
+	if g.hourlyRate != nil && !now.IsZero() {
+		hour := now.Hour()
+		if len(g.hourlyRate) == 168 {
+			// Weekly tables start on Monday
+			hour += (int(now.Weekday()) + 6) % 7 * 24
+		}
+		factor *= g.hourlyRate[hour]
+	}
+	if g.diurnal != nil && !now.IsZero() {
+		factor *= g.diurnal.factor(now)
+	}
+	for _, s := range g.spikes {
+		if !now.IsZero() && s.covers(now) {
+			factor *= s.factor
+		}
+	}
+	if g.start.IsZero() {
+		return factor
+	}
+	if g.maintenance.retrying(now.Sub(g.start)) {
+		factor *= g.maintenance.retryFactor
+	}
+	factor *= g.ddos.rateFactor(now.Sub(g.start))
+	return factor
+}
+
+// diurnalCurve is a cosine-shaped day: the rate multiplier is peak at
+// peakHour and falls smoothly to trough twelve hours later.
+type diurnalCurve struct {
+	peakHour     float64
+	peak, trough float64
+}
+
+func newDiurnalCurve(cfg config) (*diurnalCurve, error) {
+	switch {
+	case cfg.HourlyRateFactors != "":
+		return nil, fmt.Errorf("DIURNAL cannot be combined with HOURLY_RATE_FACTORS")
+	case cfg.DiurnalPeakHour < 0 || cfg.DiurnalPeakHour >= 24:
+		return nil, fmt.Errorf("DIURNAL_PEAK_HOUR must be in [0, 24), got %g", cfg.DiurnalPeakHour)
+	case cfg.DiurnalTroughFactor <= 0 || cfg.DiurnalPeakFactor < cfg.DiurnalTroughFactor:
+		return nil, fmt.Errorf("DIURNAL_PEAK_FACTOR and DIURNAL_TROUGH_FACTOR must be positive, the peak no lower than the trough")
+	}
+	return &diurnalCurve{cfg.DiurnalPeakHour, cfg.DiurnalPeakFactor, cfg.DiurnalTroughFactor}, nil
+}
+
+// factor returns the multiplier at t, in t's location.
+func (c *diurnalCurve) factor(t time.Time) float64 {
+	hour := float64(t.Hour()) + float64(t.Minute())/60 + float64(t.Second())/3600
+	phase := (1 + math.Cos(2*math.Pi*(hour-c.peakHour)/24)) / 2
+	return c.trough + (c.peak-c.trough)*phase
+}
+
+// spike multiplies the rate by factor for duration from a time of day,
+// every day.
+type spike struct {
+	spec     string
+	at       time.Duration
+	duration time.Duration
+	factor   float64
+	// active tracks the spike for its ground truth marks
+	active bool
+}
+
+// parseSpikes parses SPIKES entries of the form "HH:MM+duration@factor",
+// such as "10:00+5m@10x".
+func parseSpikes(spec string) ([]*spike, error) {
+	var spikes []*spike
+	for _, part := range parseEnvList(spec) {
+		part = strings.TrimSpace(part)
+		at, rest, ok1 := strings.Cut(part, "+")
+		duration, factor, ok2 := strings.Cut(rest, "@")
+		clock, err1 := time.Parse("15:04", at)
+		d, err2 := time.ParseDuration(duration)
+		f, err3 := strconv.ParseFloat(strings.TrimSuffix(factor, "x"), 64)
+		if !ok1 || !ok2 || err1 != nil || err2 != nil || err3 != nil || d <= 0 || d > 24*time.Hour || f <= 0 {
+			return nil, fmt.Errorf("invalid SPIKES entry %q (want e.g. 10:00+5m@10x)", part)
+		}
+		offset := time.Duration(clock.Hour())*time.Hour + time.Duration(clock.Minute())*time.Minute
+		spikes = append(spikes, &spike{spec: part, at: offset, duration: d, factor: f})
+	}
+	return spikes, nil
+}
+
+// covers reports whether t, in its own location, falls within the spike.
+// Spikes may run past midnight.
+func (s *spike) covers(t time.Time) bool {
+	return t.Sub(s.began(t)) < s.duration
+}
+
+// began returns the latest start of the spike at or before t.
+func (s *spike) began(t time.Time) time.Time {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	since := (t.Sub(midnight) - s.at + 24*time.Hour) % (24 * time.Hour)
+	return t.Add(-since)
+}
+
+// markSpikes records the start and end of each spike in the ground truth,
+// at the scheduled time, or the start of the run for a spike under way.
+func (g *generator) markSpikes(t time.Time) {
+	for _, s := range g.spikes {
+		if active := s.covers(t); active != s.active {
+			s.active = active
+			event, at := "spike_end", s.began(t).Add(s.duration)
+			if active {
+				event, at = "spike_start", s.began(t)
+			}
+			if at.Before(g.start) {
+				at = g.start
+			}
+			key := event + " " + s.spec + " " + at.Format(time.RFC3339Nano)
+			g.events.markOnce(key, at, event, map[string]interface{}{"spike": s.spec, "factor": s.factor})
+		}
+	}
+}
+
+// parseHourlyRate parses the comma-separated factors of HOURLY_RATE_FACTORS:
+// 24 for every day, one per hour from midnight, or 168 for a whole week from
+// Monday midnight.
+func parseHourlyRate(spec string) ([]float64, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	parts := parseEnvList(spec)
+	if len(parts) != 24 && len(parts) != 168 {
+		return nil, fmt.Errorf("HOURLY_RATE_FACTORS needs 24 or 168 values, got %d", len(parts))
+	}
+	factors := make([]float64, len(parts))
+	for h, part := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || f <= 0 {
+			return nil, fmt.Errorf("invalid HOURLY_RATE_FACTORS value %q for hour %d (want a positive number)", part, h)
+		}
+		factors[h] = f
+	}
+	return factors, nil
+}
+
+// forceStatus turns e into a response with the given status code, as if
+// nginx or the upstream had answered with it, keeping the dependent fields
+// consistent.
+func (g *generator) forceStatus(e *logEntry, code int) {
+	e.HTTP.StatusCode = code
+	e.HTTP.BytesSent = strconv.Itoa(g.bytesSent(code, e.HTTP.URI))
+	if code >= 300 {
+		e.HTTP.ContentType = "text/html"
+	}
+	if g.cfg.HeaderFields {
+		e.HTTP.ContentEncoding = contentEncoding(g.rng, e.HTTP.AcceptEncoding, e.HTTP.URI, code)
+		e.HTTP.TransferEncoding, e.HTTP.ContentLength = g.framing(e)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sentryEvent is the part of a Sentry error event the generator fills in.
+type sentryEvent struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   time.Time         `json:"timestamp"`
+	Platform    string            `json:"platform"`
+	Level       string            `json:"level"`
+	Logger      string            `json:"logger"`
+	Transaction string            `json:"transaction"`
+	ServerName  string            `json:"server_name,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+	Message     string            `json:"message"`
+	Tags        map[string]string `json:"tags"`
+	Request     sentryRequest     `json:"request"`
+}
+
+type sentryRequest struct {
+	URL     string            `json:"url"`
+	Method  string            `json:"method"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// reportError sends a Sentry event for the SENTRY_SAMPLE_PERCENT of 5xx
+// entries, tagged with the entry's request ID so that the error and its log
+// line can be joined. Entries are chosen by their request ID, keeping seeded
+// output unchanged.
+func (r *runner) reportError(e *logEntry) error {
+	if e.HTTP.StatusCode < 500 || float64(entryHash(e, "sentry")%10000) >= r.cfg.SentrySamplePercent*100 {
+		return nil
+	}
+	event := sentryEvent{
+		EventID:     strings.ReplaceAll(e.HTTP.RequestID, "-", ""),
+		Timestamp:   e.Timestamp.UTC(),
+		Platform:    "other",
+		Level:       "error",
+		Logger:      "nginx",
+		Transaction: e.HTTP.Method + " " + e.HTTP.URI,
+		Environment: r.cfg.SentryEnvironment,
+		Message:     fmt.Sprintf("%s %s returned %d %s", e.HTTP.Method, e.HTTP.URI, e.HTTP.StatusCode, http.StatusText(e.HTTP.StatusCode)),
+		Tags: map[string]string{
+			"request_id":  e.HTTP.RequestID,
+			"status_code": strconv.Itoa(e.HTTP.StatusCode),
+			"host":        e.HTTP.Host,
+			"method":      e.HTTP.Method,
+		},
+		Request: sentryRequest{
+			URL:     "https://" + e.HTTP.Host + e.HTTP.URI,
+			Method:  e.HTTP.Method,
+			Headers: map[string]string{"User-Agent": e.HTTP.UserAgent},
+		},
+	}
+	if e.Kubernetes != nil {
+		event.ServerName = e.Kubernetes.PodName
+		event.Tags["region"] = e.Kubernetes.Region
+	}
+	if e.Nginx.ProxyUpstreamName != "" {
+		event.Tags["upstream"] = e.Nginx.ProxyUpstreamName
+	}
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return r.sentrySink.Send(record{Time: e.Timestamp, Line: line})
+}
+
+// sentrySink sends the events of its records to the envelope endpoint of the
+// Sentry project of a DSN such as "https://key@o1.ingest.sentry.io/42".
+type sentrySink struct {
+	*batcher
+	client *http.Client
+	url    string
+	auth   string
+}
+
+func newSentrySink(dsn string, cfg sinkConfig) (*sentrySink, error) {
+	u, err := url.Parse(dsn)
+	if err != nil || u.User == nil || u.User.Username() == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid SENTRY_DSN %q (want https://key@host/project)", dsn)
+	}
+	// The project ID is the last path segment, after an optional prefix
+	path := strings.Trim(u.Path, "/")
+	i := strings.LastIndex(path, "/")
+	prefix, project := "", path[i+1:]
+	if i >= 0 {
+		prefix = "/" + path[:i]
+	}
+	if _, err := strconv.Atoi(project); err != nil {
+		return nil, fmt.Errorf("invalid SENTRY_DSN %q: no project ID", dsn)
+	}
+	client, err := newHTTPClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	s := &sentrySink{
+		client: client,
+		url:    fmt.Sprintf("%s://%s%s/api/%s/envelope/", u.Scheme, u.Host, prefix, project),
+		auth:   "Sentry sentry_version=7, sentry_client=nginx-log-generator/1.0, sentry_key=" + u.User.Username(),
+	}
+	s.batcher = newBatcher(cfg.BatchSize, cfg.BatchInterval, s.post)
+	return s, nil
+}
+
+// post sends each event in an envelope of its own, as Sentry accepts only
+// one event per envelope.
+func (s *sentrySink) post(records []record) error {
+	for _, r := range records {
+		var event struct {
+			EventID string `json:"event_id"`
+		}
+		json.Unmarshal(r.Line, &event)
+		var b bytes.Buffer
+		fmt.Fprintf(&b, `{"event_id":%q,"sent_at":%q}`+"\n", event.EventID, time.Now().UTC().Format(time.RFC3339))
+		fmt.Fprintf(&b, `{"type":"event","length":%d}`+"\n", len(r.Line))
+		b.Write(r.Line)
+		b.WriteByte('\n')
+
+		req, err := http.NewRequest(http.MethodPost, s.url, &b)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/x-sentry-envelope")
+		req.Header.Set("X-Sentry-Auth", s.auth)
+		if err := doRequest(s.client, req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// session is a simulated client visiting the site: every request it makes
+// carries the same IP, host, user agent and trace_session_id. Each page view
+// is followed by the assets and API calls the page triggers, then by a pause
+// before the next page view.
+type session struct {
+	ID        string `json:"id"`
+	IP        string `json:"ip"`
+	Host      string `json:"host"`
+	UserAgent string `json:"user_agent"`
+	// Pages is the number of page views left, Queue the assets and API
+	// calls of the current page still to be requested
+	Pages int      `json:"pages"`
+	Queue []string `json:"queue,omitempty"`
+	// Next is when the client sends its next request
+	Next time.Time `json:"next"`
+}
+
+// done reports whether the client has nothing left to request.
+func (s *session) done() bool {
+	return s.Pages == 0 && len(s.Queue) == 0
+}
+
+// sessionEngine keeps up to SESSIONS clients browsing at once and decides
+// which of them sends each request.
+type sessionEngine struct {
+	max   int
+	pages int
+	think time.Duration
+	// PATHS split by classifyPath; pages is all of PATHS if none is a page
+	landing, assets, apis []string
+	active                []*session
+}
+
+// sessionAssetGap is the mean pause between the requests a page triggers.
+const sessionAssetGap = 200 * time.Millisecond
+
+func newSessionEngine(cfg config, paths []string) (*sessionEngine, error) {
+	if cfg.SessionPages < 1 {
+		return nil, fmt.Errorf("SESSION_PAGES must be at least 1, got %d", cfg.SessionPages)
+	}
+	e := &sessionEngine{max: cfg.Sessions, pages: cfg.SessionPages, think: cfg.SessionThinkTime}
+	for _, p := range paths {
+		switch classifyPath(p) {
+		case pagePath:
+			e.landing = append(e.landing, p)
+		case staticPath:
+			e.assets = append(e.assets, p)
+		case apiPath:
+			e.apis = append(e.apis, p)
+		}
+	}
+	if len(e.landing) == 0 {
+		e.landing = paths
+	}
+	return e, nil
+}
+
+// request picks the client sending the request at t and returns it with the
+// path it requests. A new client, starting from ip and host, joins when no
+// client is due and fewer than SESSIONS are browsing.
+func (e *sessionEngine) request(g *generator, t time.Time, ip, host string) (*session, string) {
+	var s *session
+	var ready []*session
+	for _, a := range e.active {
+		if !a.Next.After(t) {
+			ready = append(ready, a)
+		}
+	}
+	switch {
+	case len(ready) > 0:
+		s = ready[g.rng.Intn(len(ready))]
+	case len(e.active) < e.max:
+		s = &session{
+			ID:        newRequestID(g.rng),
+			IP:        ip,
+			Host:      host,
+			UserAgent: g.userAgent(),
+			// About SESSION_PAGES on average, with a long tail
+			Pages: 1 + int(g.rng.ExpFloat64()*float64(e.pages-1)),
+		}
+		e.active = append(e.active, s)
+	default:
+		// More requests than the clients would send: the earliest goes early
+		s = slices.MinFunc(e.active, func(a, b *session) int { return a.Next.Compare(b.Next) })
+	}
+
+	var path string
+	if len(s.Queue) > 0 {
+		path, s.Queue = s.Queue[0], s.Queue[1:]
+	} else {
+		path = e.landing[g.rng.Intn(len(e.landing))]
+		s.Pages--
+		if len(e.assets) > 0 {
+			for range g.rng.Intn(min(len(e.assets), 6) + 1) {
+				s.Queue = append(s.Queue, e.assets[g.rng.Intn(len(e.assets))])
+			}
+		}
+		if len(e.apis) > 0 {
+			for range g.rng.Intn(4) {
+				s.Queue = append(s.Queue, e.apis[g.rng.Intn(len(e.apis))])
+			}
+		}
+	}
+	gap := sessionAssetGap
+	if len(s.Queue) == 0 {
+		gap = e.think
+	}
+	s.Next = t.Add(time.Duration(g.rng.ExpFloat64() * float64(gap)))
+	if s.done() {
+		e.active = slices.DeleteFunc(e.active, func(a *session) bool { return a == s })
+	}
+	return s, path
+}
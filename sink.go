@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// record is a single rendered log line on its way to a sink. Entry is nil for
+// lines that are not access log entries (controller events, stack traces,
+// error log lines).
+type record struct {
+	Time  time.Time
+	Entry *logEntry
+	Line  []byte
+}
+
+// sink is a destination for rendered log lines.
+type sink interface {
+	Send(r record) error
+	Close() error
+}
+
+// sinkConfig holds the settings of all sink types. Each sink only reads the
+// fields belonging to its own type.
+type sinkConfig struct {
+	// Batching for sinks that write in bulk
+	BatchSize     int           `env:"BATCH_SIZE" envDefault:"500"`
+	BatchInterval time.Duration `env:"BATCH_INTERVAL" envDefault:"1s"`
+
+	// TLS settings for sinks connecting over TLS
+	TLS tlsConfig
+
+	// Proxy for HTTP-based sinks; HTTP_PROXY/HTTPS_PROXY are honoured when unset
+	ProxyURL string `env:"PROXY_URL" envDefault:""`
+
+	// OAuth2 client-credentials flow for HTTP-based sinks
+	OAuth2TokenURL     string `env:"OAUTH2_TOKEN_URL" envDefault:""`
+	OAuth2ClientID     string `env:"OAUTH2_CLIENT_ID" envDefault:""`
+	OAuth2ClientSecret string `env:"OAUTH2_CLIENT_SECRET" envDefault:""`
+	OAuth2Scopes       string `env:"OAUTH2_SCOPES" envDefault:""`
+	OAuth2Audience     string `env:"OAUTH2_AUDIENCE" envDefault:""`
+
+	// systemd journal socket and SYSLOG_IDENTIFIER of SINK=journald
+	JournalSocket     string `env:"JOURNAL_SOCKET" envDefault:"/run/systemd/journal/socket"`
+	JournalIdentifier string `env:"JOURNAL_IDENTIFIER" envDefault:"nginx"`
+
+	// database/sql driver (sqlite or postgres), DSN and table of SINK=database
+	DBDriver string `env:"DB_DRIVER" envDefault:"sqlite"`
+	DBDSN    string `env:"DB_DSN" envDefault:"nginx-logs.db"`
+	DBTable  string `env:"DB_TABLE" envDefault:"nginx_access"`
+
+	// Address, transport (udp, tcp or tls), message format, facility,
+	// severity (auto derives it from the status) and app name of SINK=syslog
+	SyslogAddr     string `env:"SYSLOG_ADDR" envDefault:""`
+	SyslogNetwork  string `env:"SYSLOG_NETWORK" envDefault:"udp"`
+	SyslogFormat   string `env:"SYSLOG_FORMAT" envDefault:"rfc5424"`
+	SyslogFacility string `env:"SYSLOG_FACILITY" envDefault:"local7"`
+	SyslogSeverity string `env:"SYSLOG_SEVERITY" envDefault:"auto"`
+	SyslogAppName  string `env:"SYSLOG_APP_NAME" envDefault:"nginx"`
+
+	// Root of SINK=partitioned, NDJSON files under dt=YYYY-MM-DD/hour=HH
+	PartitionDir string `env:"PARTITION_DIR" envDefault:"logs"`
+
+	// Path of SINK=file, rotated at FILE_MAX_SIZE (0 disables rotation) into
+	// FILE_MAX_FILES numbered files, gzipped with FILE_COMPRESS
+	FilePath     string `env:"FILE_PATH" envDefault:""`
+	FileMaxSize  string `env:"FILE_MAX_SIZE" envDefault:"100MB"`
+	FileMaxFiles int    `env:"FILE_MAX_FILES" envDefault:"5"`
+	FileCompress bool   `env:"FILE_COMPRESS" envDefault:"false"`
+
+	// Push API, stream labels and X-Scope-OrgID tenant of SINK=loki; the
+	// tenant may be a "$variable" of the entry
+	LokiURL    string `env:"LOKI_URL" envDefault:"http://localhost:3100/loki/api/v1/push"`
+	LokiLabels string `env:"LOKI_LABELS" envDefault:"job=nginx"`
+	LokiTenant string `env:"LOKI_TENANT" envDefault:""`
+	// Structured metadata such as "trace_id=$trace_id,request_id=$request_id"
+	LokiMetadata string `env:"LOKI_METADATA" envDefault:""`
+	// Tenant of lines that are not access entries and of empty "$variable"
+	// tenants
+	LokiDefaultTenant string `env:"LOKI_DEFAULT_TENANT" envDefault:"fake"`
+
+	// Endpoint, index pattern (strftime), credentials, retries of failed
+	// documents and _bulk action (index or create) of SINK=elasticsearch
+	ESURL      string `env:"ES_URL" envDefault:"http://localhost:9200"`
+	ESIndex    string `env:"ES_INDEX" envDefault:"nginx-%Y.%m.%d"`
+	ESUsername string `env:"ES_USERNAME" envDefault:""`
+	ESPassword string `env:"ES_PASSWORD" envDefault:""`
+	ESAPIKey   string `env:"ES_API_KEY" envDefault:""`
+	ESRetries  int    `env:"ES_RETRIES" envDefault:"3"`
+	ESOpType   string `env:"ES_OP_TYPE" envDefault:"index"`
+	// Data stream such as "logs-nginx.access-default", replacing ES_INDEX
+	ESDataStream string `env:"ES_DATA_STREAM" envDefault:""`
+	// Create an index template for ES_DATA_STREAM at startup, with the
+	// ES_ILM_POLICY lifecycle policy if set
+	ESIndexTemplate bool   `env:"ES_INDEX_TEMPLATE" envDefault:"true"`
+	ESILMPolicy     string `env:"ES_ILM_POLICY" envDefault:""`
+	// AWS SigV4 signing for Amazon OpenSearch Service (es) and OpenSearch
+	// Serverless (aoss), enabled by the region
+	ESAWSRegion        string `env:"ES_AWS_REGION" envDefault:""`
+	ESAWSService       string `env:"ES_AWS_SERVICE" envDefault:"es"`
+	AWSAccessKeyID     string `env:"AWS_ACCESS_KEY_ID" envDefault:""`
+	AWSSecretAccessKey string `env:"AWS_SECRET_ACCESS_KEY" envDefault:""`
+	AWSSessionToken    string `env:"AWS_SESSION_TOKEN" envDefault:""`
+
+	// Endpoint, method, "Name: value" headers, batch envelope (ndjson,
+	// json-array, records, es-bulk or hec) and content type of SINK=http
+	HTTPURL         string `env:"HTTP_URL" envDefault:""`
+	HTTPMethod      string `env:"HTTP_METHOD" envDefault:"POST"`
+	HTTPHeaders     string `env:"HTTP_HEADERS" envDefault:""`
+	HTTPEnvelope    string `env:"HTTP_ENVELOPE" envDefault:"ndjson"`
+	HTTPContentType string `env:"HTTP_CONTENT_TYPE" envDefault:""`
+
+	// Brokers, default topic, "condition=topic" routes, message key template,
+	// "name=value" headers and TLS of SINK=kafka
+	KafkaBrokers     string `env:"KAFKA_BROKERS" envDefault:"localhost:9092"`
+	KafkaTopic       string `env:"KAFKA_TOPIC" envDefault:"nginx-access"`
+	KafkaTopicRoutes string `env:"KAFKA_TOPIC_ROUTES" envDefault:""`
+	KafkaKey         string `env:"KAFKA_KEY" envDefault:""`
+	KafkaHeaders     string `env:"KAFKA_HEADERS" envDefault:""`
+	KafkaTLS         bool   `env:"KAFKA_TLS" envDefault:"false"`
+	// Delivery guarantee: at-least-once, idempotent or transactional
+	KafkaDelivery string `env:"KAFKA_DELIVERY" envDefault:"idempotent"`
+	// transactional.id of KAFKA_DELIVERY=transactional, distinct per instance
+	KafkaTransactionalID string `env:"KAFKA_TRANSACTIONAL_ID" envDefault:"nginx-log-generator"`
+
+	// InfluxDB v2 write API of SINK=influxdb
+	InfluxURL    string `env:"INFLUX_URL" envDefault:"http://localhost:8086"`
+	InfluxOrg    string `env:"INFLUX_ORG" envDefault:""`
+	InfluxBucket string `env:"INFLUX_BUCKET" envDefault:"nginx"`
+	InfluxToken  string `env:"INFLUX_TOKEN" envDefault:""`
+
+	// Batch API, dataset and key of SINK=honeycomb
+	HoneycombURL     string `env:"HONEYCOMB_URL" envDefault:"https://api.honeycomb.io"`
+	HoneycombDataset string `env:"HONEYCOMB_DATASET" envDefault:"nginx"`
+	HoneycombAPIKey  string `env:"HONEYCOMB_API_KEY" envDefault:""`
+
+	// Endpoint, organization, stream and basic auth of SINK=openobserve
+	OpenObserveURL      string `env:"OPENOBSERVE_URL" envDefault:"http://localhost:5080"`
+	OpenObserveOrg      string `env:"OPENOBSERVE_ORG" envDefault:"default"`
+	OpenObserveStream   string `env:"OPENOBSERVE_STREAM" envDefault:"nginx"`
+	OpenObserveUsername string `env:"OPENOBSERVE_USERNAME" envDefault:""`
+	OpenObservePassword string `env:"OPENOBSERVE_PASSWORD" envDefault:""`
+}
+
+// newSink creates the sink with the given name.
+func newSink(name string, cfg sinkConfig) (sink, error) {
+	switch name {
+	case "stdout":
+		return &writerSink{w: os.Stdout}, nil
+	case "stderr":
+		return &writerSink{w: os.Stderr}, nil
+	case "discard":
+		// Useful when lines are only consumed through the admin or gRPC server
+		return &writerSink{w: io.Discard}, nil
+	case "journald":
+		return newJournaldSink(cfg)
+	case "database":
+		return newDBSink(cfg)
+	case "syslog":
+		return newSyslogSink(cfg)
+	case "partitioned":
+		return newPartitionedSink(cfg)
+	case "file":
+		return newFileSink(cfg)
+	case "http":
+		return newHTTPSink(cfg)
+	case "loki":
+		return newLokiSink(cfg)
+	case "elasticsearch":
+		return newElasticSink(cfg)
+	case "kafka":
+		return newKafkaSink(cfg)
+	case "influxdb":
+		return newInfluxSink(cfg)
+	case "honeycomb":
+		return newHoneycombSink(cfg)
+	case "openobserve":
+		return newOpenObserveSink(cfg)
+	default:
+		return nil, fmt.Errorf("unknown sink %q", name)
+	}
+}
+
+// flusher is implemented by sinks that buffer records.
+type flusher interface {
+	Flush() error
+}
+
+// flushSink delivers the records s has buffered, if it buffers any.
+func flushSink(s sink) error {
+	if f, ok := s.(flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// writerSink writes newline-terminated lines to an io.Writer.
+type writerSink struct {
+	w io.Writer
+}
+
+func (s *writerSink) Send(r record) error {
+	_, err := s.w.Write(append(r.Line, '\n'))
+	return err
+}
+
+func (s *writerSink) Close() error {
+	return nil
+}
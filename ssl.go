@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// sslProtocols are the connection kinds SSL_PROTOCOL_MIX can weight, by
+// their nginx $ssl_protocol, with the OpenSSL names of the ciphers clients
+// negotiate most, the most common first. "http" is plain HTTP.
+var sslProtocols = map[string][]string{
+	"TLSv1.3": {"TLS_AES_256_GCM_SHA384", "TLS_AES_128_GCM_SHA256", "TLS_CHACHA20_POLY1305_SHA256"},
+	"TLSv1.2": {"ECDHE-RSA-AES128-GCM-SHA256", "ECDHE-ECDSA-AES128-GCM-SHA256", "ECDHE-RSA-AES256-GCM-SHA384", "ECDHE-RSA-CHACHA20-POLY1305"},
+	"TLSv1.1": {"ECDHE-RSA-AES128-SHA", "AES128-SHA"},
+	"TLSv1":   {"ECDHE-RSA-AES128-SHA", "AES128-SHA"},
+	"http":    nil,
+}
+
+// sslMixNames maps the names SSL_PROTOCOL_MIX accepts to sslProtocols keys.
+var sslMixNames = map[string]string{
+	"tls1.3": "TLSv1.3", "tls1.2": "TLSv1.2", "tls1.1": "TLSv1.1", "tls1.0": "TLSv1", "http": "http",
+}
+
+// parseSSLProtocolMix parses "protocol:weight" pairs such as
+// "tls1.3:70,tls1.2:25,http:5".
+func parseSSLProtocolMix(spec string) (*weighted[string], error) {
+	mix := &weighted[string]{}
+	for _, part := range parseEnvList(spec) {
+		name, weight, ok := strings.Cut(strings.TrimSpace(part), ":")
+		protocol, known := sslMixNames[strings.ToLower(name)]
+		if !ok || !known {
+			return nil, fmt.Errorf("invalid SSL_PROTOCOL_MIX entry %q (want protocol:weight, protocols tls1.3, tls1.2, tls1.1, tls1.0, http)", part)
+		}
+		w, err := strconv.ParseFloat(weight, 64)
+		if err != nil || w < 0 {
+			return nil, fmt.Errorf("invalid weight in SSL_PROTOCOL_MIX entry %q", part)
+		}
+		mix.add(protocol, w)
+	}
+	if mix.total() == 0 {
+		return nil, fmt.Errorf("SSL_PROTOCOL_MIX must give at least one protocol a positive weight")
+	}
+	return mix, nil
+}
+
+// setSSL fills the scheme and the TLS connection fields of e: a protocol
+// drawn from SSL_PROTOCOL_MIX, one of its common ciphers, with the first
+// ones more likely, and the requested host as the SNI server name. Plain
+// HTTP requests have no TLS fields. HTTP/2 and HTTP/3 are only spoken over
+// TLS, and QUIC requires TLS 1.3, so such requests drawing an older version
+// or plain HTTP use TLS 1.3.
+func (g *generator) setSSL(e *logEntry) {
+	protocol := g.sslMix.draw(g.rng)
+	if (e.HTTP.Protocol == "HTTP/3.0" && protocol != "TLSv1.3") || (e.HTTP.Protocol == "HTTP/2.0" && protocol == "http") {
+		protocol = "TLSv1.3"
+	}
+	ciphers := sslProtocols[protocol]
+	if ciphers == nil {
+		e.HTTP.Scheme = "http"
+		return
+	}
+	e.HTTP.Scheme = "https"
+	e.Nginx.SSLProtocol = protocol
+	e.Nginx.SSLCipher = ciphers[skewedIndex(g.rng, len(ciphers))]
+	e.Nginx.SSLServerName = e.HTTP.Host
+}
+
+// skewedIndex draws an index below n, each about twice as likely as the
+// next.
+func skewedIndex(rnd *rand.Rand, n int) int {
+	i := 0
+	for i < n-1 && rnd.Intn(2) == 0 {
+		i++
+	}
+	return i
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// stackTrace returns a multi-line error dump in the requested style ("go",
+// "nginx" or "mixed", which picks one of the two at random). The dump is
+// returned as a single string with embedded newlines so it is written in one
+// piece, exactly as a crashing process would leave it on stdout.
+func stackTrace(rnd *rand.Rand, now time.Time, style string) string {
+	if style == "mixed" || style == "" {
+		if rnd.Intn(2) == 0 {
+			style = "go"
+		} else {
+			style = "nginx"
+		}
+	}
+
+	if style == "nginx" {
+		return nginxCoreDump(rnd, now)
+	}
+	return goPanic(rnd)
+}
+
+func goPanic(rnd *rand.Rand) string {
+	var b strings.Builder
+	b.WriteString("panic: runtime error: invalid memory address or nil pointer dereference\n")
+	fmt.Fprintf(&b, "[signal SIGSEGV: segmentation violation code=0x1 addr=0x%x pc=0x%x]\n", rnd.Intn(0x100), 0x4a0000+rnd.Intn(0xffff))
+	b.WriteString("\n")
+	fmt.Fprintf(&b, "goroutine %d [running]:\n", rnd.Intn(5000)+1)
+
+	frames := []struct{ fn, file string }{
+		{"main.(*handler).ServeHTTP(0x0, {0x7f1c40, 0xc000126000}, 0xc000148000)", "/app/handler.go"},
+		{"net/http.serverHandler.ServeHTTP({0xc0000a4000?}, {0x7f1c40, 0xc000126000}, 0xc000148000)", "/usr/local/go/src/net/http/server.go"},
+		{"net/http.(*conn).serve(0xc00011e000, {0x7f1d28, 0xc0000a2120})", "/usr/local/go/src/net/http/server.go"},
+	}
+	for _, f := range frames {
+		fmt.Fprintf(&b, "%s\n\t%s:%d +0x%x\n", f.fn, f.file, rnd.Intn(3000)+20, rnd.Intn(0x700))
+	}
+	b.WriteString("created by net/http.(*Server).Serve in goroutine 1\n")
+	fmt.Fprintf(&b, "\t/usr/local/go/src/net/http/server.go:3089 +0x%x", rnd.Intn(0x700))
+	return b.String()
+}
+
+func nginxCoreDump(rnd *rand.Rand, now time.Time) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s [alert] 1#1: worker process %d exited on signal 11 (core dumped)\n", now.Format("2006/01/02 15:04:05"), rnd.Intn(200)+20)
+
+	frames := []string{
+		"ngx_http_upstream_process_header (r=0x%x, u=0x%x) at src/http/ngx_http_upstream.c:2471",
+		"ngx_http_upstream_handler (ev=0x%x) at src/http/ngx_http_upstream.c:1290",
+		"ngx_epoll_process_events (cycle=0x%x, timer=-1, flags=1) at src/event/modules/ngx_epoll_module.c:901",
+		"ngx_process_events_and_timers (cycle=0x%x) at src/event/ngx_event.c:248",
+		"ngx_worker_process_cycle (cycle=0x%x, data=0x%x) at src/os/unix/ngx_process_cycle.c:721",
+	}
+	for i, f := range frames {
+		addr := 0x55d5c6a00000 + rnd.Intn(0xfffff)
+		args := []interface{}{0x55d5c7e00000 + rnd.Intn(0xfffff), 0x55d5c7e00000 + rnd.Intn(0xfffff)}
+		fmt.Fprintf(&b, "#%d  0x%016x in ", i, addr)
+		fmt.Fprintf(&b, f, args[:strings.Count(f, "%")]...)
+		if i < len(frames)-1 {
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
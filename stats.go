@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// runStats summarizes a run for SUMMARY_FILE. Entries generated during
+// WARMUP_DURATION are counted separately and left out of everything else.
+type runStats struct {
+	mu sync.Mutex
+
+	Instance      string            `json:"instance,omitempty"`
+	Seed          int64             `json:"seed"`
+	WarmupEntries uint64            `json:"warmup_entries"`
+	From          time.Time         `json:"from"`
+	To            time.Time         `json:"to"`
+	Entries       uint64            `json:"entries"`
+	Bytes         uint64            `json:"bytes"`
+	Rate          float64           `json:"rate"`
+	StatusCodes   map[int]uint64    `json:"status_codes"`
+	Methods       map[string]uint64 `json:"methods"`
+	Hosts         map[string]uint64 `json:"hosts"`
+}
+
+func newRunStats(instance string) *runStats {
+	return &runStats{
+		Instance:    instance,
+		Seed:        rngSeed,
+		StatusCodes: map[int]uint64{},
+		Methods:     map[string]uint64{},
+		Hosts:       map[string]uint64{},
+	}
+}
+
+// observe counts an entry and the bytes written for it, unless it was
+// generated during the warm-up.
+func (s *runStats) observe(e *logEntry, bytes uint64, warmup bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if warmup {
+		s.WarmupEntries++
+		return
+	}
+	if s.Entries == 0 {
+		s.From = e.Timestamp
+	}
+	s.To = e.Timestamp
+	s.Entries++
+	s.Bytes += bytes
+	s.StatusCodes[e.HTTP.StatusCode]++
+	s.Methods[e.HTTP.Method]++
+	s.Hosts[e.HTTP.Host]++
+}
+
+// write appends the summary as a JSON line to path, or writes it to stderr
+// when path is "-".
+func (s *runStats) write(path string) error {
+	data, err := s.marshal()
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if path == "-" {
+		_, err = os.Stderr.Write(data)
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// marshal returns the summary as JSON.
+func (s *runStats) marshal() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if span := s.To.Sub(s.From).Seconds(); span > 0 {
+		s.Rate = float64(s.Entries-1) / span
+	}
+	return json.Marshal(s)
+}
+
+// classCounts returns when the first counted entry was generated and the
+// entries counted per status class, index 1 for 1xx to 5 for 5xx.
+func (s *runStats) classCounts() (time.Time, [6]uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var counts [6]uint64
+	for code, n := range s.StatusCodes {
+		if class := code / 100; class >= 1 && class <= 5 {
+			counts[class] += n
+		}
+	}
+	return s.From, counts
+}
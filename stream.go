@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// hub fans generated lines out to streaming consumers. Each consumer has a
+// buffer; lines that do not fit are dropped for that consumer only, so a
+// slow subscriber never holds back generation.
+type hub struct {
+	mu      sync.Mutex
+	subs    map[*subscriber]struct{}
+	dropped atomic.Uint64
+}
+
+type subscriber struct {
+	filter streamFilter
+	lines  chan []byte
+}
+
+func newHub() *hub {
+	return &hub{subs: map[*subscriber]struct{}{}}
+}
+
+// subscribe registers a consumer of lines matching filter.
+func (h *hub) subscribe(filter streamFilter) *subscriber {
+	s := &subscriber{filter: filter, lines: make(chan []byte, 1024)}
+	h.mu.Lock()
+	h.subs[s] = struct{}{}
+	h.mu.Unlock()
+	return s
+}
+
+func (h *hub) unsubscribe(s *subscriber) {
+	h.mu.Lock()
+	delete(h.subs, s)
+	h.mu.Unlock()
+}
+
+func (h *hub) publish(instance string, r record) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for s := range h.subs {
+		if !s.filter.match(instance, r.Entry) {
+			continue
+		}
+		select {
+		case s.lines <- r.Line:
+		default:
+			h.dropped.Add(1)
+		}
+	}
+}
+
+// hubSink passes records on to the next sink and publishes them to the hub.
+type hubSink struct {
+	next     sink
+	hub      *hub
+	instance string
+}
+
+func (s *hubSink) Send(r record) error {
+	s.hub.publish(s.instance, r)
+	return s.next.Send(r)
+}
+
+func (s *hubSink) Flush() error {
+	return flushSink(s.next)
+}
+
+func (s *hubSink) Close() error {
+	return s.next.Close()
+}
+
+// streamFilter selects the lines a consumer receives. It is a comma-separated
+// list of conditions that must all hold, such as
+// "http.status_code>=500,http.host=api.example.com". Fields are the dotted
+// names of the JSON output plus "instance"; operators are =, !=, ~ (contains)
+// and the numeric comparisons <, <=, > and >=. Lines that are not access
+// entries, such as controller events, only pass an empty filter.
+type streamFilter []condition
+
+type condition struct {
+	field, op, value string
+	number           float64
+}
+
+func parseStreamFilter(spec string) (streamFilter, error) {
+	var f streamFilter
+	for _, part := range parseEnvList(spec) {
+		part = strings.TrimSpace(part)
+		i := strings.IndexAny(part, "!=<>~")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid filter condition %q", part)
+		}
+		op := part[i : i+1]
+		if rest := part[i:]; strings.HasPrefix(rest, "!=") || strings.HasPrefix(rest, ">=") || strings.HasPrefix(rest, "<=") {
+			op = rest[:2]
+		}
+		c := condition{field: strings.TrimSpace(part[:i]), op: op, value: strings.TrimSpace(part[i+len(op):])}
+		if c.op == "!" {
+			return nil, fmt.Errorf("invalid filter condition %q", part)
+		}
+		switch c.op {
+		case "<", "<=", ">", ">=":
+			n, err := strconv.ParseFloat(c.value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("filter condition %q needs a number", part)
+			}
+			c.number = n
+		}
+		f = append(f, c)
+	}
+	return f, nil
+}
+
+func (f streamFilter) match(instance string, e *logEntry) bool {
+	if len(f) == 0 {
+		return true
+	}
+	if e == nil {
+		return false
+	}
+	values := map[string]string{"instance": instance}
+	for _, fl := range flattenEntry(e) {
+		values[fl.Name] = fl.Value
+	}
+	for _, c := range f {
+		v, ok := values[c.field]
+		switch c.op {
+		case "=":
+			ok = ok && v == c.value
+		case "!=":
+			ok = v != c.value
+		case "~":
+			ok = ok && strings.Contains(v, c.value)
+		default:
+			n, err := strconv.ParseFloat(v, 64)
+			ok = ok && err == nil && compare(n, c.op, c.number)
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func compare(a float64, op string, b float64) bool {
+	switch op {
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	default:
+		return a >= b
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// syslogFacilities and syslogSeverities map the names SYSLOG_FACILITY and
+// SYSLOG_SEVERITY accept to their codes.
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+	"lpr": 6, "news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+var syslogSeverities = map[string]int{
+	"emerg": 0, "alert": 1, "crit": 2, "err": 3,
+	"warning": 4, "notice": 5, "info": 6, "debug": 7,
+}
+
+// syslogSink sends records to a syslog server over UDP, TCP or TLS, as
+// RFC 3164 or RFC 5424 messages. Over TCP and TLS, RFC 5424 messages use
+// octet-counting framing (RFC 6587) and RFC 3164 ones end with a newline.
+type syslogSink struct {
+	conn     net.Conn
+	stream   bool
+	rfc5424  bool
+	facility int
+	// severity is -1 to derive it from the status code, as nginx's own
+	// error levels would
+	severity int
+	hostname string
+	appName  string
+}
+
+func newSyslogSink(cfg sinkConfig) (*syslogSink, error) {
+	if cfg.SyslogAddr == "" {
+		return nil, fmt.Errorf("SINK=syslog requires SYSLOG_ADDR")
+	}
+	s := &syslogSink{appName: cfg.SyslogAppName, severity: -1}
+
+	switch cfg.SyslogFormat {
+	case "rfc3164":
+	case "rfc5424":
+		s.rfc5424 = true
+	default:
+		return nil, fmt.Errorf("unknown SYSLOG_FORMAT %q (want rfc3164 or rfc5424)", cfg.SyslogFormat)
+	}
+	var ok bool
+	if s.facility, ok = syslogFacilities[cfg.SyslogFacility]; !ok {
+		return nil, fmt.Errorf("unknown SYSLOG_FACILITY %q", cfg.SyslogFacility)
+	}
+	if cfg.SyslogSeverity != "auto" {
+		if s.severity, ok = syslogSeverities[cfg.SyslogSeverity]; !ok {
+			return nil, fmt.Errorf("unknown SYSLOG_SEVERITY %q", cfg.SyslogSeverity)
+		}
+	}
+	s.hostname, _ = os.Hostname()
+	if s.hostname == "" {
+		s.hostname = "-"
+	}
+
+	var err error
+	switch cfg.SyslogNetwork {
+	case "udp":
+		s.conn, err = net.Dial("udp", cfg.SyslogAddr)
+	case "tcp":
+		s.conn, err = net.Dial("tcp", cfg.SyslogAddr)
+		s.stream = true
+	case "tls":
+		var conf *tls.Config
+		if conf, err = cfg.TLS.build(); err != nil {
+			return nil, err
+		}
+		s.conn, err = tls.Dial("tcp", cfg.SyslogAddr, conf)
+		s.stream = true
+	default:
+		return nil, fmt.Errorf("unknown SYSLOG_NETWORK %q (want udp, tcp or tls)", cfg.SyslogNetwork)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("connecting to syslog: %w", err)
+	}
+	return s, nil
+}
+
+func (s *syslogSink) Send(r record) error {
+	severity := s.severity
+	if severity < 0 {
+		severity = 6
+		if e := r.Entry; e != nil {
+			switch {
+			case e.HTTP.StatusCode >= 500:
+				severity = 3
+			case e.HTTP.StatusCode >= 400:
+				severity = 4
+			}
+		}
+	}
+	pri := s.facility*8 + severity
+
+	var msg []byte
+	if s.rfc5424 {
+		msg = fmt.Appendf(nil, "<%d>1 %s %s %s - - - %s", pri, r.Time.Format("2006-01-02T15:04:05.000000Z07:00"), s.hostname, s.appName, r.Line)
+	} else {
+		msg = fmt.Appendf(nil, "<%d>%s %s %s: %s", pri, r.Time.Format(time.Stamp), s.hostname, s.appName, r.Line)
+	}
+
+	switch {
+	case !s.stream:
+	case s.rfc5424:
+		msg = append(strconv.AppendInt(nil, int64(len(msg)), 10), append([]byte{' '}, msg...)...)
+	default:
+		msg = append(msg, '\n')
+	}
+	_, err := s.conn.Write(msg)
+	return err
+}
+
+func (s *syslogSink) Close() error {
+	return s.conn.Close()
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// nginxVariables fills nginx log_format variables from an entry. Values that
+// the entry does not carry, such as the upstream address, are derived from
+// the request ID, so rendering an entry twice gives the same line.
+var nginxVariables = map[string]func(e *logEntry) string{
+	"remote_addr":          func(e *logEntry) string { return e.Nginx.RemoteAddr },
+	"remote_user":          func(e *logEntry) string { return e.Nginx.RemoteUser },
+	"time_local":           func(e *logEntry) string { return e.Timestamp.Format(timeLocalLayout) },
+	"time_iso8601":         func(e *logEntry) string { return e.Timestamp.Format(time.RFC3339) },
+	"msec":                 func(e *logEntry) string { return fmt.Sprintf("%.3f", float64(e.Timestamp.UnixMilli())/1000) },
+	"request":              func(e *logEntry) string { return e.HTTP.Method + " " + e.HTTP.URI + " " + e.HTTP.Protocol },
+	"request_method":       func(e *logEntry) string { return e.HTTP.Method },
+	"request_uri":          func(e *logEntry) string { return e.HTTP.URI },
+	"args":                 func(e *logEntry) string { _, args, _ := strings.Cut(e.HTTP.URI, "?"); return args },
+	"query_string":         func(e *logEntry) string { _, args, _ := strings.Cut(e.HTTP.URI, "?"); return args },
+	"server_protocol":      func(e *logEntry) string { return e.HTTP.Protocol },
+	"status":               func(e *logEntry) string { return strconv.Itoa(e.HTTP.StatusCode) },
+	"body_bytes_sent":      func(e *logEntry) string { return e.HTTP.BytesSent },
+	"bytes_sent":           func(e *logEntry) string { return strconv.Itoa(headerBytes(e) + atoi(e.HTTP.BytesSent)) },
+	"request_length":       func(e *logEntry) string { return strconv.Itoa(300 + int(entryHash(e, "request_length")%900)) },
+	"request_time":         func(e *logEntry) string { return fmt.Sprintf("%.3f", e.HTTP.RequestTime) },
+	"http_referer":         func(e *logEntry) string { return e.Nginx.HTTPReferrer },
+	"http_user_agent":      func(e *logEntry) string { return e.HTTP.UserAgent },
+	"http_x_forwarded_for": func(e *logEntry) string { return e.Nginx.XForwardFor },
+	"http_cookie":          func(e *logEntry) string { return e.Nginx.HTTPCookie },
+	"http_accept_encoding": func(e *logEntry) string { return e.HTTP.AcceptEncoding },
+	"http_traceparent":     func(e *logEntry) string { return e.HTTP.Traceparent },
+	"host":                 func(e *logEntry) string { return e.HTTP.Host },
+	"http_host":            func(e *logEntry) string { return e.HTTP.Host },
+	"scheme":               func(e *logEntry) string { return orDefault(e.HTTP.Scheme, "https") },
+	"ssl_protocol":         func(e *logEntry) string { return e.Nginx.SSLProtocol },
+	"ssl_cipher":           func(e *logEntry) string { return e.Nginx.SSLCipher },
+	"ssl_server_name":      func(e *logEntry) string { return e.Nginx.SSLServerName },
+	"ingress_name":         func(e *logEntry) string { return e.Nginx.IngressName },
+	"request_id":           func(e *logEntry) string { return strings.ReplaceAll(e.HTTP.RequestID, "-", "") },
+	"connection":           func(e *logEntry) string { return strconv.FormatUint(1+entryHash(e, "connection")%1000000, 10) },
+	"connection_requests":  func(e *logEntry) string { return strconv.FormatUint(1+entryHash(e, "connection_requests")%100, 10) },
+	"pid":                  func(e *logEntry) string { return strconv.Itoa(controllerPID) },
+	"hostname":             func(e *logEntry) string { return templateHostname(e) },
+
+	"sent_http_content_type":      func(e *logEntry) string { return e.HTTP.ContentType },
+	"sent_http_content_length":    func(e *logEntry) string { return e.HTTP.ContentLength },
+	"sent_http_content_encoding":  func(e *logEntry) string { return e.HTTP.ContentEncoding },
+	"sent_http_transfer_encoding": func(e *logEntry) string { return e.HTTP.TransferEncoding },
+
+	// $uri is the path after ingress rewrites, $request_uri the client's
+	"uri": func(e *logEntry) string {
+		path, _, _ := strings.Cut(orDefault(e.Nginx.UpstreamURI, e.HTTP.URI), "?")
+		return path
+	},
+	"upstream_addr": upstreamAddr,
+	"upstream_status": func(e *logEntry) string {
+		return orDefault(e.Nginx.UpstreamStatus, strconv.Itoa(e.HTTP.StatusCode))
+	},
+	"upstream_response_time": func(e *logEntry) string {
+		return orDefault(e.Nginx.UpstreamResponseTime, fmt.Sprintf("%.3f", float64(e.HTTP.RequestTime)*0.95))
+	},
+	"upstream_response_length": func(e *logEntry) string {
+		return orDefault(e.Nginx.UpstreamResponseLength, e.HTTP.BytesSent)
+	},
+	"proxy_upstream_name":             func(e *logEntry) string { return e.Nginx.ProxyUpstreamName },
+	"proxy_alternative_upstream_name": func(e *logEntry) string { return e.Nginx.ProxyAlternativeUpstreamName },
+}
+
+// newTemplateFormatter compiles a log_format string such as
+// `$remote_addr [$time_local] "$request" $status ${request_time}s`.
+// Variables are escaped as nginx does by default and empty ones print "-".
+func newTemplateFormatter(format string) (formatter, error) {
+	var parts []func(e *logEntry) string
+	for format != "" {
+		i := strings.IndexByte(format, '$')
+		if i < 0 {
+			i = len(format)
+		}
+		if i > 0 {
+			literal := format[:i]
+			parts = append(parts, func(*logEntry) string { return literal })
+			format = format[i:]
+			continue
+		}
+
+		var name string
+		if strings.HasPrefix(format, "${") {
+			end := strings.IndexByte(format, '}')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated ${")
+			}
+			name, format = format[2:end], format[end+1:]
+		} else {
+			end := 1
+			for end < len(format) && isVariableChar(format[end]) {
+				end++
+			}
+			name, format = format[1:end], format[end:]
+		}
+		value, ok := nginxVariables[name]
+		if !ok {
+			return nil, fmt.Errorf("unsupported variable $%s", name)
+		}
+		parts = append(parts, func(e *logEntry) string { return orDash(escapeNginx(value(e))) })
+	}
+
+	return func(e *logEntry) ([]byte, error) {
+		var b strings.Builder
+		for _, part := range parts {
+			b.WriteString(part(e))
+		}
+		return []byte(b.String()), nil
+	}, nil
+}
+
+func isVariableChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// entryHash returns a hash of the entry's request ID salted with name, a
+// stable stand-in for random values the entry does not store.
+func entryHash(e *logEntry, name string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(e.HTTP.RequestID))
+	h.Write([]byte(name))
+	return h.Sum64()
+}
+
+// upstreamAddr returns the entry's upstream_addr, or picks one of the
+// backend pods of its host when UPSTREAM_FIELDS is off.
+func upstreamAddr(e *logEntry) string {
+	if e.Nginx.UpstreamAddr != "" {
+		return e.Nginx.UpstreamAddr
+	}
+	return upstreamPodAddr(e.HTTP.Host, int(entryHash(e, "upstream_addr")%upstreamPods))
+}
+
+// headerBytes estimates the size of the response headers nginx adds to
+// $bytes_sent.
+func headerBytes(e *logEntry) int {
+	return 180 + int(entryHash(e, "headers")%120)
+}
+
+func templateHostname(e *logEntry) string {
+	if e.Kubernetes != nil {
+		return e.Kubernetes.PodName
+	}
+	name, err := os.Hostname()
+	if err != nil {
+		return "localhost"
+	}
+	return name
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// tlsConfig is the TLS setup shared by every sink that connects over TLS.
+type tlsConfig struct {
+	// CA bundle replacing the system roots, client certificate and key for
+	// mutual TLS, verification switch and expected server name
+	CAFile             string `env:"TLS_CA_FILE" envDefault:""`
+	CertFile           string `env:"TLS_CERT_FILE" envDefault:""`
+	KeyFile            string `env:"TLS_KEY_FILE" envDefault:""`
+	InsecureSkipVerify bool   `env:"TLS_INSECURE_SKIP_VERIFY" envDefault:"false"`
+	ServerName         string `env:"TLS_SERVER_NAME" envDefault:""`
+}
+
+// build returns the crypto/tls configuration: a custom CA bundle replaces the
+// system roots, and a client certificate enables mutual TLS.
+func (c tlsConfig) build() (*tls.Config, error) {
+	conf := &tls.Config{
+		InsecureSkipVerify: c.InsecureSkipVerify,
+		ServerName:         c.ServerName,
+	}
+
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading TLS_CA_FILE: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", c.CAFile)
+		}
+		conf.RootCAs = pool
+	}
+
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+
+	return conf, nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// parseTraceSampling parses tiers like "5xx:100,4xx:10,2xx:1" into the
+// percentage of requests carrying a sampled trace, indexed by status class
+// (1-5). Classes that are not listed are never sampled.
+func parseTraceSampling(spec string) ([6]float64, error) {
+	var tiers [6]float64
+	for _, part := range parseEnvList(spec) {
+		class, percent, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok || len(class) != 3 || !strings.HasSuffix(class, "xx") || class[0] < '1' || class[0] > '5' {
+			return tiers, fmt.Errorf("invalid TRACE_SAMPLING tier %q (want e.g. 5xx:100)", part)
+		}
+		p, err := strconv.ParseFloat(percent, 64)
+		if err != nil {
+			return tiers, fmt.Errorf("invalid TRACE_SAMPLING percentage in %q: %w", part, err)
+		}
+		tiers[class[0]-'0'] = p
+	}
+	return tiers, nil
+}
+
+// traceparent returns a W3C traceparent header value with the sampled flag
+// set.
+func traceparent(rnd *rand.Rand) string {
+	return fmt.Sprintf("00-%016x%016x-%016x-01", rnd.Uint64(), rnd.Uint64(), rnd.Uint64()|1)
+}
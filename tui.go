@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sparkWidth is the number of ticks a status sparkline shows.
+const sparkWidth = 40
+
+var sparkBars = []rune("▁▂▃▄▅▆▇█")
+
+// dashboard is the TUI: a terminal screen on stderr redrawn every
+// TUI_INTERVAL with each instance's achieved rate, per-status-class
+// sparklines and scenario phase, and the health of the batching sinks. It
+// redraws in place rather than on the alternate screen, so the last frame
+// stays visible, and screenshots can be taken after the run.
+type dashboard struct {
+	out      io.Writer
+	interval time.Duration
+	runners  []*runner
+	began    time.Time
+	drawn    time.Time
+	// history holds, per runner, the entries per tick of each status class
+	history [][6][]uint64
+	last    []struct {
+		entries uint64
+		classes [6]uint64
+	}
+	done    chan struct{}
+	stopped sync.WaitGroup
+}
+
+func newDashboard(cfg config, runners []*runner) (*dashboard, error) {
+	if cfg.Interactive {
+		return nil, fmt.Errorf("TUI cannot be combined with INTERACTIVE, both use the terminal")
+	}
+	if cfg.TUIInterval <= 0 {
+		return nil, fmt.Errorf("TUI_INTERVAL must be positive, got %s", cfg.TUIInterval)
+	}
+	if fi, err := os.Stderr.Stat(); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return nil, fmt.Errorf("TUI needs stderr to be a terminal")
+	}
+	d := &dashboard{
+		out:      os.Stderr,
+		interval: cfg.TUIInterval,
+		runners:  runners,
+		began:    time.Now(),
+		drawn:    time.Now(),
+		history:  make([][6][]uint64, len(runners)),
+		last: make([]struct {
+			entries uint64
+			classes [6]uint64
+		}, len(runners)),
+		done: make(chan struct{}),
+	}
+	return d, nil
+}
+
+// start clears the screen, hides the cursor and redraws until stop.
+func (d *dashboard) start() {
+	fmt.Fprint(d.out, "\x1b[2J\x1b[?25l")
+	d.stopped.Add(1)
+	go func() {
+		defer d.stopped.Done()
+		ticker := time.NewTicker(d.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-d.done:
+				return
+			case <-ticker.C:
+				d.draw()
+			}
+		}
+	}()
+}
+
+// stop draws the final frame, unless a tick just drew one, and gives the
+// cursor back.
+func (d *dashboard) stop() {
+	close(d.done)
+	d.stopped.Wait()
+	if time.Since(d.drawn) > d.interval/4 {
+		d.draw()
+	}
+	fmt.Fprint(d.out, "\x1b[?25h")
+}
+
+func (d *dashboard) draw() {
+	var b strings.Builder
+	line := func(format string, args ...any) {
+		fmt.Fprintf(&b, format, args...)
+		b.WriteString("\x1b[K\n")
+	}
+	b.WriteString("\x1b[H")
+	line("\x1b[1mnginx-log-generator\x1b[0m  seed %d  up %s", rngSeed, time.Since(d.began).Truncate(time.Second))
+	seconds := time.Since(d.drawn).Seconds()
+	d.drawn = time.Now()
+	for i, r := range d.runners {
+		line("")
+		if r.name != "" {
+			line("\x1b[1minstance %s\x1b[0m", r.name)
+		}
+		entries := r.entries.Load()
+		from, classes := r.stats.classCounts()
+		now := r.clk.now()
+		line("rate     %8.1f/s achieved  %8.1f/s base  %d entries  %s written",
+			float64(entries-d.last[i].entries)/seconds, r.baseRate(now)*r.ctl.rateFactor(), entries, formatBytes(r.bytes.Load()))
+		for class := 1; class <= 5; class++ {
+			n := classes[class] - d.last[i].classes[class]
+			h := append(d.history[i][class], n)
+			if len(h) > sparkWidth {
+				h = h[len(h)-sparkWidth:]
+			}
+			d.history[i][class] = h
+			line("%s  %s %8.1f/s", classLabel(class), sparkline(h), float64(n)/seconds)
+		}
+		d.last[i].entries, d.last[i].classes = entries, classes
+		phases := "-"
+		if !from.IsZero() {
+			if p := r.phases(now, now.Sub(from)+r.cfg.WarmupDuration); len(p) > 0 {
+				phases = strings.Join(p, ", ")
+			}
+		}
+		line("phase    %s", phases)
+	}
+	line("")
+	line("sinks    %s", sinkHealth())
+	b.WriteString("\x1b[J")
+	io.WriteString(d.out, b.String())
+}
+
+// sparkline draws counts as bars scaled to their maximum.
+func sparkline(counts []uint64) string {
+	var top uint64
+	for _, n := range counts {
+		top = max(top, n)
+	}
+	var b strings.Builder
+	for range sparkWidth - len(counts) {
+		b.WriteByte(' ')
+	}
+	for _, n := range counts {
+		if n == 0 {
+			b.WriteByte(' ')
+			continue
+		}
+		b.WriteRune(sparkBars[int(n*uint64(len(sparkBars)-1)/top)])
+	}
+	return b.String()
+}
+
+// classLabel names a status class, 4xx in yellow and 5xx in red.
+func classLabel(class int) string {
+	switch class {
+	case 5:
+		return "\x1b[31m5xx\x1b[0m"
+	case 4:
+		return "\x1b[33m4xx\x1b[0m"
+	}
+	return fmt.Sprintf("%dxx", class)
+}
+
+// formatBytes renders a byte count with a binary unit.
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// phases names the scenario phases active at now, elapsed into the run:
+// spikes, console adjustments, maintenance, failover, blue/green and DDoS.
+// It only reads settings that do not change while generating.
+func (r *runner) phases(now time.Time, elapsed time.Duration) []string {
+	g := r.gen
+	var active []string
+	for _, s := range g.spikes {
+		if s.covers(now) {
+			active = append(active, "spike "+s.spec)
+		}
+	}
+	if f := r.ctl.rateFactor(); f != 1 {
+		active = append(active, fmt.Sprintf("console spike %gx", f))
+	}
+	switch m := g.maintenance; {
+	case m.inWindow(elapsed):
+		active = append(active, "maintenance of "+strings.Join(m.hostList, ", "))
+	case m.retrying(elapsed):
+		active = append(active, "maintenance retries")
+	}
+	if g.failover.active(elapsed) {
+		active = append(active, "failover of "+g.failover.region)
+	}
+	if r.cfg.BlueGreenAt > 0 && elapsed >= r.cfg.BlueGreenAt {
+		active = append(active, "green upstream")
+	}
+	if f := g.ddos.rateFactor(elapsed); f > 1 {
+		active = append(active, fmt.Sprintf("ddos on %s at %.1fx", g.ddos.path, f))
+	}
+	return active
+}
+
+// sinkHealth summarizes the batching sinks: records flushed and waiting,
+// and failed flushes with the records they dropped and the last error.
+func sinkHealth() string {
+	batchers.mu.Lock()
+	list := batchers.list
+	batchers.mu.Unlock()
+	if len(list) == 0 {
+		return "writing directly, no batching sinks"
+	}
+	var flushed, failed, dropped uint64
+	var pending int64
+	var lastErr string
+	for _, b := range list {
+		flushed += b.flushed.Load()
+		failed += b.failed.Load()
+		dropped += b.dropped.Load()
+		pending += b.pending.Load()
+		if err, ok := b.lastErr.Load().(string); ok {
+			lastErr = err
+		}
+	}
+	health := fmt.Sprintf("%d batching, %d records flushed, %d pending, ", len(list), flushed, pending)
+	if failed == 0 {
+		return health + "\x1b[32mno failed flushes\x1b[0m"
+	}
+	if len(lastErr) > 100 {
+		lastErr = lastErr[:100] + "…"
+	}
+	return health + fmt.Sprintf("\x1b[31m%d failed flushes, %d records dropped\x1b[0m, last: %s", failed, dropped, lastErr)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// upstreamPods is the number of backend pods behind each host.
+const upstreamPods = 3
+
+// setUpstream fills the upstream fields of e as ingress-nginx logs them.
+// One upstream answers most requests, in a little less time than nginx
+// took. Connection failures make nginx try the next upstream
+// (proxy_next_upstream): UPSTREAM_RETRY_PERCENT of the other requests and
+// half of the 502s list every attempt, so that a retried request may end in
+// 200 with an upstream_status of "502, 200" and a 502 may report "502, 502".
+// Requests the client abandoned (499) have no upstream status.
+func (g *generator) setUpstream(e *logEntry) {
+	status := e.HTTP.StatusCode
+	attempts := 1
+	switch {
+	case status == 502:
+		attempts += g.rng.Intn(2)
+	case status != 504 && status != 499 && g.rng.Float64()*100 < g.cfg.UpstreamRetryPercent:
+		attempts = 2
+	}
+
+	// Each failed attempt is a refused or reset connection taking a few
+	// milliseconds; the last attempt takes the rest of the request time
+	total := float64(e.HTTP.RequestTime) * (0.85 + g.rng.Float64()*0.14)
+	first := g.rng.Intn(upstreamPods)
+	addrs := make([]string, attempts)
+	statuses := make([]string, attempts)
+	times := make([]string, attempts)
+	lengths := make([]string, attempts)
+	failed := 0.0
+	for i := range attempts {
+		addrs[i] = upstreamPodAddr(e.HTTP.Host, (first+i)%upstreamPods)
+		statuses[i], lengths[i] = "502", "0"
+		t := min(float64(g.rng.Intn(4))/1000, total-failed)
+		if i == attempts-1 {
+			statuses[i], lengths[i] = strconv.Itoa(status), e.HTTP.BytesSent
+			t = max(total-failed, 0)
+		}
+		failed += t
+		times[i] = fmt.Sprintf("%.3f", math.Floor(t*1000)/1000)
+	}
+	if status == 499 {
+		statuses[attempts-1], lengths[attempts-1] = "-", "0"
+	}
+	e.Nginx.UpstreamAddr = strings.Join(addrs, ", ")
+	e.Nginx.UpstreamStatus = strings.Join(statuses, ", ")
+	e.Nginx.UpstreamResponseTime = strings.Join(times, ", ")
+	e.Nginx.UpstreamResponseLength = strings.Join(lengths, ", ")
+}
+
+// upstreamPodAddr returns the address of one of the backend pods of host,
+// with a pod network chosen by the host.
+func upstreamPodAddr(host string, pod int) string {
+	h := fnv.New32a()
+	h.Write([]byte(host))
+	base := h.Sum32()
+	return fmt.Sprintf("10.%d.%d.%d:8080", 244+base%4, base>>8&0xff, (base>>16+uint32(pod)*7)%254+1)
+}
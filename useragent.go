@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// userAgentClasses are the client kinds USER_AGENT_MIX can weight. Browsers
+// come from the faker; the other classes from small lists of common agents.
+var userAgentClasses = map[string][]string{
+	"browser": nil,
+	"mobile": {
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1",
+		"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.6367.82 Mobile Safari/537.36",
+		"Mozilla/5.0 (Linux; Android 13; SM-S911B) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/123.0.6312.118 Mobile Safari/537.36",
+		"Mozilla/5.0 (iPad; CPU OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1",
+	},
+	"bot": {
+		"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+		"Mozilla/5.0 (compatible; bingbot/2.0; +http://www.bing.com/bingbot.htm)",
+		"Mozilla/5.0 (compatible; YandexBot/3.0; +http://yandex.com/bots)",
+		"Mozilla/5.0 (compatible; AhrefsBot/7.0; +http://ahrefs.com/robot/)",
+	},
+	"client": {
+		"curl/8.5.0",
+		"python-requests/2.31.0",
+		"okhttp/4.12.0",
+		"Go-http-client/1.1",
+		"axios/1.6.8",
+	},
+}
+
+// parseUserAgentMix parses "class:weight" pairs such as "browser:60,bot:10".
+// It returns nil for an empty spec.
+func parseUserAgentMix(spec string) (*weighted[string], error) {
+	var mix *weighted[string]
+	for _, part := range parseEnvList(spec) {
+		class, weight, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if _, known := userAgentClasses[class]; !ok || !known {
+			return nil, fmt.Errorf("invalid USER_AGENT_MIX entry %q (want class:weight, classes browser, mobile, bot, client)", part)
+		}
+		w, err := strconv.ParseFloat(weight, 64)
+		if err != nil || w < 0 {
+			return nil, fmt.Errorf("invalid weight in USER_AGENT_MIX entry %q", part)
+		}
+		if mix == nil {
+			mix = &weighted[string]{}
+		}
+		mix.add(class, w)
+	}
+	if mix != nil && mix.total() == 0 {
+		return nil, fmt.Errorf("USER_AGENT_MIX weights must not all be zero")
+	}
+	return mix, nil
+}
+
+// userAgent returns the User-Agent of the next entry, from the user_agent
+// dictionary if there is one.
+func (g *generator) userAgent() string {
+	if d := g.dictionaries["user_agent"]; d != nil {
+		return d.draw(g.rng)
+	}
+	if g.userAgentMix == nil {
+		return g.faker.UserAgent()
+	}
+	if agents := userAgentClasses[g.userAgentMix.draw(g.rng)]; agents != nil {
+		return agents[g.rng.Intn(len(agents))]
+	}
+	return g.faker.UserAgent()
+}
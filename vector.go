@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// vectorProfiles are the remap transforms the generated Vector tests can
+// target, keyed by profile name. The expected output of every test is what
+// the reference transform produces from the input line.
+var vectorProfiles = map[string]string{
+	// Parse the JSON line into the event root
+	"parse": ". = object!(parse_json!(string!(.message)))",
+	// Parse and flatten nested objects into dotted keys
+	"flatten": ". = flatten(object!(parse_json!(string!(.message))))",
+}
+
+// runVectorTests writes pairs of input lines and expected events, a Vector
+// unit test config asserting the expectations against a remap transform, and
+// the reference transform for the chosen profile.
+func runVectorTests(cfg config, args []string) error {
+	fs := flag.NewFlagSet("vector-tests", flag.ExitOnError)
+	dir := fs.String("out", "vector-tests", "directory to write the test files to")
+	n := fs.Int("n", 10, "number of test cases")
+	profile := fs.String("profile", "parse", "transform profile: parse or flatten")
+	transform := fs.String("transform", "parse_nginx", "name of the remap transform under test")
+	fs.Parse(args)
+
+	source, ok := vectorProfiles[*profile]
+	if !ok {
+		return fmt.Errorf("unknown profile %q (want parse or flatten)", *profile)
+	}
+	if err := needBuiltinFormat(cfg, "vector-tests"); err != nil {
+		return err
+	}
+	if cfg.OutputFormat != "json" && cfg.OutputFormat != "winevent-json" {
+		return fmt.Errorf("vector-tests needs a JSON output format, not %s", cfg.OutputFormat)
+	}
+	_, lines, err := sample(cfg, *n)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(*dir, 0o755); err != nil {
+		return err
+	}
+
+	var tests bytes.Buffer
+	tests.WriteString("tests:\n")
+	for i, line := range lines {
+		expected, err := vectorExpected(line, *profile)
+		if err != nil {
+			return err
+		}
+		pretty, _ := json.MarshalIndent(expected, "", "  ")
+		name := fmt.Sprintf("case-%03d", i+1)
+		if err := os.WriteFile(filepath.Join(*dir, name+".input.log"), append(line, '\n'), 0o644); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(*dir, name+".expected.json"), append(pretty, '\n'), 0o644); err != nil {
+			return err
+		}
+
+		// JSON strings are valid YAML double-quoted scalars
+		quotedLine, _ := json.Marshal(string(line))
+		fmt.Fprintf(&tests, "  - name: %s\n    inputs:\n      - insert_at: %s\n        type: log\n        log_fields:\n          message: %s\n",
+			name, *transform, quotedLine)
+		fmt.Fprintf(&tests, "    outputs:\n      - extract_from: %s\n        conditions:\n          - type: vrl\n            source: |\n", *transform)
+		for _, assertion := range vrlAssertions(expected, *profile == "flatten") {
+			fmt.Fprintf(&tests, "              %s\n", assertion)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(*dir, "tests.yaml"), tests.Bytes(), 0o644); err != nil {
+		return err
+	}
+
+	ref := fmt.Sprintf("transforms:\n  %s:\n    type: remap\n    inputs: [nginx]\n    source: |\n      %s\n", *transform, source)
+	return os.WriteFile(filepath.Join(*dir, "transform.yaml"), []byte(ref), 0o644)
+}
+
+// vectorExpected returns the event the profile's transform produces from
+// line. Numbers keep their literal form so they compare exactly in VRL.
+func vectorExpected(line []byte, profile string) (map[string]interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.UseNumber()
+	var event map[string]interface{}
+	if err := dec.Decode(&event); err != nil {
+		return nil, fmt.Errorf("output line is not a JSON object: %w", err)
+	}
+	if profile == "flatten" {
+		flat := map[string]interface{}{}
+		flattenObject(event, "", flat)
+		event = flat
+	}
+	return event, nil
+}
+
+// flattenObject mirrors VRL's flatten: nested objects become dotted keys,
+// arrays are kept as they are.
+func flattenObject(obj map[string]interface{}, prefix string, out map[string]interface{}) {
+	for k, v := range obj {
+		if nested, ok := v.(map[string]interface{}); ok {
+			flattenObject(nested, prefix+k+".", out)
+			continue
+		}
+		out[prefix+k] = v
+	}
+}
+
+// vrlAssertions returns one assert_eq! per leaf field of event, in key order.
+// Flattened keys contain dots and are quoted as a single path segment.
+func vrlAssertions(event map[string]interface{}, flat bool) []string {
+	var assertions []string
+	var walk func(obj map[string]interface{}, path string)
+	walk = func(obj map[string]interface{}, path string) {
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			p := path + "." + vrlPathSegment(k, flat)
+			if nested, ok := obj[k].(map[string]interface{}); ok {
+				walk(nested, p)
+				continue
+			}
+			assertions = append(assertions, fmt.Sprintf("assert_eq!(%s, %s)", p, vrlLiteral(obj[k])))
+		}
+	}
+	walk(event, "")
+	return assertions
+}
+
+func vrlPathSegment(key string, quote bool) string {
+	if quote || strings.ContainsAny(key, "-.@ ") {
+		return vrlLiteral(key)
+	}
+	return key
+}
+
+// vrlLiteral renders v as a VRL literal. JSON strings, numbers, booleans and
+// arrays are VRL literals too, as long as HTML characters stay unescaped.
+func vrlLiteral(v interface{}) string {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.Encode(v)
+	return strings.TrimSuffix(b.String(), "\n")
+}
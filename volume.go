@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// volumeTarget steers the rate towards a number of bytes per second, using
+// a moving average of the bytes written per access entry, including the
+// controller events, stack traces and error lines that come with it.
+type volumeTarget struct {
+	mu          sync.Mutex
+	bytesPerSec float64
+	perEntry    float64
+}
+
+// volumeUnits are the byte units TARGET_VOLUME accepts. Ingest pricing uses
+// decimal units; binary ones are accepted too.
+var volumeUnits = map[string]float64{
+	"B": 1, "KB": 1e3, "MB": 1e6, "GB": 1e9, "TB": 1e12,
+	"KIB": 1 << 10, "MIB": 1 << 20, "GIB": 1 << 30, "TIB": 1 << 40,
+}
+
+var volumePeriods = map[string]time.Duration{
+	"s": time.Second, "sec": time.Second, "min": time.Minute,
+	"h": time.Hour, "hour": time.Hour, "d": 24 * time.Hour, "day": 24 * time.Hour,
+}
+
+// parseVolume reads a volume such as "50GB/day" or "1.5MiB/s".
+func parseVolume(s string) (*volumeTarget, error) {
+	amount, period, ok := strings.Cut(strings.ReplaceAll(s, " ", ""), "/")
+	d, known := volumePeriods[strings.ToLower(period)]
+	if !ok || !known {
+		return nil, fmt.Errorf("invalid TARGET_VOLUME %q (want e.g. 50GB/day, 10MB/s)", s)
+	}
+	n, err := parseSize(amount)
+	if err != nil || n <= 0 {
+		return nil, fmt.Errorf("invalid TARGET_VOLUME %q (want e.g. 50GB/day, 10MB/s)", s)
+	}
+	return &volumeTarget{bytesPerSec: n / d.Seconds()}, nil
+}
+
+// parseSize reads a byte size such as "100MB", "1.5GiB" or plain "4096".
+func parseSize(s string) (float64, error) {
+	i := strings.IndexFunc(s, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if i < 0 {
+		i = len(s)
+	}
+	if i == 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	n, err := strconv.ParseFloat(s[:i], 64)
+	unit, known := volumeUnits[strings.ToUpper(s[i:])]
+	if s[i:] == "" {
+		unit, known = 1, true
+	}
+	if err != nil || !known {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * unit, nil
+}
+
+// observe records the bytes written for one access entry.
+func (v *volumeTarget) observe(bytes uint64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.perEntry == 0 {
+		v.perEntry = float64(bytes)
+		return
+	}
+	// Follow changes in entry size, e.g. from scenarios, within a few
+	// hundred entries
+	v.perEntry += (float64(bytes) - v.perEntry) / 200
+}
+
+// rate returns the entries per second that hit the target, or fallback
+// before the first entry has been measured.
+func (v *volumeTarget) rate(fallback float64) float64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.perEntry == 0 {
+		return fallback
+	}
+	return v.bytesPerSec / v.perEntry
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// weighted draws values with probability proportional to their weights.
+// Each value owns the half-open interval [cdf[i-1], cdf[i]) of the roll, so
+// every bucket gets exactly its share and values of weight 0 are never
+// drawn.
+type weighted[T any] struct {
+	values []T
+	// cdf holds the running totals of the weights
+	cdf []float64
+}
+
+// add appends value with the given weight, which must not be negative.
+func (w *weighted[T]) add(value T, weight float64) {
+	w.values = append(w.values, value)
+	w.cdf = append(w.cdf, w.total()+weight)
+}
+
+// total returns the sum of the weights.
+func (w *weighted[T]) total() float64 {
+	if len(w.cdf) == 0 {
+		return 0
+	}
+	return w.cdf[len(w.cdf)-1]
+}
+
+// weight returns the weight of the i-th value.
+func (w *weighted[T]) weight(i int) float64 {
+	if i == 0 {
+		return w.cdf[0]
+	}
+	return w.cdf[i] - w.cdf[i-1]
+}
+
+// draw returns a value using a single draw from rnd. The total weight must
+// be positive.
+func (w *weighted[T]) draw(rnd *rand.Rand) T {
+	return w.pick(rnd.Float64() * w.total())
+}
+
+// pick returns the value whose interval holds roll, in [0, total). A roll
+// rounded up to the total goes to the last value of positive weight.
+func (w *weighted[T]) pick(roll float64) T {
+	i := sort.Search(len(w.cdf), func(i int) bool { return w.cdf[i] > roll })
+	if i == len(w.cdf) {
+		i = sort.Search(len(w.cdf), func(i int) bool { return w.cdf[i] >= w.total() })
+	}
+	return w.values[i]
+}
+
+// parseCodeWeights parses "code:weight" pairs such as "404:60,403:15". It
+// returns nil for an empty spec.
+func parseCodeWeights(spec, name string) (*weighted[int], error) {
+	var weights *weighted[int]
+	for _, part := range parseEnvList(spec) {
+		code, weight, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid %s entry %q (want code:weight)", name, part)
+		}
+		c, err := strconv.Atoi(code)
+		if err != nil {
+			return nil, fmt.Errorf("invalid status code in %s entry %q", name, part)
+		}
+		w, err := strconv.ParseFloat(weight, 64)
+		if err != nil || w < 0 {
+			return nil, fmt.Errorf("invalid weight in %s entry %q", name, part)
+		}
+		if weights == nil {
+			weights = &weighted[int]{}
+		}
+		weights.add(c, w)
+	}
+	if weights != nil && weights.total() == 0 {
+		return nil, fmt.Errorf("%s weights must not all be zero", name)
+	}
+	return weights, nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestWeightedPick(t *testing.T) {
+	// 0 owns [0, 10), 1 has no weight, 2 owns [10, 40) and 3 [40, 100)
+	var w weighted[int]
+	for i, weight := range []float64{10, 0, 30, 60} {
+		w.add(i, weight)
+	}
+	tests := []struct {
+		name string
+		roll float64
+		want int
+	}{
+		{"first edge", 0, 0},
+		{"below first boundary", math.Nextafter(10, 0), 0},
+		{"first boundary skips zero weight", 10, 2},
+		{"inner boundary", 40, 3},
+		{"below total", math.Nextafter(100, 0), 3},
+		{"rounded up to total", 100, 3},
+	}
+	for _, tt := range tests {
+		if got := w.pick(tt.roll); got != tt.want {
+			t.Errorf("%s: pick(%v) = %d, want %d", tt.name, tt.roll, got, tt.want)
+		}
+	}
+}
+
+func TestWeightedTrailingZeroWeight(t *testing.T) {
+	var w weighted[string]
+	w.add("a", 1)
+	w.add("b", 0)
+	if got := w.pick(w.total()); got != "a" {
+		t.Errorf("pick(total) = %q, want the last value of positive weight", got)
+	}
+}
+
+func TestWeightedShares(t *testing.T) {
+	// Totals need not be 100: each value gets weight/total of the rolls
+	tests := [][]float64{
+		{1, 1},
+		{60, 40},
+		{60, 40, 50},
+		{5, 0, 95, 0, 100},
+		{0.5, 99.5, 250},
+	}
+	for _, weights := range tests {
+		var w weighted[int]
+		for i, weight := range weights {
+			w.add(i, weight)
+		}
+		// Rolls at the middle of n equal steps hit each bucket in
+		// proportion to its width
+		const n = 100000
+		counts := make([]int, len(weights))
+		for k := range n {
+			counts[w.pick((float64(k)+0.5)/n*w.total())]++
+		}
+		for i, weight := range weights {
+			want := weight / w.total() * n
+			if math.Abs(float64(counts[i])-want) > 1 {
+				t.Errorf("weights %v: value %d drawn %d times, want %.0f", weights, i, counts[i], want)
+			}
+			if got := w.weight(i); got != weight {
+				t.Errorf("weights %v: weight(%d) = %v, want %v", weights, i, got, weight)
+			}
+		}
+	}
+}
+
+func TestParseCodeWeights(t *testing.T) {
+	tests := []struct {
+		spec    string
+		codes   []int
+		weights []float64
+		err     string
+	}{
+		{spec: ""},
+		{spec: "404:60,403:15", codes: []int{404, 403}, weights: []float64{60, 15}},
+		{spec: "404:60, 500:0, 403:15.5", codes: []int{404, 500, 403}, weights: []float64{60, 0, 15.5}},
+		{spec: "200:150,500:50", codes: []int{200, 500}, weights: []float64{150, 50}},
+		{spec: "404", err: "want code:weight"},
+		{spec: "abc:1", err: "invalid status code"},
+		{spec: "404:x", err: "invalid weight"},
+		{spec: "404:-1", err: "invalid weight"},
+		{spec: "404:0,500:0", err: "must not all be zero"},
+	}
+	for _, tt := range tests {
+		w, err := parseCodeWeights(tt.spec, "STATUS_WEIGHTS")
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("parseCodeWeights(%q) error = %v, want %q", tt.spec, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseCodeWeights(%q): %v", tt.spec, err)
+			continue
+		}
+		if tt.codes == nil {
+			if w != nil {
+				t.Errorf("parseCodeWeights(%q) = %v, want nil", tt.spec, w.values)
+			}
+			continue
+		}
+		if len(w.values) != len(tt.codes) {
+			t.Fatalf("parseCodeWeights(%q) = %v, want %v", tt.spec, w.values, tt.codes)
+		}
+		for i, code := range tt.codes {
+			if w.values[i] != code || w.weight(i) != tt.weights[i] {
+				t.Errorf("parseCodeWeights(%q)[%d] = %d:%v, want %d:%v", tt.spec, i, w.values[i], w.weight(i), code, tt.weights[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"strconv"
+	"time"
+)
+
+// workerChunk is the number of backfill entries handed to a worker at once.
+const workerChunk = 256
+
+// workerJob asks a worker to render the entries at times, numbered from
+// firstRecord on.
+type workerJob struct {
+	seq         uint64
+	firstRecord uint64
+	times       []time.Time
+}
+
+type workerResult struct {
+	seq uint64
+	out []*rendered
+	err error
+}
+
+// workerPool renders entries on WORKERS goroutines, each with a generator of
+// its own on stream "<RNG_STREAM>/worker-<n>" and a formatter of its own. The workers schedule their
+// scenarios from the runner's start and record events through its recorder,
+// so each event happens once, at its configured time. Job n always goes to worker
+// n%WORKERS and results are delivered in job order, so a seeded run gives
+// the same output for the same WORKERS. Only the runner's goroutine
+// dispatches and delivers, so sinks need no locking.
+type workerPool struct {
+	r       *runner
+	jobs    []chan workerJob
+	results chan workerResult
+	// next is the sequence number of the next job, delivered that of the
+	// next result to deliver; done holds results that arrived early
+	next      uint64
+	delivered uint64
+	done      map[uint64]workerResult
+}
+
+func newWorkerPool(r *runner, workers int) (*workerPool, error) {
+	p := &workerPool{
+		r:       r,
+		results: make(chan workerResult, 2*workers),
+		done:    map[uint64]workerResult{},
+	}
+	for i := range workers {
+		g, err := r.sideGenerator("worker-" + strconv.Itoa(i))
+		if err != nil {
+			p.stop()
+			return nil, err
+		}
+		format, err := newFormatter(r.cfg)
+		if err != nil {
+			p.stop()
+			return nil, err
+		}
+		jobs := make(chan workerJob, 2)
+		p.jobs = append(p.jobs, jobs)
+		go p.work(g, format, jobs)
+	}
+	return p, nil
+}
+
+func (p *workerPool) work(g *generator, format formatter, jobs <-chan workerJob) {
+	for job := range jobs {
+		// The runner sets its start before dispatching the first job
+		if g.start.IsZero() {
+			g.start = p.r.gen.start
+		}
+		res := workerResult{seq: job.seq}
+		for i, t := range job.times {
+			out, err := p.r.render(g, format, t, job.firstRecord+uint64(i))
+			if err != nil {
+				res.err = err
+				break
+			}
+			res.out = append(res.out, out)
+		}
+		p.results <- res
+	}
+}
+
+// dispatch queues the entries at times, delivering finished results while it
+// waits for the worker.
+func (p *workerPool) dispatch(times []time.Time) error {
+	job := workerJob{seq: p.next, firstRecord: p.r.records + 1, times: times}
+	jobs := p.jobs[job.seq%uint64(len(p.jobs))]
+	for {
+		select {
+		case jobs <- job:
+			p.next++
+			p.r.records += uint64(len(times))
+			return nil
+		case res := <-p.results:
+			if err := p.collect(res); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// spread dispatches n entries at t, split evenly over the workers.
+func (p *workerPool) spread(t time.Time, n int) error {
+	per := (n + len(p.jobs) - 1) / len(p.jobs)
+	for n > 0 {
+		times := make([]time.Time, min(per, n))
+		for i := range times {
+			times[i] = t
+		}
+		if err := p.dispatch(times); err != nil {
+			return err
+		}
+		n -= len(times)
+	}
+	return nil
+}
+
+// collect delivers res and any results waiting for it, in job order.
+func (p *workerPool) collect(res workerResult) error {
+	p.done[res.seq] = res
+	for {
+		res, ok := p.done[p.delivered]
+		if !ok {
+			return nil
+		}
+		delete(p.done, p.delivered)
+		p.delivered++
+		for _, out := range res.out {
+			if err := p.r.deliver(out); err != nil {
+				return err
+			}
+		}
+		if res.err != nil {
+			return res.err
+		}
+	}
+}
+
+// wait delivers the results of all dispatched jobs.
+func (p *workerPool) wait() error {
+	for p.delivered < p.next {
+		if err := p.collect(<-p.results); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stop lets the workers exit once their queued jobs are done.
+func (p *workerPool) stop() {
+	for _, jobs := range p.jobs {
+		close(jobs)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// proxyNets are the networks proxy hops are drawn from: private networks of
+// corporate proxies and sidecars, and public ranges of CDNs and clouds.
+var proxyNets = func() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, cidr := range []string{
+		"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16",
+		"104.16.0.0/13", "172.64.0.0/13", "34.64.0.0/10", "52.0.0.0/11", "151.101.0.0/16",
+	} {
+		_, n, _ := net.ParseCIDR(cidr)
+		nets = append(nets, n)
+	}
+	return nets
+}()
+
+// proxyChain puts some requests behind proxies and a load balancer, the way
+// nginx sees them in most deployments: remote_addr is the load balancer and
+// X-Forwarded-For lists the client followed by every proxy in between.
+type proxyChain struct {
+	percent float64
+	// hops are drawn from as a weighted list of proxy counts
+	hops []int
+	lbs  []string
+	// realIP keeps the client in remote_addr, as the realip module does
+	realIP bool
+}
+
+func newProxyChain(cfg config) (*proxyChain, error) {
+	c := &proxyChain{percent: cfg.XFFChainPercent, lbs: parseEnvList(cfg.XFFLBAddresses), realIP: cfg.XFFRealIP}
+	for _, part := range parseEnvList(cfg.XFFHops) {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid XFF_HOPS entry %q (want a proxy count such as 0, 1 or 2)", part)
+		}
+		c.hops = append(c.hops, n)
+	}
+	if len(c.hops) == 0 {
+		return nil, fmt.Errorf("XFF_HOPS must list at least one proxy count")
+	}
+	if len(c.lbs) == 0 {
+		return nil, fmt.Errorf("XFF_LB_ADDRESSES must list at least one address")
+	}
+	return c, nil
+}
+
+// forward returns remote_addr and X-Forwarded-For of a request from client.
+func (c *proxyChain) forward(rng *rand.Rand, client string) (string, string) {
+	if rng.Float64()*100 >= c.percent {
+		return client, client
+	}
+	chain := []string{client}
+	for range c.hops[rng.Intn(len(c.hops))] {
+		chain = append(chain, randomIP(rng, proxyNets[rng.Intn(len(proxyNets))]))
+	}
+	lb := c.lbs[rng.Intn(len(c.lbs))]
+	if c.realIP {
+		return client, strings.Join(chain, ", ")
+	}
+	return lb, strings.Join(chain, ", ")
+}